@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 
@@ -12,14 +11,18 @@ import (
 	"github.com/hurou927/db-sub-data/internal/schema"
 )
 
-var analyzeFormat string
+var (
+	analyzeFormat    string
+	analyzeFromRoots bool
+	analyzeViews     bool
+)
 
 var analyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "Analyze FK dependency graph and output structure",
 	Long:  `Connects to the database, introspects the schema, builds an FK dependency graph, and outputs it in the specified format.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+		ctx := cmd.Context()
 
 		pool, err := db.NewPool(ctx, &cfg.Connection)
 		if err != nil {
@@ -27,25 +30,62 @@ var analyzeCmd = &cobra.Command{
 		}
 		defer pool.Close()
 
-		tables, err := schema.Introspect(ctx, pool, cfg.Schemas)
+		tables, err := introspect(ctx, pool)
 		if err != nil {
-			return fmt.Errorf("introspecting schema: %w", err)
+			return err
 		}
 
-		g := graph.Build(tables, nil, cfg.VirtualRelations)
+		g := graph.Build(tables, nil, cfg.Relations())
+		if analyzeFromRoots {
+			if g, err = pruneToRoots(g); err != nil {
+				return err
+			}
+		}
+		g.BreakCycles(cfg.BreaksCycle)
+		if analyzeViews {
+			if g.Views, err = schema.IntrospectViews(ctx, pool, cfg.Schemas); err != nil {
+				return fmt.Errorf("introspecting views: %w", err)
+			}
+		}
 
 		switch analyzeFormat {
 		case "mermaid":
 			return graph.WriteMermaid(os.Stdout, g)
 		case "text":
 			return graph.WriteText(os.Stdout, g)
+		case "suggest":
+			return graph.WriteSuggestions(os.Stdout, graph.SuggestVirtualRelations(g))
 		default:
-			return fmt.Errorf("unknown format: %s (supported: mermaid, text)", analyzeFormat)
+			return fmt.Errorf("unknown format: %s (supported: mermaid, text, suggest)", analyzeFormat)
 		}
 	},
 }
 
+// pruneToRoots restricts g to the tables reachable from the configured roots:
+// their descendants (unless direction is parents) and every table those
+// reference.
+func pruneToRoots(g *graph.Graph) (*graph.Graph, error) {
+	if len(cfg.Roots) == 0 {
+		return nil, fmt.Errorf("--from-roots requires roots in the config")
+	}
+	var childRoots, parentRoots []string
+	for _, root := range cfg.Roots {
+		key, err := resolveTable(g, root.Table)
+		if err != nil {
+			return nil, fmt.Errorf("root: %w", err)
+		}
+		if root.FollowsChildren() {
+			childRoots = append(childRoots, key)
+		} else {
+			parentRoots = append(parentRoots, key)
+		}
+	}
+	return g.Subgraph(g.Reachable(childRoots, parentRoots)), nil
+}
+
 func init() {
-	analyzeCmd.Flags().StringVar(&analyzeFormat, "format", "mermaid", "output format: mermaid or text")
+	analyzeCmd.Flags().StringVar(&analyzeFormat, "format", "mermaid", "output format: mermaid, text, or suggest")
+	analyzeCmd.Flags().BoolVar(&analyzeFromRoots, "from-roots", false, "only show tables reachable from the configured roots")
+	analyzeCmd.Flags().BoolVar(&analyzeViews, "views", false, "also show the views and materialized views reading the tables (mermaid and text)")
 	rootCmd.AddCommand(analyzeCmd)
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hurou927/db-sub-data/internal/audit"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/graph"
+)
+
+var (
+	auditIncludeNotValid bool
+	auditFailOnOrphans   bool
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report rows violating virtual relations in the live database",
+	Long:  `Connects to the database and counts child rows whose virtual relation (and optionally NOT VALID FK) values reference non-existent parent rows.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		pool, err := db.NewPool(ctx, &cfg.Connection)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer pool.Close()
+
+		tables, err := introspect(ctx, pool)
+		if err != nil {
+			return err
+		}
+
+		g := graph.Build(tables, nil, cfg.Relations())
+
+		fks := audit.Relations(g, auditIncludeNotValid)
+		if len(fks) == 0 {
+			fmt.Fprintln(os.Stdout, "No relations to audit.")
+			return nil
+		}
+
+		results, err := audit.Run(ctx, pool, fks)
+		if err != nil {
+			return err
+		}
+
+		total := audit.WriteReport(os.Stdout, results)
+		if auditFailOnOrphans && total > 0 {
+			return fmt.Errorf("found %d orphaned rows", total)
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().BoolVar(&auditIncludeNotValid, "include-not-valid", false, "also check FK constraints created with NOT VALID")
+	auditCmd.Flags().BoolVar(&auditFailOnOrphans, "fail-on-orphans", false, "exit with an error when orphaned rows are found")
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+var configOffline bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Config file utilities",
+	// Subcommands load the config themselves
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return openQueryLog() },
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate a config file against its schema and the live database",
+	Long: `Reports every unknown field, type error and invalid value of the config with
+its YAML line, then connects to the database and reports roots, excluded
+tables, table settings, virtual relations, fk_rules and masks referring to
+tables, columns or constraints that do not exist, and roots that are also
+excluded.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgPath == "" {
+			return fmt.Errorf("--config is required")
+		}
+		c, doc, problems, err := config.Check(cfgPath, cfgProfile)
+		if err != nil {
+			return err
+		}
+
+		// Schema checks need a usable connection
+		if c != nil && doc != nil && !configOffline && len(problems) == 0 {
+			setReadOnly(c)
+			schemaProblems, err := checkConfigSchema(cmd.Context(), c, doc)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, schemaProblems...)
+		}
+
+		for _, p := range problems {
+			if p.Line > 0 {
+				fmt.Printf("%s:%d: %s\n", cfgPath, p.Line, p.Message)
+			} else {
+				fmt.Printf("%s: %s\n", cfgPath, p.Message)
+			}
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d problems found in %s", len(problems), cfgPath)
+		}
+		fmt.Fprintf(os.Stderr, "%s is valid\n", cfgPath)
+		return nil
+	},
+}
+
+func checkConfigSchema(ctx context.Context, c *config.Config, doc *config.Document) ([]config.Problem, error) {
+	pool, err := db.NewPool(ctx, &c.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	defer pool.Close()
+
+	tables, err := schema.Introspect(ctx, pool, c.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("introspecting schema: %w", err)
+	}
+	if c.Inheritance == config.InheritanceParent {
+		schema.MergeInherited(tables)
+	}
+	// Adds the virtual relations to the tables, so fk_rules can refer to them
+	graph.Build(tables, nil, c.Relations())
+	return c.CheckSchema(doc, tables), nil
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVar(&configOffline, "offline", false, "only check the file, without connecting to the database")
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
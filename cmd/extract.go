@@ -1,103 +1,643 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/spf13/cobra"
 
+	"github.com/hurou927/db-sub-data/internal/checksum"
+	"github.com/hurou927/db-sub-data/internal/config"
 	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/encrypt"
 	"github.com/hurou927/db-sub-data/internal/extract"
+	"github.com/hurou927/db-sub-data/internal/golden"
 	"github.com/hurou927/db-sub-data/internal/graph"
-	"github.com/hurou927/db-sub-data/internal/schema"
+	"github.com/hurou927/db-sub-data/internal/metrics"
+	"github.com/hurou927/db-sub-data/internal/objstore"
+	"github.com/hurou927/db-sub-data/internal/output"
 )
 
 var (
-	outputPath string
-	dryRun     bool
-	verbose    bool
+	outputPath   string
+	dryRun       bool
+	explain      bool
+	verbose      bool
+	verifySource bool
+	skipClosure  bool
+	rawText      bool
+	newline      string
+	encoding     string
+	outputFormat string
+	copyFormat   string
+	truncate     bool
+	noTriggers   bool
+	utc          bool
+	overriding   bool
+	ddl          bool
+	withTypes    bool
+	strictPK     bool
+	spillKeys    int
+	spillDir     string
+	maxEstimated int64
+	failEmpty    bool
+	assumeYes    bool
+	updateGolden string
+	checkGolden  string
+	rootSpecs    []string
+	varSpecs     []string
+	reportPath   string
+	quiet        bool
+	compress     string
+	outputDir    string
+	maxFileSize  string
+	recipients   []string
+	checksums    bool
+	signKey      string
+
+	// encryptTo encrypts the output for --encrypt-recipient, if set
+	encryptTo *encrypt.Recipients
+
+	metricsListen string
+	metricsLinger time.Duration
+	metricsPush   string
+	metricsJob    string
 )
 
 var extractCmd = &cobra.Command{
 	Use:   "extract",
 	Short: "Extract a data subset preserving FK dependencies",
 	Long:  `Extracts data starting from root tables, following FK dependencies in topological order, and outputs in pg_dump-compatible COPY format.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
 
-		pool, err := db.NewPool(ctx, &cfg.Connection)
+		if updateGolden != "" && checkGolden != "" {
+			return fmt.Errorf("--update-golden and --check-golden are mutually exclusive")
+		}
+		if explain && !dryRun {
+			return fmt.Errorf("--explain requires --dry-run")
+		}
+		if reportPath != "" && dryRun {
+			return fmt.Errorf("--report cannot be used with --dry-run")
+		}
+		if err := output.ValidateCompression(compress); err != nil {
+			return fmt.Errorf("--compress: %w", err)
+		}
+		if compress != "" && dryRun {
+			return fmt.Errorf("--compress cannot be used with --dry-run")
+		}
+		if (outputFormat == output.FormatCSV || outputFormat == output.FormatJSONL) && outputDir == "" {
+			return fmt.Errorf("--format %s writes a file per table and requires --output-dir", outputFormat)
+		}
+		if outputDir != "" {
+			switch {
+			case outputPath != "":
+				return fmt.Errorf("--output-dir and --output are mutually exclusive")
+			case dryRun:
+				return fmt.Errorf("--output-dir cannot be used with --dry-run")
+			case compress != "":
+				return fmt.Errorf("--output-dir cannot be used with --compress")
+			case updateGolden != "" || checkGolden != "":
+				return fmt.Errorf("--output-dir cannot be used with --update-golden or --check-golden")
+			case objstore.IsURL(outputDir):
+				return fmt.Errorf("--output-dir must be a local directory")
+			}
+		}
+
+		m, err := startMetrics()
+		if err != nil {
+			return err
+		}
+		var extractor *extract.Extractor
+		if m != nil {
+			defer func() { finishMetrics(m, extractor, err) }()
+		}
+
+		if len(recipients) > 0 {
+			if dryRun || outputDir != "" || updateGolden != "" || checkGolden != "" {
+				return fmt.Errorf("--encrypt-recipient cannot be used with --dry-run, --output-dir, --update-golden or --check-golden")
+			}
+			encryptTo, err = encrypt.ParseRecipients(recipients)
+			if err != nil {
+				return fmt.Errorf("--encrypt-recipient: %w", err)
+			}
+		}
+
+		if signKey != "" {
+			checksums = true
+		}
+		if checksums && (dryRun || updateGolden != "" || checkGolden != "") {
+			return fmt.Errorf("--checksum and --sign-key cannot be used with --dry-run, --update-golden or --check-golden")
+		}
+
+		var maxSize int64
+		if maxFileSize != "" {
+			size, err := config.ParseByteSize(maxFileSize)
+			if err != nil || size == 0 {
+				return fmt.Errorf("--max-file-size: invalid size %q", maxFileSize)
+			}
+			if dryRun || outputDir != "" || updateGolden != "" || checkGolden != "" {
+				return fmt.Errorf("--max-file-size cannot be used with --dry-run, --output-dir, --update-golden or --check-golden")
+			}
+			maxSize = int64(size)
+		}
+
+		outputOpts := output.Options{
+			Newline:               newline,
+			Encoding:              encoding,
+			Format:                outputFormat,
+			CopyFormat:            copyFormat,
+			Truncate:              truncate,
+			DisableTriggers:       noTriggers,
+			UTC:                   utc,
+			OverridingSystemValue: overriding,
+		}
+		if err := outputOpts.Validate(); err != nil {
+			return err
+		}
+		if copyFormat != output.CopyText && outputFormat != output.FormatCopy {
+			return fmt.Errorf("--copy-format applies to --format %s only", output.FormatCopy)
+		}
+		if overriding && outputFormat != output.FormatUpsert {
+			return fmt.Errorf("--overriding-system-value applies to --format %s only", output.FormatUpsert)
+		}
+		if copyFormat == output.CopyBinary && rawText {
+			return fmt.Errorf("--raw-text cannot be used with --copy-format binary, which writes raw binary values")
+		}
+		if copyFormat == output.CopyBinary && (updateGolden != "" || checkGolden != "") {
+			return fmt.Errorf("--copy-format binary cannot be used with --update-golden or --check-golden")
+		}
+
+		if len(rootSpecs) > 0 {
+			roots := make([]config.Root, len(rootSpecs))
+			for i, spec := range rootSpecs {
+				root, err := config.ParseRoot(spec)
+				if err != nil {
+					return fmt.Errorf("--root: %w", err)
+				}
+				roots[i] = root
+			}
+			cfg.OverrideRoots(roots)
+		}
+		vars, err := config.ParseVars(varSpecs)
+		if err != nil {
+			return fmt.Errorf("--var: %w", err)
+		}
+		if err := cfg.SubstituteVars(vars); err != nil {
+			return err
+		}
+
+		conn := &cfg.Connection
+		if cfg.Replica != nil {
+			conn = &cfg.Replica.Connection
+		}
+		// --raw-text timestamps are formatted in the session time zone
+		conn.UTC = utc
+
+		pool, err := db.NewPool(ctx, conn)
 		if err != nil {
 			return fmt.Errorf("connecting to database: %w", err)
 		}
 		defer pool.Close()
 
+		if cfg.Replica != nil {
+			if err := checkReplicaLag(ctx, pool); err != nil {
+				return err
+			}
+		}
+
 		if err := cfg.ValidateForExtract(); err != nil {
 			return err
 		}
 
-		tables, err := schema.Introspect(ctx, pool, cfg.Schemas)
+		// SQL_ASCII databases store bytes without validation, so the server
+		// cannot convert them to UTF8 reliably.
+		serverEnc, err := db.ServerEncoding(ctx, pool)
 		if err != nil {
-			return fmt.Errorf("introspecting schema: %w", err)
+			return err
+		}
+		if serverEnc == "SQL_ASCII" {
+			fmt.Fprintln(os.Stderr, "WARNING: source server_encoding is SQL_ASCII; non-ASCII bytes are passed through unvalidated and may not load into a UTF8 target")
+		}
+
+		tables, err := introspect(ctx, pool)
+		if err != nil {
+			return err
 		}
 
-		g := graph.Build(tables, cfg.ExcludeSet(), cfg.VirtualRelations)
+		g := graph.Build(tables, cfg.ExcludeSet(tables), cfg.Relations())
 
 		// Validate that all root tables exist in the graph
 		for _, root := range cfg.Roots {
-			found := false
-			for _, tbl := range g.Tables {
-				if tbl.Name == root.Table {
-					found = true
-					break
-				}
+			if err := extract.CheckRoot(g, root); err != nil {
+				return err
 			}
-			if !found {
-				return fmt.Errorf("root table %q not found in schema", root.Table)
+		}
+
+		opts := extract.Options{
+			Verbose:         verbose,
+			DryRun:          dryRun,
+			Explain:         explain,
+			VerifySource:    verifySource,
+			SkipClosure:     skipClosure,
+			RawText:         rawText,
+			DDL:             ddl,
+			Types:           withTypes,
+			StrictPK:        strictPK,
+			FailOnEmptyRoot: failEmpty,
+			SpillKeys:       spillKeys,
+			SpillDir:        spillDir,
+			Output:          outputOpts,
+		}
+		// --verbose prints its own progress to stdout
+		if !quiet && !verbose {
+			opts.Progress = os.Stderr
+		}
+		extractor = extract.New(pool, cfg, g, opts)
+
+		if maxEstimated > 0 && !dryRun {
+			if err := checkEstimate(ctx, extractor); err != nil {
+				return err
 			}
 		}
 
-		extractor := extract.New(pool, cfg, g, verbose, dryRun)
+		if updateGolden != "" || checkGolden != "" {
+			gw := golden.NewWriter(updateGolden+checkGolden, checkGolden != "", os.Stdout)
+			if err := extractor.ExtractTo(ctx, gw); err != nil {
+				return err
+			}
+			return writeReport(extractor)
+		}
+
+		if outputDir != "" {
+			if err := extractToDir(ctx, extractor, outputOpts); err != nil {
+				return err
+			}
+			return finishExtract(extractor, outputDir)
+		}
 
 		// Determine output destination
 		outPath := outputPath
 		if outPath == "" {
 			outPath = cfg.Output
 		}
+		if checksums && (outPath == "" || outPath == "-") {
+			return fmt.Errorf("--checksum requires an output file")
+		}
 
-		var w *os.File
-		if dryRun || outPath == "" || outPath == "-" {
-			w = os.Stdout
-		} else {
-			w, err = os.Create(outPath)
+		if maxSize > 0 {
+			if outPath == "" || outPath == "-" {
+				return fmt.Errorf("--max-file-size requires an output file")
+			}
+			paths, err := extractParts(ctx, extractor, outPath, maxSize, outputOpts)
 			if err != nil {
-				return fmt.Errorf("creating output file: %w", err)
+				return err
+			}
+			return finishExtract(extractor, paths...)
+		}
+
+		if dryRun {
+			outPath = "-"
+		}
+		out, err := createOutput(ctx, outPath)
+		if err != nil {
+			return err
+		}
+		if err := extractor.Extract(ctx, out); err != nil {
+			printIncomplete(ctx, extractor, out.abort())
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		if err := out.publish(); err != nil {
+			return err
+		}
+		if checksums {
+			entries := []checksum.Entry{{Name: filepath.Base(outPath), SHA256: out.checksum()}}
+			if err := writeManifest(ctx, outPath+checksum.Ext, entries); err != nil {
+				return err
 			}
-			defer w.Close()
 		}
+		return finishExtract(extractor, outPath)
+	},
+}
+
+// checkEstimate asks the planner for the size of the extraction before it
+// starts and, above --max-estimated-rows, asks for confirmation on a
+// terminal (unless --yes) or fails.
+func checkEstimate(ctx context.Context, extractor *extract.Extractor) error {
+	est, err := extractor.Estimate(ctx)
+	if err != nil {
+		return fmt.Errorf("estimating the extraction: %w", err)
+	}
+	if est.Rows <= float64(maxEstimated) {
+		return nil
+	}
+	msg := fmt.Sprintf("the extraction is estimated at ~%.0f rows (~%s) in %d tables, more than --max-estimated-rows %d",
+		est.Rows, config.ByteSize(est.Bytes), est.Tables, maxEstimated)
+	if assumeYes {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", msg)
+		return nil
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s; narrow the roots or rerun with --yes", msg)
+	}
+	fmt.Fprintf(os.Stderr, "%s.\nContinue? [y/N] ", msg)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("extraction aborted")
+}
+
+// extractToDir writes the extraction into --output-dir. Like a file, the
+// directory is built under a temporary name and swapped in when complete.
+func extractToDir(ctx context.Context, extractor *extract.Extractor, opts output.Options) error {
+	dir := strings.TrimRight(outputDir, "/")
+	partial := dir + ".incomplete"
+	if err := os.RemoveAll(partial); err != nil {
+		return fmt.Errorf("removing incomplete output directory: %w", err)
+	}
+	if err := os.MkdirAll(partial, 0o755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	dw, err := output.NewDirWriter(partial, opts)
+	if err != nil {
+		return err
+	}
+	if err := extractor.ExtractTo(ctx, dw); err != nil {
+		dw.Close()
+		printIncomplete(ctx, extractor, partial)
+		return err
+	}
 
-		if err := extractor.Extract(ctx, w); err != nil {
+	if checksums {
+		if err := writeDirManifest(ctx, partial); err != nil {
 			return err
 		}
+	}
+
+	// A previous extraction is replaced; any other directory is kept
+	if _, err := os.Stat(filepath.Join(dir, output.RestoreScript)); err == nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("removing previous output directory: %w", err)
+		}
+	}
+	if err := os.Rename(partial, dir); err != nil {
+		return fmt.Errorf("renaming output directory (it must be empty or a previous --output-dir): %w", err)
+	}
+	return nil
+}
+
+// writeDirManifest writes the checksums of the files of an --output-dir
+// directory, which are the per-table blocks and the restore script.
+func writeDirManifest(ctx context.Context, dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var entries []checksum.Entry
+	for _, f := range files {
+		sum, err := checksum.File(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return fmt.Errorf("computing checksums: %w", err)
+		}
+		entries = append(entries, checksum.Entry{Name: f.Name(), SHA256: sum})
+	}
+	return writeManifest(ctx, filepath.Join(dir, checksum.DirManifest), entries)
+}
+
+// extractParts writes the extraction into numbered parts of at most maxSize
+// bytes next to outPath. Local parts are written under temporary names and
+// renamed when all are complete; parts left from a previous, longer
+// extraction are removed.
+func extractParts(ctx context.Context, extractor *extract.Extractor, outPath string, maxSize int64, opts output.Options) ([]string, error) {
+	var parts []*outputFile
+	open := func(n int) (io.WriteCloser, error) {
+		part, err := createOutput(ctx, output.PartPath(outPath, n))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		return part, nil
+	}
+	sw, err := output.NewSplitWriter(open, maxSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := extractor.ExtractTo(ctx, sw); err != nil {
+		var incomplete []string
+		for _, part := range parts {
+			if path := part.abort(); path != "" {
+				incomplete = append(incomplete, path)
+			}
+		}
+		printIncomplete(ctx, extractor, strings.Join(incomplete, ", "))
+		return nil, err
+	}
 
-		if !dryRun {
-			summary := extractor.CollectedSummary()
-			fmt.Fprintln(os.Stderr, "Extraction complete:")
-			for _, line := range summary {
-				fmt.Fprintln(os.Stderr, line)
+	paths := make([]string, len(parts))
+	var entries []checksum.Entry
+	for i, part := range parts {
+		if err := part.publish(); err != nil {
+			return nil, err
+		}
+		paths[i] = part.path
+		if checksums {
+			entries = append(entries, checksum.Entry{Name: filepath.Base(part.path), SHA256: part.checksum()})
+		}
+	}
+	if checksums {
+		// one manifest for all the parts, at the unsplit path
+		if err := writeManifest(ctx, outPath+checksum.Ext, entries); err != nil {
+			return nil, err
+		}
+	}
+	if !objstore.IsURL(outPath) {
+		for n := len(parts) + 1; ; n++ {
+			if err := os.Remove(output.PartPath(outPath, n)); err != nil {
+				break
 			}
+		}
+	}
+	return paths, nil
+}
+
+// printIncomplete tells what was collected when an extraction is interrupted
+// and where its partial output is.
+func printIncomplete(ctx context.Context, extractor *extract.Extractor, partialPath string) {
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Extraction interrupted, collected so far:")
+		for _, line := range extractor.CollectedSummary() {
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+	if partialPath != "" {
+		fmt.Fprintf(os.Stderr, "Incomplete output left in: %s\n", partialPath)
+	}
+}
+
+// finishExtract writes the report and prints the summary of a completed
+// extraction written to outPaths.
+func finishExtract(extractor *extract.Extractor, outPaths ...string) error {
+	if err := writeReport(extractor); err != nil {
+		return err
+	}
+
+	if !dryRun && !quiet {
+		summary := extractor.CollectedSummary()
+		fmt.Fprintln(os.Stderr, "Extraction complete:")
+		for _, line := range summary {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		for _, outPath := range outPaths {
 			if outPath != "" && outPath != "-" {
 				fmt.Fprintf(os.Stderr, "Output written to: %s\n", outPath)
 			}
 		}
+	}
+	return nil
+}
+
+// writeReport writes the extraction report to --report, if set.
+func writeReport(extractor *extract.Extractor) error {
+	if reportPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(extractor.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportPath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// metricsServer serves --metrics-listen while the extraction runs.
+var metricsServer *http.Server
+
+// startMetrics starts collecting the query metrics if --metrics-listen or
+// --metrics-push is set, and serves them on --metrics-listen.
+func startMetrics() (*metrics.Metrics, error) {
+	if metricsListen == "" && metricsPush == "" {
+		return nil, nil
+	}
+	m := metrics.New()
+	if metricsListen != "" {
+		srv, err := m.Serve(metricsListen)
+		if err != nil {
+			return nil, err
+		}
+		metricsServer = srv
+	}
+	db.AddTracer(m)
+	return m, nil
+}
+
+// finishMetrics records the outcome of the extraction, pushes the metrics to
+// --metrics-push and keeps serving them for --metrics-linger so the final
+// values can be scraped. Failing to export is a warning, not a failure of
+// the extraction.
+func finishMetrics(m *metrics.Metrics, extractor *extract.Extractor, err error) {
+	var report *extract.Report
+	if extractor != nil {
+		r := extractor.Report()
+		report = &r
+	}
+	m.Finish(report, err)
+
+	if metricsPush != "" {
+		// The command's context may already be cancelled by a signal.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := m.Push(ctx, metricsPush, metricsJob); err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING:", err)
+		}
+	}
+	if metricsServer != nil {
+		if metricsLinger > 0 {
+			fmt.Fprintf(os.Stderr, "Serving metrics on %s for %s\n", metricsListen, metricsLinger)
+			time.Sleep(metricsLinger)
+		}
+		metricsServer.Close()
+	}
+}
 
+// checkReplicaLag verifies the replica is a standby within the configured max lag.
+func checkReplicaLag(ctx context.Context, pool *pgxpool.Pool) error {
+	lag, inRecovery, err := db.ReplicationLag(ctx, pool)
+	if err != nil {
+		return err
+	}
+	if !inRecovery {
+		fmt.Fprintf(os.Stderr, "WARNING: replica %s is not in recovery (not a standby)\n", cfg.Replica.Host)
 		return nil
-	},
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Replica lag: %s\n", lag.Round(time.Millisecond))
+	}
+	if cfg.Replica.MaxLagDuration == 0 || lag <= cfg.Replica.MaxLagDuration {
+		return nil
+	}
+	msg := fmt.Sprintf("replica %s is %s behind (max_lag: %s)", cfg.Replica.Host, lag.Round(time.Millisecond), cfg.Replica.MaxLag)
+	if cfg.Replica.OnLag == "warn" {
+		fmt.Fprintln(os.Stderr, "WARNING: "+msg)
+		return nil
+	}
+	return fmt.Errorf("%s", msg)
 }
 
 func init() {
 	extractCmd.Flags().StringVar(&outputPath, "output", "", "output file path (overrides config)")
 	extractCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show queries without executing")
+	extractCmd.Flags().BoolVar(&explain, "explain", false, "with --dry-run, report EXPLAIN row and cost estimates per table")
+	extractCmd.Flags().Int64Var(&maxEstimated, "max-estimated-rows", 0, "estimate the rows to extract with EXPLAIN first and, above this many, ask for confirmation (fail when not on a terminal); 0 = no estimate")
+	extractCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "continue without confirmation when --max-estimated-rows is exceeded")
 	extractCmd.Flags().BoolVar(&verbose, "verbose", false, "show detailed progress")
+	extractCmd.Flags().BoolVar(&quiet, "quiet", false, "do not show the progress and the summary on stderr")
+	extractCmd.Flags().StringVar(&outputDir, "output-dir", "", "write one file per table and a restore.sql including them in order into this directory")
+	extractCmd.Flags().StringVar(&maxFileSize, "max-file-size", "", "split the output into numbered parts of at most this size (e.g. 1GB), each applied in its own transaction")
+	extractCmd.Flags().StringArrayVar(&recipients, "encrypt-recipient", nil, "encrypt the output for this age key (age1...), SSH key, key file or gpg key ID/email (repeatable)")
+	extractCmd.Flags().BoolVar(&checksums, "checksum", false, "write the SHA-256 of each output file to <output>.sha256 (SHA256SUMS with --output-dir), checkable with sha256sum -c")
+	extractCmd.Flags().StringVar(&signKey, "sign-key", "", "sign the checksums with this armored OpenPGP secret key into <manifest>.asc (implies --checksum; passphrase from $DB_SUB_DATA_SIGN_PASSPHRASE)")
+	extractCmd.Flags().StringVar(&compress, "compress", "", "compress the output: gzip, zstd or none (default: inferred from a .gz or .zst output path)")
+	extractCmd.Flags().StringVar(&newline, "newline", "lf", "output line terminator: lf or crlf")
+	extractCmd.Flags().StringVar(&encoding, "encoding", output.DefaultEncoding, "output client_encoding (e.g. UTF8, LATIN1, SJIS, EUC_JP)")
+	extractCmd.Flags().StringVar(&outputFormat, "format", output.FormatCopy, "output format: copy, upsert (INSERT ... ON CONFLICT), or csv or jsonl (with --output-dir)")
+	extractCmd.Flags().StringVar(&copyFormat, "copy-format", output.CopyText, "format of the COPY blocks: text, csv (COPY ... WITH (FORMAT csv)) or binary (raw wire values, loadable with load only)")
+	extractCmd.Flags().BoolVar(&rawText, "raw-text", false, "fetch column values as text and write them as the server sends them, with only the output format's escaping")
+	extractCmd.Flags().BoolVar(&ddl, "ddl", false, "emit CREATE TABLE, constraint and index DDL of the extracted tables and their types before the data")
+	extractCmd.Flags().BoolVar(&withTypes, "with-types", false, "emit CREATE TYPE and CREATE DOMAIN statements for the enum, domain and composite types of the extracted columns before the data (implied by --ddl)")
+	extractCmd.Flags().BoolVar(&truncate, "truncate", false, "emit TRUNCATE ... CASCADE of all tables in scope before the data")
+	extractCmd.Flags().BoolVar(&noTriggers, "disable-triggers", false, "wrap the rows of each table in ALTER TABLE ... DISABLE/ENABLE TRIGGER USER instead of setting session_replication_role (FK checks stay on)")
+	extractCmd.Flags().BoolVar(&overriding, "overriding-system-value", false, "write the INSERTs of tables with GENERATED ALWAYS identity columns with OVERRIDING SYSTEM VALUE (--format upsert)")
+	extractCmd.Flags().BoolVar(&utc, "utc", false, "write timestamptz values in UTC and emit SET TIME ZONE 'UTC' in the header")
+	extractCmd.Flags().StringVar(&updateGolden, "update-golden", "", "write normalized per-table fixtures into this directory instead of output")
+	extractCmd.Flags().StringVar(&checkGolden, "check-golden", "", "compare the extract against fixtures in this directory and fail on changes")
+	extractCmd.Flags().BoolVar(&strictPK, "strict-pk", false, "fail if a table in scope has no primary key, instead of identifying its rows by a unique key")
+	extractCmd.Flags().BoolVar(&failEmpty, "fail-on-empty-root", false, "fail if the query of a root matches no rows, instead of warning")
+	extractCmd.Flags().IntVar(&spillKeys, "spill-keys", 0, "keep at most this many collected keys per table in memory and spill the rest to temporary files (0 = keep all in memory)")
+	extractCmd.Flags().StringVar(&spillDir, "spill-dir", "", "directory for the files of --spill-keys (default: the system temporary directory)")
+	extractCmd.Flags().BoolVar(&skipClosure, "skip-closure", false, "do not fetch parent rows referenced by collected rows but missed by the traversal")
+	extractCmd.Flags().StringArrayVar(&rootSpecs, "root", nil, `root as "table:where" (repeatable); replaces the where of a configured root of the same table, or adds a root`)
+	extractCmd.Flags().StringArrayVar(&varSpecs, "var", nil, "value of a :name placeholder in root where clauses as name=value (repeatable); defaults to $NAME")
+	extractCmd.Flags().StringVar(&reportPath, "report", "", "write a JSON report with per-table rows, bytes, queries, durations, followed FKs, warnings and the config hash")
+	extractCmd.Flags().StringVar(&metricsListen, "metrics-listen", "", "serve Prometheus metrics on http://<addr>/metrics while extracting (e.g. :9102)")
+	extractCmd.Flags().DurationVar(&metricsLinger, "metrics-linger", 0, "with --metrics-listen, keep serving the final metrics this long after the extraction")
+	extractCmd.Flags().StringVar(&metricsPush, "metrics-push", "", "push the metrics to this Prometheus Pushgateway URL when the extraction ends")
+	extractCmd.Flags().StringVar(&metricsJob, "metrics-job", "db-sub-data", "job name of the pushed metrics")
+	extractCmd.Flags().BoolVar(&verifySource, "verify-source", false, "verify every collected FK reference against the source before writing output")
 	rootCmd.AddCommand(extractCmd)
 }
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+var (
+	initOutput    string
+	initForce     bool
+	initConn      config.Connection
+	initSchemas   []string
+	initLargeRows int64
+	initLargeSize string
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a starter config from a live database",
+	Long: `Connects to the database (flags, falling back to PG* environment variables),
+introspects it, and writes a starter YAML config with the connection, the
+detected schemas, candidate root tables and large tables suggested for
+exclude_tables (as comments to review).`,
+	// The config does not exist yet
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return openQueryLog() },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		largeBytes, err := config.ParseByteSize(initLargeSize)
+		if err != nil {
+			return fmt.Errorf("--large-size: %w", err)
+		}
+		if initOutput != "-" && !initForce {
+			if _, err := os.Stat(initOutput); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", initOutput)
+			}
+		}
+
+		c, err := config.FromConnection(initConn, initSchemas)
+		if err != nil {
+			return err
+		}
+
+		setReadOnly(c)
+		pool, err := db.NewPool(ctx, &c.Connection)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer pool.Close()
+
+		schemas := initSchemas
+		if len(schemas) == 0 {
+			if schemas, err = schema.UserSchemas(ctx, pool); err != nil {
+				return fmt.Errorf("listing schemas: %w", err)
+			}
+			if len(schemas) == 0 {
+				schemas = c.Schemas
+			}
+		}
+
+		tables, err := schema.Introspect(ctx, pool, schemas)
+		if err != nil {
+			return fmt.Errorf("introspecting schema: %w", err)
+		}
+		stats, err := schema.TableStats(ctx, pool, schemas)
+		if err != nil {
+			return fmt.Errorf("querying table sizes: %w", err)
+		}
+
+		starter := config.Starter{
+			Connection: c.Connection,
+			Schemas:    schemas,
+		}
+		g := graph.Build(tables, nil, nil)
+		roots := g.Roots()
+		sort.Strings(roots)
+		for _, name := range roots {
+			starter.Roots = append(starter.Roots, starterTable(tables, g.Tables[name], stats))
+		}
+		names := make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			st := stats[name]
+			if st.Rows >= initLargeRows || config.ByteSize(st.Bytes) >= largeBytes {
+				starter.Large = append(starter.Large, starterTable(tables, tables[name], stats))
+			}
+		}
+
+		var w io.Writer = os.Stdout
+		if initOutput != "-" {
+			f, err := os.Create(initOutput)
+			if err != nil {
+				return fmt.Errorf("creating config file: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := config.WriteStarter(w, starter); err != nil {
+			return fmt.Errorf("writing config: %w", err)
+		}
+		if initOutput != "-" {
+			fmt.Fprintf(os.Stderr, "Wrote %s: %d tables in %s, %d root candidates, %d large tables\n",
+				initOutput, len(tables), strings.Join(schemas, ", "), len(starter.Roots), len(starter.Large))
+		}
+		return nil
+	},
+}
+
+func starterTable(tables map[string]*schema.Table, tbl *schema.Table, stats map[string]schema.TableStat) config.StarterTable {
+	st := stats[tbl.FullName()]
+	return config.StarterTable{Name: config.TableName(tables, tbl), Table: tbl.FullName(), Rows: st.Rows, Bytes: config.ByteSize(st.Bytes)}
+}
+
+func init() {
+	initCmd.Flags().StringVar(&initOutput, "output", "config.yaml", `config file to write ("-" for stdout)`)
+	initCmd.Flags().BoolVar(&initForce, "force", false, "overwrite an existing config file")
+	initCmd.Flags().StringVar(&initConn.Host, "host", "", "database host (default $PGHOST)")
+	initCmd.Flags().IntVar(&initConn.Port, "port", 0, "database port (default $PGPORT or 5432)")
+	initCmd.Flags().StringVar(&initConn.Database, "database", "", "database name (default $PGDATABASE)")
+	initCmd.Flags().StringVar(&initConn.User, "user", "", "database user (default $PGUSER)")
+	initCmd.Flags().StringVar(&initConn.SSLMode, "sslmode", "", "sslmode (default $PGSSLMODE or disable)")
+	initCmd.Flags().StringSliceVar(&initSchemas, "schemas", nil, "schemas to include (default: all non-system schemas with tables)")
+	initCmd.Flags().Int64Var(&initLargeRows, "large-rows", 1_000_000, "suggest tables with at least this many estimated rows for exclude_tables")
+	initCmd.Flags().StringVar(&initLargeSize, "large-size", "1GiB", "suggest tables at least this large for exclude_tables")
+	rootCmd.AddCommand(initCmd)
+}
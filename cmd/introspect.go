@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// introspect returns the tables of the config's schemas, with the tables
+// inheriting from others merged into them under inheritance: parent, and
+// checks that the config's table names are not ambiguous.
+func introspect(ctx context.Context, pool schema.Querier) (map[string]*schema.Table, error) {
+	tables, err := schema.Introspect(ctx, pool, cfg.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("introspecting schema: %w", err)
+	}
+	if cfg.Inheritance == config.InheritanceParent {
+		schema.MergeInherited(tables)
+	}
+	if err := cfg.CheckTableNames(tables); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
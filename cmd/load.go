@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/hurou927/db-sub-data/internal/checksum"
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/load"
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+var (
+	loadTarget      string
+	loadCommitEvery int64
+	loadPerTable    bool
+	loadStateFile   string
+	loadResume      bool
+	loadVerbose     bool
+	loadAllowDrift  bool
+	loadChecksums   string
+)
+
+var loadCmd = &cobra.Command{
+	Use:   "load [file]",
+	Short: "Apply an extracted subset to a target database",
+	Long: `Reads a subset produced by extract (from a file, or stdin when the file is
+omitted or "-") and applies it to the database of the --target config (default:
+--config) using COPY inside transactions, with session_replication_role set to
+replica so FK triggers do not fire (unless the subset defers its constraints and
+is loaded in a single transaction).
+By default the whole file is loaded in a single transaction. With --commit-every or
+--per-table the load is committed in chunks and its progress recorded in a state file,
+so a failed load can continue with --resume instead of starting over.`,
+	Args: cobra.MaximumNArgs(1),
+	// Overrides the root hook: the connection comes from --target, falling back to --config,
+	// with --profile applied to either.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if readOnly {
+			return fmt.Errorf("load writes to the database and cannot run with --read-only")
+		}
+		if err := openQueryLog(); err != nil {
+			return err
+		}
+		path := loadTarget
+		if path == "" {
+			path = cfgPath
+		}
+		if path == "" {
+			return fmt.Errorf("--target or --config is required")
+		}
+		var err error
+		cfg, err = config.LoadProfile(path, cfgProfile)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		path := "-"
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		if loadChecksums != "" {
+			if err := verifyChecksums(loadChecksums, path); err != nil {
+				return err
+			}
+		}
+
+		var in io.Reader = os.Stdin
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			// an extract --output-dir directory
+			d, err := output.OpenDir(path)
+			if err != nil {
+				return fmt.Errorf("opening input: %w", err)
+			}
+			defer d.Close()
+			in = d
+		} else if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("opening input: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		// gzip and zstd dumps (extract --compress) are detected by their header
+		rc, err := output.Decompress(in)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		in = rc
+
+		conn, err := db.Connect(ctx, &cfg.Connection)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer conn.Close(ctx)
+
+		stateFile := loadStateFile
+		if stateFile == "" && (loadCommitEvery > 0 || loadPerTable || loadResume) {
+			if path == "-" {
+				return fmt.Errorf("--state-file is required for chunked loads from stdin")
+			}
+			stateFile = path + ".load-state"
+		}
+
+		stats, err := load.Apply(ctx, conn, in, load.Options{
+			CommitEvery: loadCommitEvery,
+			PerTable:    loadPerTable,
+			StateFile:   stateFile,
+			Resume:      loadResume,
+			Verbose:     loadVerbose,
+			CheckSchema: func(ctx context.Context, fingerprint string, tables []string) error {
+				return checkSchemaDrift(ctx, conn, fingerprint, tables)
+			},
+		})
+		if err != nil {
+			if stateFile != "" && stats.Commits > 0 {
+				fmt.Fprintf(os.Stderr, "Load failed after %d commits; rerun with --resume to continue (state: %s)\n", stats.Commits, stateFile)
+			}
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Load complete: %d tables, %d rows, %d commits\n", stats.Tables, stats.Rows, stats.Commits)
+		return nil
+	},
+}
+
+// verifyChecksums checks the input against a manifest of extract
+// --checksum: a file against its entry, a directory against all entries.
+func verifyChecksums(manifestPath, path string) error {
+	if path == "-" {
+		return fmt.Errorf("--checksums cannot verify stdin")
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("reading checksums: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		err = checksum.Verify(manifest, path)
+	} else {
+		err = checksum.Verify(manifest, filepath.Dir(path), filepath.Base(path))
+	}
+	if err != nil {
+		return fmt.Errorf("verifying checksums: %w", err)
+	}
+	if loadVerbose {
+		fmt.Fprintln(os.Stderr, "Checksums match "+manifestPath)
+	}
+	return nil
+}
+
+// checkSchemaDrift compares the dump's source schema fingerprint with the target.
+func checkSchemaDrift(ctx context.Context, conn *pgx.Conn, fingerprint string, names []string) error {
+	schemaSet := make(map[string]bool)
+	var schemas []string
+	for _, name := range names {
+		s, _, _ := strings.Cut(name, ".")
+		if !schemaSet[s] {
+			schemaSet[s] = true
+			schemas = append(schemas, s)
+		}
+	}
+
+	all, err := schema.Introspect(ctx, conn, schemas)
+	if err != nil {
+		return fmt.Errorf("introspecting target schema: %w", err)
+	}
+
+	var tables []*schema.Table
+	var missing []string
+	for _, name := range names {
+		if tbl, ok := all[name]; ok {
+			tables = append(tables, tbl)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	var msg string
+	switch {
+	case len(missing) > 0:
+		msg = fmt.Sprintf("target schema is missing tables: %s", strings.Join(missing, ", "))
+	case schema.Fingerprint(tables) != fingerprint:
+		msg = "target schema differs from the source schema the dump was extracted from"
+	default:
+		if loadVerbose {
+			fmt.Fprintln(os.Stderr, "Schema fingerprint matches target")
+		}
+		return nil
+	}
+
+	if loadAllowDrift {
+		fmt.Fprintln(os.Stderr, "WARNING: "+msg)
+		return nil
+	}
+	return fmt.Errorf("%s (use --allow-schema-drift to load anyway)", msg)
+}
+
+func init() {
+	loadCmd.Flags().StringVar(&loadTarget, "target", "", "config file of the target database (default: --config)")
+	loadCmd.Flags().Int64Var(&loadCommitEvery, "commit-every", 0, "commit after every N rows (0 = single transaction)")
+	loadCmd.Flags().BoolVar(&loadPerTable, "per-table", false, "commit after every table")
+	loadCmd.Flags().StringVar(&loadStateFile, "state-file", "", "progress file for resuming (default: <file>.load-state)")
+	loadCmd.Flags().BoolVar(&loadResume, "resume", false, "resume from the last committed position in the state file")
+	loadCmd.Flags().BoolVar(&loadAllowDrift, "allow-schema-drift", false, "warn instead of failing when the target schema differs from the source")
+	loadCmd.Flags().StringVar(&loadChecksums, "checksums", "", "verify the input against this SHA-256 manifest of extract --checksum before loading")
+	loadCmd.Flags().BoolVar(&loadVerbose, "verbose", false, "show detailed progress")
+	rootCmd.AddCommand(loadCmd)
+}
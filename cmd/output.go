@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/hurou927/db-sub-data/internal/checksum"
+	"github.com/hurou927/db-sub-data/internal/encrypt"
+	"github.com/hurou927/db-sub-data/internal/objstore"
+	"github.com/hurou927/db-sub-data/internal/output"
+)
+
+// outputFile is an extract output being written, compressed as --compress
+// or the path's extension asks, then encrypted for --encrypt-recipient, and
+// its SHA-256 computed for --checksum. A local file is written under a
+// temporary name and renamed by publish, so a failed or interrupted
+// extraction does not leave a truncated dump (or replace a previous one) at
+// the output path. An object storage URL is uploaded as it is written; Close completes
+// the upload and abort discards it. "" or "-" is stdout.
+type outputFile struct {
+	zw      io.WriteCloser
+	ew      io.WriteCloser
+	sum     hash.Hash
+	f       *os.File
+	upload  objstore.Writer
+	path    string
+	partial string
+	closed  bool
+}
+
+func createOutput(ctx context.Context, path string) (*outputFile, error) {
+	o := &outputFile{path: path}
+	var w io.Writer
+	switch {
+	case path == "" || path == "-":
+		w = os.Stdout
+	case objstore.IsURL(path):
+		upload, err := objstore.Create(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		o.upload, w = upload, upload
+	default:
+		o.partial = path + ".incomplete"
+		f, err := os.Create(o.partial)
+		if err != nil {
+			return nil, fmt.Errorf("creating output file: %w", err)
+		}
+		o.f, w = f, f
+	}
+	if checksums {
+		o.sum = sha256.New()
+		w = io.MultiWriter(w, o.sum)
+	}
+
+	if encryptTo != nil {
+		ew, err := encryptTo.NewWriter(w)
+		if err != nil {
+			o.abort()
+			return nil, fmt.Errorf("encrypting output: %w", err)
+		}
+		o.ew, w = ew, ew
+	}
+
+	// Without --compress, a .gz or .zst output (e.g. .sql.gz.age) is compressed
+	compression := compress
+	if compression == "" && path != "" && path != "-" {
+		compression = output.CompressionFor(encrypt.TrimExt(path))
+	}
+	zw, err := output.Compress(w, compression)
+	if err != nil {
+		o.abort()
+		return nil, err
+	}
+	o.zw = zw
+	return o, nil
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	return o.zw.Write(p)
+}
+
+// Close finishes writing the output.
+func (o *outputFile) Close() error {
+	if err := o.zw.Close(); err != nil {
+		o.abort()
+		return fmt.Errorf("compressing output: %w", err)
+	}
+	if o.ew != nil {
+		if err := o.ew.Close(); err != nil {
+			o.abort()
+			return fmt.Errorf("encrypting output: %w", err)
+		}
+	}
+	switch {
+	case o.f != nil:
+		if err := o.f.Close(); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+	case o.upload != nil:
+		if err := o.upload.Close(); err != nil {
+			return fmt.Errorf("uploading %s: %w", o.path, err)
+		}
+	}
+	o.closed = true
+	return nil
+}
+
+// checksum returns the SHA-256 of the bytes written, as stored.
+func (o *outputFile) checksum() string {
+	return hex.EncodeToString(o.sum.Sum(nil))
+}
+
+// publish moves a closed local file to its path.
+func (o *outputFile) publish() error {
+	if o.partial == "" {
+		return nil
+	}
+	if err := os.Rename(o.partial, o.path); err != nil {
+		return fmt.Errorf("renaming output file: %w", err)
+	}
+	return nil
+}
+
+// abort stops writing after a failure and returns where the incomplete
+// output was left, if anywhere.
+func (o *outputFile) abort() string {
+	switch {
+	case o.f != nil:
+		o.f.Close()
+		return o.partial
+	case o.upload != nil && o.closed:
+		// the object is complete, but the output it is part of is not
+		return o.path
+	case o.upload != nil:
+		if err := o.upload.Abort(); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %v\n", o.path, err)
+		}
+	}
+	return ""
+}
+
+// writeManifest writes the checksums of the files of an extraction to path,
+// and with --sign-key its detached signature to path.asc. The manifest is
+// written last, so its presence means the output is complete.
+func writeManifest(ctx context.Context, path string, entries []checksum.Entry) error {
+	manifest := checksum.Format(entries)
+	if err := writeRaw(ctx, path, manifest); err != nil {
+		return fmt.Errorf("writing checksums: %w", err)
+	}
+	if signKey == "" {
+		return nil
+	}
+	sig, err := checksum.Sign(manifest, signKey, os.Getenv("DB_SUB_DATA_SIGN_PASSPHRASE"))
+	if err != nil {
+		return fmt.Errorf("--sign-key: %w", err)
+	}
+	if err := writeRaw(ctx, path+".asc", sig); err != nil {
+		return fmt.Errorf("writing signature: %w", err)
+	}
+	return nil
+}
+
+// writeRaw writes a small file, locally or to object storage, as is.
+func writeRaw(ctx context.Context, path string, data []byte) error {
+	if !objstore.IsURL(path) {
+		return os.WriteFile(path, data, 0o644)
+	}
+	w, err := objstore.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
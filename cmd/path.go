@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/graph"
+)
+
+var pathMaxDepth int
+
+var pathCmd = &cobra.Command{
+	Use:   "path <tableA> <tableB>",
+	Short: "Show FK paths connecting two tables",
+	Long:  `Prints every FK path (real and virtual relations, in either direction) between two tables, with constraint names and columns. Excluded tables are not traversed.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		pool, err := db.NewPool(ctx, &cfg.Connection)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer pool.Close()
+
+		tables, err := introspect(ctx, pool)
+		if err != nil {
+			return err
+		}
+
+		g := graph.Build(tables, cfg.ExcludeSet(tables), cfg.Relations())
+
+		from, err := resolveTable(g, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := resolveTable(g, args[1])
+		if err != nil {
+			return err
+		}
+
+		graph.WritePaths(os.Stdout, from, to, g.Paths(from, to, pathMaxDepth))
+		return nil
+	},
+}
+
+// resolveTable returns the full name of a schema-qualified or unqualified table.
+func resolveTable(g *graph.Graph, name string) (string, error) {
+	keys := g.TableKeys(name)
+	switch len(keys) {
+	case 0:
+		return "", fmt.Errorf("table %q not found in schema (or excluded)", name)
+	case 1:
+		return keys[0], nil
+	default:
+		sort.Strings(keys)
+		return "", fmt.Errorf("table %q is ambiguous (%s); qualify it with the schema", name, strings.Join(keys, ", "))
+	}
+}
+
+func init() {
+	pathCmd.Flags().IntVar(&pathMaxDepth, "max-depth", 6, "maximum number of FK edges per path")
+	rootCmd.AddCommand(pathCmd)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/extract"
+	"github.com/hurou927/db-sub-data/internal/graph"
+)
+
+var (
+	planFormat      string
+	planSkipClosure bool
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Output the extraction plan as JSON or YAML",
+	Long:  `Introspects the schema and outputs, without querying data, the ordered tables an extract would query, the query shapes, the FKs driving each table, and the tables skipped and why.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		if planFormat != "json" && planFormat != "yaml" {
+			return fmt.Errorf("unknown format: %s (supported: json, yaml)", planFormat)
+		}
+		if err := cfg.ValidateForExtract(); err != nil {
+			return err
+		}
+
+		pool, err := db.NewPool(ctx, &cfg.Connection)
+		if err != nil {
+			return fmt.Errorf("connecting to database: %w", err)
+		}
+		defer pool.Close()
+
+		tables, err := introspect(ctx, pool)
+		if err != nil {
+			return err
+		}
+
+		g := graph.Build(tables, cfg.ExcludeSet(tables), cfg.Relations())
+		for _, root := range cfg.Roots {
+			if err := extract.CheckRoot(g, root); err != nil {
+				return err
+			}
+		}
+
+		var excluded []string
+		for name := range g.Excluded {
+			excluded = append(excluded, name)
+		}
+		sort.Strings(excluded)
+
+		plan := extract.New(pool, cfg, g, extract.Options{SkipClosure: planSkipClosure}).Plan(excluded)
+
+		if planFormat == "yaml" {
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(plan); err != nil {
+				return err
+			}
+			return enc.Close()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVar(&planFormat, "format", "json", "output format: json or yaml")
+	planCmd.Flags().BoolVar(&planSkipClosure, "skip-closure", false, "plan as extract --skip-closure")
+	rootCmd.AddCommand(planCmd)
+}
@@ -1,17 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/codes"
 
 	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/telemetry"
 )
 
 var (
-	cfgPath string
-	cfg     *config.Config
+	cfgPath    string
+	cfgProfile string
+	readOnly   bool
+	cfg        *config.Config
+
+	queryLogPath string
+	queryLogFile *os.File
 )
 
 var rootCmd = &cobra.Command{
@@ -21,25 +33,101 @@ var rootCmd = &cobra.Command{
 and extracts a consistent subset of data starting from specified root tables.
 The output is in pg_dump-compatible COPY format.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := openQueryLog(); err != nil {
+			return err
+		}
 		if cfgPath == "" {
 			return fmt.Errorf("--config is required")
 		}
 		var err error
-		cfg, err = config.Load(cfgPath)
+		cfg, err = config.LoadProfile(cfgPath, cfgProfile)
 		if err != nil {
 			return err
 		}
+		setReadOnly(cfg)
 		return nil
 	},
 }
 
+// openQueryLog starts recording the executed statements to --query-log.
+func openQueryLog() error {
+	if queryLogPath == "" {
+		return nil
+	}
+	f, err := os.Create(queryLogPath)
+	if err != nil {
+		return fmt.Errorf("creating query log: %w", err)
+	}
+	queryLogFile = f
+	db.SetQueryLog(f)
+	return nil
+}
+
+// setReadOnly applies --read-only to the connections of c.
+func setReadOnly(c *config.Config) {
+	c.Connection.ReadOnly = readOnly
+	if c.Replica != nil {
+		c.Replica.ReadOnly = readOnly
+	}
+}
+
+// startTrace exports traces over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is
+// set: a span for the command, one per extracted table and one per query.
+// The returned func ends the command span and flushes the spans.
+func startTrace(ctx context.Context) (context.Context, func(error)) {
+	if !telemetry.Enabled() {
+		return ctx, func(error) {}
+	}
+	ctx, shutdown, err := telemetry.Setup(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARNING: tracing disabled:", err)
+		return ctx, func(error) {}
+	}
+	db.AddTracer(telemetry.QueryTracer{})
+
+	name := rootCmd.Name()
+	if sub, _, err := rootCmd.Find(os.Args[1:]); err == nil && sub != rootCmd {
+		name = sub.CommandPath()
+	}
+	ctx, span := telemetry.Tracer().Start(ctx, name)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		// Flushing must not hang on an unreachable collector.
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(flushCtx); err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: exporting traces:", err)
+		}
+	}
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgPath, "config", "", "path to YAML config file (required)")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "make every database session read-only (default_transaction_read_only = on) and refuse commands that write")
+	rootCmd.PersistentFlags().StringVar(&queryLogPath, "query-log", "", "record every executed SQL statement with its parameters and timing to this file")
+	rootCmd.PersistentFlags().StringVar(&cfgProfile, "profile", os.Getenv("DB_SUB_DATA_PROFILE"), "config profile (profiles.<name>) merged over the top-level settings (default $DB_SUB_DATA_PROFILE)")
 }
 
-// Execute runs the root command.
+// Execute runs the root command. SIGINT and SIGTERM cancel the command's
+// context, so in-flight queries are cancelled; a second signal exits at once.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	ctx, endTrace := startTrace(ctx)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	endTrace(err)
+	if queryLogFile != nil {
+		queryLogFile.Close()
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// Result holds the orphan count for a single relation.
+type Result struct {
+	FK      schema.ForeignKey
+	Orphans int64
+}
+
+// Relations returns the relations to audit: all virtual relations and, when
+// includeNotValid is set, real FK constraints that were added with NOT VALID.
+// Relations whose parent table is outside the graph are skipped, as are sql
+// virtual relations, whose child rows need not reference a parent.
+func Relations(g *graph.Graph, includeNotValid bool) []schema.ForeignKey {
+	names := make([]string, 0, len(g.Tables))
+	for name := range g.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var fks []schema.ForeignKey
+	for _, name := range names {
+		for _, fk := range g.Tables[name].ForeignKeys {
+			if _, ok := g.Tables[fk.ParentSchema+"."+fk.ParentTable]; !ok || fk.Virtual == schema.VirtualSQL {
+				continue
+			}
+			if fk.Virtual != schema.VirtualNone || (includeNotValid && fk.NotValid) {
+				fks = append(fks, fk)
+			}
+		}
+	}
+	return fks
+}
+
+// Run counts orphaned rows for each relation against the live database.
+func Run(ctx context.Context, pool *pgxpool.Pool, fks []schema.ForeignKey) ([]Result, error) {
+	results := make([]Result, 0, len(fks))
+	for _, fk := range fks {
+		var count int64
+		if err := pool.QueryRow(ctx, buildOrphanQuery(fk)).Scan(&count); err != nil {
+			return nil, fmt.Errorf("auditing %s: %w", fk.Name, err)
+		}
+		results = append(results, Result{FK: fk, Orphans: count})
+	}
+	return results, nil
+}
+
+// buildOrphanQuery builds a count query for child rows whose non-NULL reference
+// has no matching parent row.
+func buildOrphanQuery(fk schema.ForeignKey) string {
+	child := schema.QuoteIdent(fk.ChildSchema) + "." + schema.QuoteIdent(fk.ChildTable)
+	parent := schema.QuoteIdent(fk.ParentSchema) + "." + schema.QuoteIdent(fk.ParentTable)
+	q := schema.QuoteIdent
+
+	switch fk.Virtual {
+	case schema.VirtualArray:
+		return fmt.Sprintf(`SELECT count(*) FROM %s c
+WHERE EXISTS (
+  SELECT 1 FROM unnest(c.%s) AS v(val)
+  WHERE v.val IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s = v.val)
+)`, child, q(fk.ChildColumns[0]), parent, q(fk.ParentColumns[0]))
+	case schema.VirtualJSON:
+		expr := fmt.Sprintf("(c.%s->>'%s')", q(fk.ChildColumns[0]), strings.ReplaceAll(fk.JSONPath, "'", "''"))
+		return fmt.Sprintf(`SELECT count(*) FROM %s c
+WHERE %s IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s::text = %s)`,
+			child, expr, parent, q(fk.ParentColumns[0]), expr)
+	case schema.VirtualPolymorphic:
+		return fmt.Sprintf(`SELECT count(*) FROM %s c
+WHERE c.%s = '%s' AND c.%s IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s = c.%s)`,
+			child, q(fk.TypeColumn), strings.ReplaceAll(fk.TypeValue, "'", "''"), q(fk.ChildColumns[0]),
+			parent, q(fk.ParentColumns[0]), q(fk.ChildColumns[0]))
+	default:
+		// MATCH SIMPLE semantics: rows with any NULL key column are not checked
+		notNull := make([]string, len(fk.ChildColumns))
+		join := make([]string, len(fk.ChildColumns))
+		for i, c := range fk.ChildColumns {
+			notNull[i] = fmt.Sprintf("c.%s IS NOT NULL", q(c))
+			join[i] = fmt.Sprintf("p.%s = c.%s", q(fk.ParentColumns[i]), q(c))
+		}
+		return fmt.Sprintf(`SELECT count(*) FROM %s c
+WHERE %s
+  AND NOT EXISTS (SELECT 1 FROM %s p WHERE %s)`,
+			child, strings.Join(notNull, " AND "), parent, strings.Join(join, " AND "))
+	}
+}
+
+// WriteReport writes a per-relation orphan report to w and returns the total
+// number of orphaned rows.
+func WriteReport(w io.Writer, results []Result) int64 {
+	var total int64
+	for _, r := range results {
+		kind := string(r.FK.Virtual)
+		if kind == "" {
+			kind = "not valid"
+		}
+		status := "OK"
+		if r.Orphans > 0 {
+			status = fmt.Sprintf("%d orphaned rows", r.Orphans)
+		}
+		fmt.Fprintf(w, "%s.%s(%s) -> %s.%s(%s) [%s]: %s\n",
+			r.FK.ChildSchema, r.FK.ChildTable, strings.Join(r.FK.ChildColumns, ", "),
+			r.FK.ParentSchema, r.FK.ParentTable, strings.Join(r.FK.ParentColumns, ", "),
+			kind, status)
+		total += r.Orphans
+	}
+	fmt.Fprintf(w, "\nRelations checked: %d, orphaned rows: %d\n", len(results), total)
+	return total
+}
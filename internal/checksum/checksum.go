@@ -0,0 +1,139 @@
+// Package checksum writes and verifies SHA-256 manifests of extract output
+// files, in the format of sha256sum, optionally signed with an OpenPGP key.
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Ext is the extension of a manifest written next to an output file, and
+// DirManifest the manifest of a directory output.
+const (
+	Ext         = ".sha256"
+	DirManifest = "SHA256SUMS"
+)
+
+// Entry is the checksum of one file, named relative to the manifest.
+type Entry struct {
+	Name   string
+	SHA256 string
+}
+
+// Format renders a manifest checkable with sha256sum -c.
+func Format(entries []Entry) []byte {
+	var b bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s  %s\n", e.SHA256, e.Name)
+	}
+	return b.Bytes()
+}
+
+// Parse reads a manifest into file name → checksum.
+func Parse(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid manifest line %q", line)
+		}
+		sums[name] = sum
+	}
+	return sums, sc.Err()
+}
+
+// File returns the checksum of a file.
+func File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify checks the files of a manifest, relative to dir. With names, only
+// those files are checked, and each must be listed.
+func Verify(manifest []byte, dir string, names ...string) error {
+	sums, err := Parse(manifest)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		for name := range sums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		want, ok := sums[name]
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+		got, err := File(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("%s: checksum mismatch (manifest %s, file %s)", name, want, got)
+		}
+	}
+	return nil
+}
+
+// Sign returns an armored detached signature of the manifest, verifiable
+// with gpg --verify, made with the first signing key of an armored secret
+// key file. passphrase decrypts a protected key.
+func Sign(manifest []byte, keyPath, passphrase string) ([]byte, error) {
+	f, err := os.Open(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key %s: %w", keyPath, err)
+	}
+	var signer *openpgp.Entity
+	for _, k := range keys {
+		if k.PrivateKey != nil {
+			signer = k
+			break
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("%s holds no secret key", keyPath)
+	}
+	if signer.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("signing key %s is passphrase-protected", keyPath)
+		}
+		if err := signer.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("decrypting signing key %s: %w", keyPath, err)
+		}
+	}
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(manifest), nil); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
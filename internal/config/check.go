@@ -0,0 +1,327 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// Problem is a config error located in the YAML file (Line is 0 if unknown).
+type Problem struct {
+	Line    int
+	Message string
+}
+
+// Document is the parsed YAML of a config, used to locate fields.
+type Document struct {
+	root *yaml.Node
+}
+
+var yamlLineError = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// Check loads the config at path like Load, but reports unknown fields and
+// type errors of the whole file, with their lines, instead of stopping at the
+// first error. cfg is nil if the file is not valid YAML.
+func Check(path, profile string) (*Config, *Document, []Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, []Problem{lineProblem(err.Error())}, nil
+	}
+	doc := &Document{root: &root}
+	placeholders := placeholderLines(&root)
+	if err := applyProfile(&root, profile); err != nil {
+		return nil, doc, []Problem{lineProblem(err.Error())}, nil
+	}
+	interpolated, err := interpolate(&root)
+	if err != nil {
+		return nil, doc, []Problem{lineProblem(err.Error())}, nil
+	}
+
+	// Unknown fields are found in the file as written (all profiles
+	// included), type errors of interpolated values after interpolation
+	var problems []Problem
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			return nil, doc, []Problem{lineProblem(err.Error())}, nil
+		}
+		for _, msg := range te.Errors {
+			if p := lineProblem(msg); !placeholders[p.Line] {
+				problems = append(problems, p)
+			}
+		}
+	}
+	cfg = Config{}
+	if root.Kind != 0 {
+		if err := root.Decode(&cfg); err != nil {
+			var te *yaml.TypeError
+			if !errors.As(err, &te) {
+				return nil, doc, []Problem{lineProblem(err.Error())}, nil
+			}
+			for _, msg := range te.Errors {
+				if p := lineProblem(msg); interpolated[p.Line] {
+					problems = append(problems, p)
+				}
+			}
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		problems = append(problems, Problem{Line: doc.Line("connection.url"), Message: err.Error()})
+	} else if err := cfg.validate(); err != nil {
+		problems = append(problems, doc.problem(err.Error()))
+	}
+	if len(cfg.Roots) > 0 {
+		if err := cfg.ValidateForExtract(); err != nil {
+			problems = append(problems, doc.problem(err.Error()))
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return &cfg, doc, problems, nil
+}
+
+// lineProblem converts a yaml.v3 "line N: message" error.
+func lineProblem(msg string) Problem {
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	if m := yamlLineError.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Problem{Line: line, Message: m[2]}
+	}
+	return Problem{Message: msg}
+}
+
+// problem locates a validation error by the field path it starts with
+// (e.g. "roots[0].direction must be ...").
+func (d *Document) problem(msg string) Problem {
+	path, _, _ := strings.Cut(msg, " ")
+	path = strings.TrimSuffix(path, ":")
+	return Problem{Line: d.Line(path), Message: msg}
+}
+
+// Line returns the line of the field at path (e.g. "tables.users.limit",
+// "roots[1].table"), or of its nearest existing ancestor. Mapping keys may
+// contain dots.
+func (d *Document) Line(path string) int {
+	node := d.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := 0
+	for path != "" {
+		switch node.Kind {
+		case yaml.MappingNode:
+			best := -1
+			for i := 0; i < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if (path == key || strings.HasPrefix(path, key+".") || strings.HasPrefix(path, key+"[")) &&
+					(best < 0 || len(key) > len(node.Content[best].Value)) {
+					best = i
+				}
+			}
+			if best < 0 {
+				return line
+			}
+			line = node.Content[best].Line
+			path = strings.TrimPrefix(strings.TrimPrefix(path, node.Content[best].Value), ".")
+			node = node.Content[best+1]
+		case yaml.SequenceNode:
+			idx, rest, ok := strings.Cut(strings.TrimPrefix(path, "["), "]")
+			i, err := strconv.Atoi(idx)
+			if !strings.HasPrefix(path, "[") || !ok || err != nil || i < 0 || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+			path = strings.TrimPrefix(rest, ".")
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// CheckSchema reports config entries referring to tables, columns or
+// constraints that do not exist in tables (schema.table → table, with virtual
+// relations applied), and roots and pins that are also excluded.
+func (c *Config) CheckSchema(doc *Document, tables map[string]*schema.Table) []Problem {
+	var problems []Problem
+	add := func(path, format string, args ...any) {
+		problems = append(problems, Problem{Line: doc.Line(path), Message: path + ": " + fmt.Sprintf(format, args...)})
+	}
+	lookup := func(name string) *schema.Table {
+		if t, ok := tables[name]; ok {
+			return t
+		}
+		for _, t := range tables {
+			if t.Name == name {
+				return t
+			}
+		}
+		return nil
+	}
+	checkColumn := func(path, table, column string) {
+		t := lookup(table)
+		if t == nil {
+			add(path, "table %q does not exist", table)
+		} else if column != "" && t.Column(column) == nil {
+			add(path, "column %q does not exist in %s", column, t.FullName())
+		}
+	}
+
+	for _, ref := range c.tableRefs() {
+		if _, err := ResolveTable(tables, ref.name); err != nil {
+			add(ref.path, "%v", err)
+		}
+	}
+	excluded := c.ExcludeSet(tables)
+	isExcluded := func(name string) bool {
+		key, _ := ResolveTable(tables, name)
+		return key != "" && excluded[key]
+	}
+	for i, r := range c.Roots {
+		path := fmt.Sprintf("roots[%d].table", i)
+		checkColumn(path, r.Table, "")
+		if isExcluded(r.Table) {
+			add(path, "%q is excluded by exclude_tables, include_tables or foreign_tables", r.Table)
+		}
+		if r.Via != nil {
+			checkColumn(fmt.Sprintf("roots[%d].via.table", i), r.Via.Table, "")
+		}
+	}
+	hasColumn := func(column string) bool {
+		for _, t := range tables {
+			if t.Column(column) != nil {
+				return true
+			}
+		}
+		return false
+	}
+	if c.Tenant != nil && !hasColumn(c.Tenant.Column) {
+		add("tenant.column", "no table has column %q", c.Tenant.Column)
+	}
+	for i, f := range c.GlobalFilters {
+		if !hasColumn(f.Column) {
+			add(fmt.Sprintf("global_filters[%d].column", i), "no table has column %q", f.Column)
+		}
+	}
+	for i, p := range c.Pins {
+		path := fmt.Sprintf("pins[%d].table", i)
+		checkColumn(path, p.Table, "")
+		if t := lookup(p.Table); t != nil && t.PrimaryKey == nil {
+			add(path, "%s has no primary key", t.FullName())
+		}
+		if isExcluded(p.Table) {
+			add(path, "%q is excluded by exclude_tables, include_tables or foreign_tables", p.Table)
+		}
+	}
+	checkPatterns := func(field string, patterns []string) {
+		for i, p := range patterns {
+			path := fmt.Sprintf("%s[%d]", field, i)
+			if !isTablePattern(p) {
+				checkColumn(path, p, "")
+				continue
+			}
+			m, err := compileTablePattern(p)
+			if err != nil {
+				continue // reported by validate
+			}
+			found := false
+			for _, t := range tables {
+				found = found || m(t)
+			}
+			if !found {
+				add(path, "pattern %q matches no table", p)
+			}
+		}
+	}
+	checkPatterns("exclude_tables", c.ExcludeTables)
+	checkPatterns("include_tables", c.IncludeTables)
+
+	for _, name := range sortedKeys(c.Tables) {
+		tc := c.Tables[name]
+		if lookup(name) == nil {
+			add("tables."+name, "table %q does not exist", name)
+			continue
+		}
+		for _, col := range tc.DropColumns {
+			checkColumn("tables."+name+".drop_columns", name, col)
+		}
+		for _, col := range sortedKeys(tc.SetColumns) {
+			checkColumn("tables."+name+".set_columns."+col, name, col)
+		}
+	}
+
+	for i, vr := range c.VirtualRelations {
+		if vr.Type == "sql" {
+			checkColumn(fmt.Sprintf("virtual_relations[%d].child_table", i), vr.ChildTable, "")
+			checkColumn(fmt.Sprintf("virtual_relations[%d].parent_table", i), vr.ParentTable, "")
+			if t := lookup(vr.ParentTable); t != nil && t.KeyColumns() == nil {
+				add(fmt.Sprintf("virtual_relations[%d].parent_table", i), "%s has no primary key or unique key (required for type sql)", t.FullName())
+			}
+			continue
+		}
+		checkColumn(fmt.Sprintf("virtual_relations[%d].child_column", i), vr.ChildTable, vr.ChildColumn)
+		checkColumn(fmt.Sprintf("virtual_relations[%d].parent_column", i), vr.ParentTable, vr.ParentColumn)
+	}
+
+	for i, pr := range c.PolymorphicRelations {
+		path := fmt.Sprintf("polymorphic_relations[%d]", i)
+		checkColumn(path+".type_column", pr.ChildTable, pr.TypeColumn)
+		checkColumn(path+".id_column", pr.ChildTable, pr.IDColumn)
+		for _, value := range sortedKeys(pr.Targets) {
+			checkColumn(path+".targets."+value, pr.Targets[value], firstNonEmpty(pr.ParentColumn, "id"))
+		}
+	}
+
+	for i, r := range c.FKRules {
+		found := false
+		for _, t := range tables {
+			if r.Table != "" && t.Name != r.Table && t.FullName() != r.Table {
+				continue
+			}
+			for _, fk := range t.ForeignKeys {
+				if fk.Name == r.Constraint {
+					found = true
+				}
+			}
+		}
+		if !found {
+			add(fmt.Sprintf("fk_rules[%d].constraint", i), "foreign key %q does not exist", r.Constraint)
+		}
+	}
+
+	for _, key := range sortedKeys(c.Mask) {
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			continue // reported by validate
+		}
+		checkColumn("mask."+key, key[:i], key[i+1:])
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestConnectionDSNRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		conn Connection
+	}{
+		{"plain", Connection{Host: "db.example.com", Port: 5432, Database: "app", User: "app", Password: "secret", SSLMode: "disable"}},
+		{"special password", Connection{Host: "localhost", Port: 5433, Database: "my db", User: "o'brien", Password: `p w 'q' \b\ x=1`, SSLMode: "disable"}},
+		{"empty password", Connection{Host: "localhost", Port: 5432, Database: "app", User: "app", Password: "", SSLMode: "disable"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := pgconn.ParseConfig(tt.conn.DSN())
+			if err != nil {
+				t.Fatalf("ParseConfig(%q): %v", tt.conn.DSN(), err)
+			}
+			if cfg.Host != tt.conn.Host || int(cfg.Port) != tt.conn.Port || cfg.Database != tt.conn.Database ||
+				cfg.User != tt.conn.User || cfg.Password != tt.conn.Password {
+				t.Errorf("DSN %q parsed as host=%q port=%d dbname=%q user=%q password=%q",
+					tt.conn.DSN(), cfg.Host, cfg.Port, cfg.Database, cfg.User, cfg.Password)
+			}
+		})
+	}
+}
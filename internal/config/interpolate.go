@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolate replaces ${VAR} and ${VAR:-default} in the string values of
+// node with environment variables; $${ writes a literal ${. Unquoted values are
+// re-resolved after substitution, so "port: ${PGPORT:-5432}" is an integer.
+// It returns the lines of the substituted values.
+func interpolate(node *yaml.Node) (map[int]bool, error) {
+	lines := make(map[int]bool)
+	var walk func(n *yaml.Node, isValue bool) error
+	walk = func(n *yaml.Node, isValue bool) error {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, c := range n.Content {
+				if err := walk(c, true); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i, c := range n.Content {
+				if err := walk(c, i%2 == 1); err != nil {
+					return err
+				}
+			}
+		case yaml.ScalarNode:
+			if !isValue || n.ShortTag() != "!!str" || !strings.Contains(n.Value, "$") {
+				return nil
+			}
+			value, err := expandEnv(n.Value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+			if value == n.Value {
+				return nil
+			}
+			n.Value = value
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+			lines[n.Line] = true
+		}
+		return nil
+	}
+	return lines, walk(node, true)
+}
+
+// placeholderLines returns the lines of the string values of node that
+// contain ${.
+func placeholderLines(node *yaml.Node) map[int]bool {
+	lines := make(map[int]bool)
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+			lines[n.Line] = true
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(node)
+	return lines
+}
+
+// expandEnv expands ${VAR}, ${VAR:-default} and $${ in s. A variable that is
+// unset and has no default is an error; ${VAR:-default} also uses the default
+// when VAR is empty. Other $ (e.g. $1 or $$ quoting in SQL) are kept.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s[i+1:], "${"):
+			b.WriteByte('$')
+			i++ // the { is written as is
+		case s[i+1] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			expr := s[i+2 : i+end]
+			name, def, hasDefault := strings.Cut(expr, ":-")
+			if !isIdent(name) {
+				return "", fmt.Errorf("invalid variable ${%s}", expr)
+			}
+			value, ok := os.LookupEnv(name)
+			switch {
+			case hasDefault && value == "":
+				value = def
+			case !ok:
+				return "", fmt.Errorf("environment variable %s is not set (use ${%s:-default} for a default)", name, name)
+			}
+			b.WriteString(value)
+			i += end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
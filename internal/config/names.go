@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// ResolveTable returns the key in tables (schema.table → table) of the table
+// a config entry names: the schema-qualified name itself, or else the only
+// table with the bare name. It returns "" if there is no such table, and an
+// error if the bare name exists in several schemas.
+func ResolveTable(tables map[string]*schema.Table, name string) (string, error) {
+	if _, ok := tables[name]; ok {
+		return name, nil
+	}
+	var keys []string
+	for key, t := range tables {
+		if t.Name == name {
+			keys = append(keys, key)
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return "", nil
+	case 1:
+		return keys[0], nil
+	}
+	sort.Strings(keys)
+	return "", fmt.Errorf("table %q is ambiguous (%s); qualify it with the schema", name, strings.Join(keys, ", "))
+}
+
+// TableName returns the name a config entry uses for t: its bare name, or
+// schema.table if tables hold a table of that name in another schema, so
+// ResolveTable finds it.
+func TableName(tables map[string]*schema.Table, t *schema.Table) string {
+	for key, other := range tables {
+		if other.Name == t.Name && key != t.FullName() {
+			return t.FullName()
+		}
+	}
+	return t.Name
+}
+
+// tableRef is a config entry naming a single table.
+type tableRef struct {
+	path string
+	name string
+}
+
+// tableRefs returns the entries naming a single table. Per-table settings
+// (tables, mask, fk_rules) are not included: a bare name there applies to
+// the tables of that name in every schema without a qualified entry.
+func (c *Config) tableRefs() []tableRef {
+	var refs []tableRef
+	for i, name := range c.ExcludeTables {
+		if !isTablePattern(name) {
+			refs = append(refs, tableRef{fmt.Sprintf("exclude_tables[%d]", i), name})
+		}
+	}
+	for i, name := range c.IncludeTables {
+		if !isTablePattern(name) {
+			refs = append(refs, tableRef{fmt.Sprintf("include_tables[%d]", i), name})
+		}
+	}
+	for i, r := range c.Roots {
+		refs = append(refs, tableRef{fmt.Sprintf("roots[%d].table", i), r.Table})
+		if r.Via != nil {
+			refs = append(refs, tableRef{fmt.Sprintf("roots[%d].via.table", i), r.Via.Table})
+		}
+	}
+	for i, p := range c.Pins {
+		refs = append(refs, tableRef{fmt.Sprintf("pins[%d].table", i), p.Table})
+	}
+	for i, vr := range c.VirtualRelations {
+		refs = append(refs,
+			tableRef{fmt.Sprintf("virtual_relations[%d].child_table", i), vr.ChildTable},
+			tableRef{fmt.Sprintf("virtual_relations[%d].parent_table", i), vr.ParentTable})
+	}
+	for i, pr := range c.PolymorphicRelations {
+		path := fmt.Sprintf("polymorphic_relations[%d]", i)
+		refs = append(refs, tableRef{path + ".child_table", pr.ChildTable})
+		for _, value := range sortedKeys(pr.Targets) {
+			refs = append(refs, tableRef{path + ".targets." + value, pr.Targets[value]})
+		}
+	}
+	return refs
+}
+
+// CheckTableNames reports an error if an entry naming a single table (a
+// root, pin, included or excluded table that is not a pattern, or relation)
+// uses a bare name that exists in
+// several schemas of tables.
+func (c *Config) CheckTableNames(tables map[string]*schema.Table) error {
+	for _, ref := range c.tableRefs() {
+		if _, err := ResolveTable(tables, ref.name); err != nil {
+			return fmt.Errorf("%s: %w", ref.path, err)
+		}
+	}
+	return nil
+}
+
+// isTablePattern reports whether an exclude_tables or include_tables entry
+// is a pattern: a regular expression between slashes (/^tmp_/) or a glob
+// with *, ? or [ (audit_*, public.*_log).
+func isTablePattern(s string) bool {
+	return isTableRegexp(s) || strings.ContainsAny(s, "*?[")
+}
+
+func isTableRegexp(s string) bool {
+	return len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/")
+}
+
+// tableMatcher reports whether a table matches an entry.
+type tableMatcher func(t *schema.Table) bool
+
+// compileTablePattern returns the matcher of an exclude_tables or
+// include_tables entry. Patterns match the schema-qualified or the bare
+// table name; a regular expression is unanchored unless written with ^ and $.
+func compileTablePattern(s string) (tableMatcher, error) {
+	switch {
+	case isTableRegexp(s):
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		return func(t *schema.Table) bool {
+			return re.MatchString(t.FullName()) || re.MatchString(t.Name)
+		}, nil
+	case isTablePattern(s):
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", s, err)
+		}
+		return func(t *schema.Table) bool {
+			full, _ := path.Match(s, t.FullName())
+			bare, _ := path.Match(s, t.Name)
+			return full || bare
+		}, nil
+	}
+	return func(t *schema.Table) bool {
+		return t.FullName() == s || t.Name == s
+	}, nil
+}
+
+// compileTablePatterns returns the matchers of a list of entries, skipping
+// invalid ones (reported by validate).
+func compileTablePatterns(patterns []string) []tableMatcher {
+	var matchers []tableMatcher
+	for _, p := range patterns {
+		if m, err := compileTablePattern(p); err == nil {
+			matchers = append(matchers, m)
+		}
+	}
+	return matchers
+}
+
+func matchesAny(matchers []tableMatcher, t *schema.Table) bool {
+	for _, m := range matchers {
+		if m(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeSet returns the full names of the tables (schema.table → table)
+// removed from the extraction: those matching exclude_tables, when
+// include_tables is set those matching none of its entries, and foreign
+// tables unless foreign_tables is read or include.
+func (c *Config) ExcludeSet(tables map[string]*schema.Table) map[string]bool {
+	include := compileTablePatterns(c.IncludeTables)
+	exclude := compileTablePatterns(c.ExcludeTables)
+	skipForeign := c.ForeignTables != ForeignRead && c.ForeignTables != ForeignInclude
+	set := make(map[string]bool)
+	for name, t := range tables {
+		if (len(c.IncludeTables) > 0 && !matchesAny(include, t)) || matchesAny(exclude, t) || (t.Foreign && skipForeign) {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// validateTablePatterns checks the entries of exclude_tables or
+// include_tables.
+func validateTablePatterns(field string, patterns []string) error {
+	for i, p := range patterns {
+		if p == "" {
+			return fmt.Errorf("%s[%d] must not be empty", field, i)
+		}
+		if _, err := compileTablePattern(p); err != nil {
+			return fmt.Errorf("%s[%d]: %w", field, i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyProfile merges profiles.<name> of the document into its top level and
+// removes the profiles key. Mappings are merged recursively; other values of
+// the profile replace the top-level ones. With an empty name only the profiles
+// key is removed.
+func applyProfile(root *yaml.Node, name string) error {
+	doc := root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	var profiles *yaml.Node
+	if doc.Kind == yaml.MappingNode {
+		for i := 0; i < len(doc.Content); i += 2 {
+			if doc.Content[i].Value == "profiles" {
+				profiles = doc.Content[i+1]
+				doc.Content = append(doc.Content[:i:i], doc.Content[i+2:]...)
+				break
+			}
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	var names []string
+	if profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i < len(profiles.Content); i += 2 {
+			if profiles.Content[i].Value == name {
+				profile := profiles.Content[i+1]
+				if profile.Kind != yaml.MappingNode {
+					return fmt.Errorf("line %d: profiles.%s must be a mapping", profile.Line, name)
+				}
+				mergeNode(doc, profile)
+				return nil
+			}
+			names = append(names, profiles.Content[i].Value)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("profile %q not found: the config defines no profiles", name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+// mergeNode merges the mapping src into the mapping dst.
+func mergeNode(dst, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		found := false
+		for j := 0; j < len(dst.Content); j += 2 {
+			if dst.Content[j].Value != key.Value {
+				continue
+			}
+			if value.Kind == yaml.MappingNode && dst.Content[j+1].Kind == yaml.MappingNode {
+				mergeNode(dst.Content[j+1], value)
+			} else {
+				dst.Content[j+1] = value
+			}
+			found = true
+			break
+		}
+		if !found {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
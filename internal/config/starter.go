@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Starter describes a generated starter config.
+type Starter struct {
+	// Connection is written without the password, which is left to
+	// PGPASSWORD / POSTGRES_PASSWORD.
+	Connection Connection
+	Schemas    []string
+	// Roots are candidate root tables (tables without FK parents).
+	Roots []StarterTable
+	// Large are tables suggested for exclude_tables.
+	Large []StarterTable
+}
+
+// StarterTable is a table listed in a starter config with its size.
+type StarterTable struct {
+	Name  string // name used by roots and exclude_tables (see TableName)
+	Table string // schema.table
+	Rows  int64
+	Bytes ByteSize
+}
+
+// WriteStarter writes a starter YAML config. Roots and excluded tables are
+// written as comments to be reviewed and uncommented.
+func WriteStarter(w io.Writer, s Starter) error {
+	var b strings.Builder
+	b.WriteString("# db-sub-data 設定ファイル（db-sub-data init で生成）\n")
+	b.WriteString("# 詳細は config.example.yaml を参照。\n\n")
+
+	b.WriteString("connection:\n")
+	fmt.Fprintf(&b, "  host: %s\n", strconv.Quote(s.Connection.Host))
+	fmt.Fprintf(&b, "  port: %d\n", s.Connection.Port)
+	fmt.Fprintf(&b, "  database: %s\n", strconv.Quote(s.Connection.Database))
+	fmt.Fprintf(&b, "  user: %s\n", strconv.Quote(s.Connection.User))
+	b.WriteString("  # password: 環境変数 PGPASSWORD / POSTGRES_PASSWORD で指定\n")
+	fmt.Fprintf(&b, "  sslmode: %s\n\n", strconv.Quote(s.Connection.SSLMode))
+
+	b.WriteString("schemas:\n")
+	for _, name := range s.Schemas {
+		fmt.Fprintf(&b, "  - %s\n", strconv.Quote(name))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# ルート候補（FK の親を持たないテーブル）。起点にするテーブルのコメントを外し where を指定する。\n")
+	b.WriteString("roots:\n")
+	if len(s.Roots) == 0 {
+		b.WriteString("  # (候補なし)\n")
+	}
+	for _, t := range s.Roots {
+		fmt.Fprintf(&b, "  # - table: %s  # %s, %s\n", strconv.Quote(t.Name), t.Table, describeSize(t))
+		b.WriteString("  #   where: \"id IN (1)\"\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# 大きなテーブル（除外候補）。ログ・履歴など不要なテーブルのコメントを外す。\n")
+	b.WriteString("exclude_tables:\n")
+	if len(s.Large) == 0 {
+		b.WriteString("  # (候補なし)\n")
+	}
+	for _, t := range s.Large {
+		fmt.Fprintf(&b, "  # - %s  # %s, %s\n", strconv.Quote(t.Name), t.Table, describeSize(t))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("output: \"subset.sql\"\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func describeSize(t StarterTable) string {
+	rows := "rows unknown (not analyzed)"
+	if t.Rows >= 0 {
+		rows = fmt.Sprintf("~%d rows", t.Rows)
+	}
+	return fmt.Sprintf("%s, %s", rows, t.Bytes)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+func TestStarterNamesAmbiguousTables(t *testing.T) {
+	tables := map[string]*schema.Table{
+		"public.events": {Schema: "public", Name: "events"},
+		"audit.events":  {Schema: "audit", Name: "events"},
+		"public.users":  {Schema: "public", Name: "users"},
+	}
+	if got := TableName(tables, tables["audit.events"]); got != "audit.events" {
+		t.Errorf("TableName(audit.events) = %q, want audit.events", got)
+	}
+	if got := TableName(tables, tables["public.users"]); got != "users" {
+		t.Errorf("TableName(public.users) = %q, want users", got)
+	}
+
+	var roots []StarterTable
+	for _, key := range []string{"audit.events", "public.events", "public.users"} {
+		roots = append(roots, StarterTable{Name: TableName(tables, tables[key]), Table: key, Rows: -1})
+	}
+	var buf bytes.Buffer
+	if err := WriteStarter(&buf, Starter{Schemas: []string{"public", "audit"}, Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+	// the starter lists roots commented out; uncommented, they must resolve
+	cfg := &Config{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), `# - table: "`); ok {
+			name, _, _ = strings.Cut(name, `"`)
+			cfg.Roots = append(cfg.Roots, Root{Table: name})
+		}
+	}
+	if len(cfg.Roots) != 3 {
+		t.Fatalf("got %d roots in the starter, want 3:\n%s", len(cfg.Roots), buf.String())
+	}
+	if err := cfg.CheckTableNames(tables); err != nil {
+		t.Errorf("starter roots fail CheckTableNames: %v", err)
+	}
+}
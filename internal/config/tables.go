@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TableConfig holds per-table extraction settings, keyed in the config by
+// "schema.table" or bare table name.
+type TableConfig struct {
+	// MaxBytes caps the COPY output size of the table. Rows are fetched in
+	// OrderBy order (default: primary key descending, i.e. newest first) and
+	// the remainder is dropped once the budget is reached.
+	MaxBytes ByteSize `yaml:"max_bytes"`
+	OrderBy  string   `yaml:"order_by"`
+	// NullFKs is the nullable FK policy for this table's FKs (see Config.NullFKs).
+	NullFKs     string `yaml:"null_fks"`
+	NullFKLimit int    `yaml:"null_fk_limit"`
+	// Limit caps the rows fetched for the table by the traversal (0 = no
+	// limit). Parent rows fetched to satisfy FKs are not limited.
+	Limit int `yaml:"limit"`
+	// Sample fetches a random percentage of the matching rows
+	// (TABLESAMPLE BERNOULLI), e.g. 1 for 1%.
+	Sample float64 `yaml:"sample"`
+	// DropColumns are omitted from the output.
+	DropColumns []string `yaml:"drop_columns"`
+	// SetColumns replace column values in the output with a static value
+	// (null writes NULL).
+	SetColumns map[string]any `yaml:"set_columns"`
+	// CopyAll dumps all rows of the table regardless of the traversal, for
+	// lookup tables (countries, currencies, ...). Its rows do not seed child
+	// lookups, and FKs referencing it match any row.
+	CopyAll bool `yaml:"copy_all"`
+}
+
+// validateColumns checks that no column is both dropped and set.
+func (tc TableConfig) validateColumns(field string) error {
+	for _, c := range tc.DropColumns {
+		if _, ok := tc.SetColumns[c]; ok {
+			return fmt.Errorf("%s: column %q is in both drop_columns and set_columns", field, c)
+		}
+	}
+	return nil
+}
+
+// TableConfig returns the settings for a table, preferring a schema-qualified
+// key over a bare table name.
+func (c *Config) TableConfig(schemaName, table string) TableConfig {
+	if tc, ok := c.Tables[schemaName+"."+table]; ok {
+		return tc
+	}
+	return c.Tables[table]
+}
+
+// ByteSize is a size in bytes that accepts human-readable YAML values such as
+// "100MB", "1.5GiB" or plain integers.
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	mult   float64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses a human-readable size.
+func ParseByteSize(s string) (ByteSize, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	mult := 1.0
+	for _, u := range byteUnits {
+		if num, ok := strings.CutSuffix(v, u.suffix); ok {
+			v, mult = strings.TrimSpace(num), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * mult), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*b = size
+	return nil
+}
+
+// String formats the size using binary units.
+func (b ByteSize) String() string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v := float64(b)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", int64(b))
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
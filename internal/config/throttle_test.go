@@ -0,0 +1,22 @@
+package config
+
+import "testing"
+
+func TestCapConns(t *testing.T) {
+	tests := []struct {
+		maxConns, minConns, n int
+		wantMax, wantMin      int
+	}{
+		{0, 0, 2, 2, 0},
+		{10, 4, 2, 2, 2},
+		{1, 0, 2, 1, 0},
+	}
+	for _, tt := range tests {
+		c := Connection{MaxConns: tt.maxConns, MinConns: tt.minConns}
+		c.capConns(tt.n)
+		if c.MaxConns != tt.wantMax || c.MinConns != tt.wantMin {
+			t.Errorf("capConns(%d) of max_conns %d, min_conns %d = %d, %d; want %d, %d",
+				tt.n, tt.maxConns, tt.minConns, c.MaxConns, c.MinConns, tt.wantMax, tt.wantMin)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SubstituteVars replaces the :name placeholders in the where clauses of the
+// roots (and their via) with the value of vars[name] or, if unset, of the
+// environment variable NAME (upper case), as a quoted SQL literal. Placeholders
+// in quoted strings and identifiers, and :: casts, are left as-is.
+func (c *Config) SubstituteVars(vars map[string]string) error {
+	lookup := func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(strings.ToUpper(name))
+	}
+	for i := range c.Roots {
+		r := &c.Roots[i]
+		where, err := substituteVars(r.Where, lookup)
+		if err != nil {
+			return fmt.Errorf("roots[%d].where: %w", i, err)
+		}
+		r.Where = where
+		if r.Via != nil {
+			where, err := substituteVars(r.Via.Where, lookup)
+			if err != nil {
+				return fmt.Errorf("roots[%d].via.where: %w", i, err)
+			}
+			r.Via.Where = where
+		}
+	}
+	return nil
+}
+
+// ParseVars parses "name=value" assignments.
+func ParseVars(assignments []string) (map[string]string, error) {
+	vars := make(map[string]string, len(assignments))
+	for _, a := range assignments {
+		name, value, ok := strings.Cut(a, "=")
+		if !ok || !isIdent(name) {
+			return nil, fmt.Errorf("invalid variable %q: expected name=value", a)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+func substituteVars(sql string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	var quote byte // ' or " while inside a quoted string or identifier
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == ':' && i+1 < len(sql) && sql[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case ch == ':' && i+1 < len(sql) && isIdentStart(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			name := sql[i+1 : j]
+			value, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("variable %q is not set (use --var %s=... or $%s)", name, name, strings.ToUpper(name))
+			}
+			b.WriteString("'" + strings.ReplaceAll(value, "'", "''") + "'")
+			i = j - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), nil
+}
+
+func isIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || (ch >= '0' && ch <= '9')
+}
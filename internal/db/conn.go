@@ -3,18 +3,46 @@ package db
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/secret"
 )
 
 // NewPool creates a new pgx connection pool from config.
 func NewPool(ctx context.Context, cfg *config.Connection) (*pgxpool.Pool, error) {
-	poolCfg, err := pgxpool.ParseConfig(cfg.DSN())
+	dsn, err := resolveDSN(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	poolCfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parsing DSN: %w", err)
 	}
+	if cfg.SSH != nil {
+		if err := useTunnel(&poolCfg.ConnConfig.Config, cfg.SSH); err != nil {
+			return nil, err
+		}
+	}
+	applyLimits(&poolCfg.ConnConfig.Config, cfg)
+	poolCfg.ConnConfig.Tracer = tracer()
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxConns)
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = int32(cfg.MinConns)
+	}
+	if len(cfg.Settings) > 0 || cfg.ReadOnly || cfg.UTC {
+		poolCfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			return applySettings(ctx, conn, cfg)
+		}
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
@@ -25,6 +53,146 @@ func NewPool(ctx context.Context, cfg *config.Connection) (*pgxpool.Pool, error)
 		pool.Close()
 		return nil, fmt.Errorf("pinging database: %w", err)
 	}
+	if cfg.ReadOnly {
+		if err := checkReadOnly(ctx, pool); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
 
 	return pool, nil
 }
+
+// Connect opens a single connection, used where session state must persist
+// across statements (e.g. loading a dump).
+func Connect(ctx context.Context, cfg *config.Connection) (*pgx.Conn, error) {
+	dsn, err := resolveDSN(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	connCfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing DSN: %w", err)
+	}
+	if cfg.SSH != nil {
+		if err := useTunnel(&connCfg.Config, cfg.SSH); err != nil {
+			return nil, err
+		}
+	}
+	applyLimits(&connCfg.Config, cfg)
+	connCfg.Tracer = tracer()
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+	if err := applySettings(ctx, conn, cfg); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// applyLimits sets the connect timeout, application_name and the session's
+// statement_timeout and lock_timeout of cfg.
+func applyLimits(pgCfg *pgconn.Config, cfg *config.Connection) {
+	if cfg.ConnectTimeoutDuration > 0 {
+		pgCfg.ConnectTimeout = cfg.ConnectTimeoutDuration
+	}
+	if cfg.StatementTimeoutDuration > 0 {
+		pgCfg.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeoutDuration.Milliseconds(), 10)
+	}
+	if cfg.LockTimeoutDuration > 0 {
+		pgCfg.RuntimeParams["lock_timeout"] = strconv.FormatInt(cfg.LockTimeoutDuration.Milliseconds(), 10)
+	}
+	if cfg.ApplicationName != "" {
+		pgCfg.RuntimeParams["application_name"] = cfg.ApplicationName
+	}
+	if cfg.ReadOnly {
+		pgCfg.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+}
+
+// applySettings sets the session settings of a new connection. Read-only is
+// set last, so no setting can turn it off.
+func applySettings(ctx context.Context, conn *pgx.Conn, cfg *config.Connection) error {
+	names := make([]string, 0, len(cfg.Settings))
+	for name := range cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", name, cfg.Settings[name]); err != nil {
+			return fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+	if cfg.ReadOnly {
+		if _, err := conn.Exec(ctx, "SET default_transaction_read_only = on"); err != nil {
+			return fmt.Errorf("setting default_transaction_read_only: %w", err)
+		}
+	}
+	if cfg.UTC {
+		if _, err := conn.Exec(ctx, "SET TIME ZONE 'UTC'"); err != nil {
+			return fmt.Errorf("setting time zone: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkReadOnly verifies that transactions of pool are read-only, e.g. that a
+// connection pooler did not drop the session setting.
+func checkReadOnly(ctx context.Context, pool *pgxpool.Pool) error {
+	var readOnly string
+	if err := pool.QueryRow(ctx, "SHOW transaction_read_only").Scan(&readOnly); err != nil {
+		return fmt.Errorf("querying transaction_read_only: %w", err)
+	}
+	if readOnly != "on" {
+		return fmt.Errorf("read-only mode: transactions are not read-only (transaction_read_only = %s)", readOnly)
+	}
+	return nil
+}
+
+// resolveDSN returns the DSN of cfg with the password read from its
+// password_from secret store, if any, quoted like the other values (see
+// config.Connection.DSN).
+func resolveDSN(ctx context.Context, cfg *config.Connection) (string, error) {
+	if cfg.PasswordFrom == nil {
+		return cfg.DSN(), nil
+	}
+	password, err := secret.Resolve(ctx, cfg.PasswordFrom)
+	if err != nil {
+		return "", fmt.Errorf("resolving connection.password_from: %w", err)
+	}
+	c := *cfg
+	c.Password = password
+	return c.DSN(), nil
+}
+
+// ServerEncoding returns the database's server_encoding (e.g. "UTF8", "SQL_ASCII").
+func ServerEncoding(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	var enc string
+	if err := pool.QueryRow(ctx, "SHOW server_encoding").Scan(&enc); err != nil {
+		return "", fmt.Errorf("querying server_encoding: %w", err)
+	}
+	return enc, nil
+}
+
+// ReplicationLag reports whether the server is a standby and how far its replay
+// is behind. A standby that has replayed everything it received reports zero lag,
+// so an idle primary does not look like a lagging replica.
+func ReplicationLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, bool, error) {
+	var inRecovery bool
+	var lagSeconds float64
+	err := pool.QueryRow(ctx, `
+		SELECT
+			pg_is_in_recovery(),
+			CASE
+				WHEN NOT pg_is_in_recovery() THEN 0
+				WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END::float8
+	`).Scan(&inRecovery, &lagSeconds)
+	if err != nil {
+		return 0, false, fmt.Errorf("querying replication lag: %w", err)
+	}
+	return time.Duration(lagSeconds * float64(time.Second)), inRecovery, nil
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+)
+
+func TestResolveDSNSecretWithWhitespace(t *testing.T) {
+	const password = " p w\t'q' \\ "
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"data": map[string]any{"password": password}, "metadata": map[string]any{}},
+		})
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	conn := &config.Connection{
+		Host: "localhost", Port: 5432, Database: "app", User: "app", SSLMode: "disable",
+		PasswordFrom: &config.SecretRef{Vault: "secret/data/db"},
+	}
+	dsn, err := resolveDSN(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Password != password || cfg.User != "app" || cfg.Database != "app" {
+		t.Errorf("parsed user=%q dbname=%q password=%q, want app, app, %q", cfg.User, cfg.Database, cfg.Password, password)
+	}
+}
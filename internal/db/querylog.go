@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SetQueryLog records every statement run on connections opened afterwards
+// to w, as SQL with its parameters and timing in comments.
+func SetQueryLog(w io.Writer) {
+	AddTracer(&QueryLog{w: w})
+}
+
+// QueryLog is a pgx tracer writing the executed statements to a SQL file.
+type QueryLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type queryLogKey struct{}
+
+type queryLogStart struct {
+	at   time.Time
+	sql  string
+	args []any
+}
+
+func (l *QueryLog) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryLogKey{}, queryLogStart{at: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (l *QueryLog) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryLogKey{}).(queryLogStart)
+	if !ok {
+		return
+	}
+	l.write(start, data.CommandTag.String(), data.Err)
+}
+
+func (l *QueryLog) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", data.TableName.Sanitize(), strings.Join(data.ColumnNames, ", "))
+	return context.WithValue(ctx, queryLogKey{}, queryLogStart{at: time.Now(), sql: sql})
+}
+
+func (l *QueryLog) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	start, ok := ctx.Value(queryLogKey{}).(queryLogStart)
+	if !ok {
+		return
+	}
+	l.write(start, data.CommandTag.String(), data.Err)
+}
+
+// write logs one statement as:
+//
+//	-- 2024-01-02T03:04:05.678Z (12.3ms) SELECT 42
+//	-- args: [1 2 3]
+//	SELECT ...;
+func (l *QueryLog) write(start queryLogStart, tag string, err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- %s (%s)", start.at.UTC().Format("2006-01-02T15:04:05.000Z"), time.Since(start.at).Round(time.Microsecond))
+	if err != nil {
+		fmt.Fprintf(&b, " ERROR: %s", strings.ReplaceAll(err.Error(), "\n", " "))
+	} else if tag != "" {
+		fmt.Fprintf(&b, " %s", tag)
+	}
+	b.WriteString("\n")
+	if len(start.args) > 0 {
+		fmt.Fprintf(&b, "-- args: %v\n", start.args)
+	}
+	b.WriteString(strings.TrimRight(strings.TrimSpace(start.sql), ";"))
+	b.WriteString(";\n\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+)
+
+// useTunnel makes pgx dial the database through the SSH jump host t. The
+// database host is resolved by the jump host, not locally.
+func useTunnel(cfg *pgconn.Config, t *config.SSHTunnel) error {
+	clientCfg, err := sshClientConfig(t)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	cfg.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	cfg.DialFunc = func(ctx context.Context, network, target string) (net.Conn, error) {
+		return dialTunnel(ctx, addr, clientCfg, target)
+	}
+	return nil
+}
+
+// dialTunnel opens an SSH connection to addr and, through it, a connection to
+// target. Each database connection has its own SSH connection, closed with it.
+func dialTunnel(ctx context.Context, addr string, clientCfg *ssh.ClientConfig, target string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to ssh host %s: %w", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientCfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s: %w", addr, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	remote, err := client.Dial("tcp", target)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("dialing %s through ssh host %s: %w", target, addr, err)
+	}
+	return &tunnelConn{Conn: remote, client: client}, nil
+}
+
+// tunnelConn is a connection through an SSH tunnel that closes the tunnel
+// when closed.
+type tunnelConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *tunnelConn) Close() error {
+	return errors.Join(c.Conn.Close(), c.client.Close())
+}
+
+func sshClientConfig(t *config.SSHTunnel) (*ssh.ClientConfig, error) {
+	home, _ := os.UserHomeDir()
+	keyPaths := []string{expandHome(t.Key, home)}
+	if t.Key == "" {
+		keyPaths = []string{filepath.Join(home, ".ssh", "id_ed25519"), filepath.Join(home, ".ssh", "id_rsa")}
+	}
+	var signer ssh.Signer
+	for _, path := range keyPaths {
+		key, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) && t.Key == "" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading ssh key: %w", err)
+		}
+		signer, err = ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ssh key %s: %w", path, err)
+		}
+		break
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("no ssh key found (set connection.ssh.key)")
+	}
+
+	knownHosts := expandHome(t.KnownHosts, home)
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("reading ssh known_hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+	}, nil
+}
+
+// expandHome replaces a leading ~/ of path with the home directory.
+func expandHome(path, home string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
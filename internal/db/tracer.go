@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// tracers observe every statement run on connections opened by NewPool and
+// Connect (see SetQueryLog and AddTracer).
+var tracers multiTracer
+
+// Tracer is a pgx query tracer that also traces COPY FROM.
+type Tracer interface {
+	pgx.QueryTracer
+	pgx.CopyFromTracer
+}
+
+// AddTracer makes t observe every statement run on connections opened
+// afterwards.
+func AddTracer(t Tracer) {
+	tracers = append(tracers, t)
+}
+
+// tracer returns the pgx tracer of new connections, or nil if none is set.
+func tracer() pgx.QueryTracer {
+	if len(tracers) == 0 {
+		return nil
+	}
+	return append(multiTracer(nil), tracers...)
+}
+
+// multiTracer calls each tracer in turn, threading the context through them.
+type multiTracer []Tracer
+
+func (m multiTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, t := range m {
+		ctx = t.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+func (m multiTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	for _, t := range m {
+		ctx = t.TraceCopyFromStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].TraceCopyFromEnd(ctx, conn, data)
+	}
+}
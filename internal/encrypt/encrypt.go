@@ -0,0 +1,136 @@
+// Package encrypt encrypts the output for age or OpenPGP recipients as it
+// is written, so dumps of production data are never stored in plaintext.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Recipients are the keys the output is encrypted for: all age or all
+// OpenPGP, as a file is encrypted with one of the two.
+type Recipients struct {
+	age []age.Recipient
+	pgp openpgp.EntityList
+}
+
+// ParseRecipients parses --encrypt-recipient values. Each is an age public
+// key (age1...), an SSH public key (ssh-ed25519 or ssh-rsa, encrypted with
+// age), the path of a file holding such keys one per line or an OpenPGP
+// public key (armored or binary), or the key ID, fingerprint or email of a
+// key in the local gpg keyring.
+func ParseRecipients(specs []string) (*Recipients, error) {
+	r := &Recipients{}
+	for _, spec := range specs {
+		if err := r.add(spec); err != nil {
+			return nil, fmt.Errorf("recipient %q: %w", spec, err)
+		}
+	}
+	if len(r.age) > 0 && len(r.pgp) > 0 {
+		return nil, fmt.Errorf("cannot encrypt for both age and OpenPGP recipients")
+	}
+	return r, nil
+}
+
+func (r *Recipients) add(spec string) error {
+	if ok, err := r.addAge(spec); ok || err != nil {
+		return err
+	}
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// Not a file: look the key up in the gpg keyring
+		data, err = exec.Command("gpg", "--batch", "--export", spec).Output()
+		if err != nil {
+			return fmt.Errorf("not an age key or a file, and gpg --export failed: %w", err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("not an age key or a file, and not in the gpg keyring")
+		}
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		r.pgp = append(r.pgp, keys...)
+		return nil
+	}
+	if keys, err := openpgp.ReadKeyRing(bytes.NewReader(data)); err == nil && len(keys) > 0 {
+		r.pgp = append(r.pgp, keys...)
+		return nil
+	}
+
+	// A recipients file: one age or SSH key per line, # comments
+	found := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ok, err := r.addAge(line)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s: unrecognized key %q", spec, line)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%s: no keys found", spec)
+	}
+	return nil
+}
+
+// addAge adds spec if it is an age or SSH public key.
+func (r *Recipients) addAge(spec string) (bool, error) {
+	var recipient age.Recipient
+	var err error
+	switch {
+	case strings.HasPrefix(spec, "age1"):
+		recipient, err = age.ParseX25519Recipient(spec)
+	case strings.HasPrefix(spec, "ssh-"):
+		recipient, err = agessh.ParseRecipient(spec)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	r.age = append(r.age, recipient)
+	return true, nil
+}
+
+// NewWriter returns a writer encrypting to w. Close finishes the encrypted
+// stream but does not close w.
+func (r *Recipients) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if len(r.pgp) > 0 {
+		return openpgp.Encrypt(w, r.pgp, nil, &openpgp.FileHints{IsBinary: true}, &packet.Config{})
+	}
+	return age.Encrypt(w, r.age...)
+}
+
+// TrimExt removes an encryption extension (.age, .gpg or .pgp) from path.
+func TrimExt(path string) string {
+	for _, ext := range []string{".age", ".gpg", ".pgp"} {
+		if trimmed, ok := strings.CutSuffix(path, ext); ok {
+			return trimmed
+		}
+	}
+	return path
+}
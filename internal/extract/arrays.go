@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// arrayColumns returns the indexes of the array columns of a result.
+func arrayColumns(rows pgx.Rows) []int {
+	var cols []int
+	m := rows.Conn().TypeMap()
+	for i, fd := range rows.FieldDescriptions() {
+		if t, ok := m.TypeForOID(fd.DataTypeOID); ok {
+			if _, isArray := t.Codec.(*pgtype.ArrayCodec); isArray {
+				cols = append(cols, i)
+			}
+		}
+	}
+	return cols
+}
+
+// nestArrays restores the dimensions of the multidimensional arrays of a
+// row: rows.Values flattens them into a single []any, which is replaced by
+// nested slices, one level per dimension.
+func nestArrays(rows pgx.Rows, cols []int, values []any) error {
+	raw := rows.RawValues()
+	fds := rows.FieldDescriptions()
+	for _, i := range cols {
+		if _, ok := values[i].([]any); !ok || !multidimensional(raw[i], fds[i].Format) {
+			continue
+		}
+		var arr pgtype.Array[any]
+		if err := rows.Conn().TypeMap().Scan(fds[i].DataTypeOID, fds[i].Format, raw[i], &arr); err != nil {
+			return err
+		}
+		values[i] = nest(arr.Elements, arr.Dims)
+	}
+	return nil
+}
+
+// multidimensional reports whether a raw array value has more than one
+// dimension.
+func multidimensional(raw []byte, format int16) bool {
+	if format == pgx.BinaryFormatCode {
+		return len(raw) >= 4 && binary.BigEndian.Uint32(raw) > 1
+	}
+	// text: {{...}}, or with explicit bounds [0:1][0:1]={{...}}
+	s := string(raw)
+	if strings.HasPrefix(s, "[") {
+		bounds, _, _ := strings.Cut(s, "=")
+		return strings.Count(bounds, "[") > 1
+	}
+	return strings.HasPrefix(s, "{{")
+}
+
+// nest splits the elements of an array into one slice per element of its
+// first dimension, recursively.
+func nest(elems []any, dims []pgtype.ArrayDimension) []any {
+	if len(dims) <= 1 {
+		return elems
+	}
+	n := int(dims[0].Length)
+	out := make([]any, n)
+	if n == 0 {
+		return out
+	}
+	size := len(elems) / n
+	for i := range out {
+		out[i] = nest(elems[i*size:(i+1)*size], dims[1:])
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package extract
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// TestChildBatchesTwoLargeFKs checks that a child with two FKs over
+// batch_size is queried for every combination of their batches, with no
+// more than batch_size keys per FK and NULLs matched once per FK.
+func TestChildBatchesTwoLargeFKs(t *testing.T) {
+	s, err := newSpiller(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	fkA := schema.ForeignKey{Name: "child_a_fkey", ParentSchema: "public", ParentTable: "a"}
+	fkB := schema.ForeignKey{Name: "child_b_fkey", ParentSchema: "public", ParentTable: "b"}
+	table := &schema.Table{Schema: "public", Name: "child", ForeignKeys: []schema.ForeignKey{fkA, fkB}}
+	listA, listB := &memList{}, s.newList()
+	for i := range 7 {
+		listA.add([]any{int64(i)})
+	}
+	for i := range 8 {
+		listB.add([]any{int64(100 + i)})
+	}
+	lists := func(fk schema.ForeignKey) keyList {
+		switch fk.Name {
+		case fkA.Name:
+			return listA
+		case fkB.Name:
+			return listB
+		}
+		return nil
+	}
+
+	e := &Extractor{cfg: &config.Config{BatchSize: 3}, truncated: make(map[string]bool)}
+	pairs := make(map[string]int)
+	queries, nullsA, nullsB := 0, 0, 0
+	err = e.childBatches(table, lists, func(keys parentKeys, nulls nullPolicy) error {
+		queries++
+		a, b := keys(fkA), keys(fkB)
+		if len(a) > 3 || len(b) > 3 {
+			t.Errorf("query %d: %d and %d keys, want at most 3 each", queries, len(a), len(b))
+		}
+		for _, ka := range a {
+			for _, kb := range b {
+				pairs[fmt.Sprint(ka, kb)]++
+			}
+		}
+		if mode, _ := nulls(fkA); mode != config.NullsExclude {
+			nullsA++
+		}
+		if mode, _ := nulls(fkB); mode != config.NullsExclude {
+			nullsB++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.err(); err != nil {
+		t.Fatal(err)
+	}
+	// 3 batches of A times 3 batches of B
+	if queries != 9 {
+		t.Errorf("got %d queries, want 9", queries)
+	}
+	if len(pairs) != 7*8 {
+		t.Errorf("got %d key combinations, want %d", len(pairs), 7*8)
+	}
+	for pair, n := range pairs {
+		if n != 1 {
+			t.Errorf("keys %s queried %d times, want once", pair, n)
+		}
+	}
+	// NULLs of a FK are matched with its first batch, for each batch of the other
+	if nullsA != 3 || nullsB != 3 {
+		t.Errorf("NULLs matched in %d and %d queries, want 3 and 3", nullsA, nullsB)
+	}
+}
@@ -0,0 +1,118 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// errStopRows ends a row iteration early without failing the query.
+var errStopRows = errors.New("stop fetching rows")
+
+// orderBy returns an ORDER BY clause for tables with a size budget, so the rows
+// kept within the budget are the newest ones (primary key descending by default).
+func (e *Extractor) orderBy(table *schema.Table) string {
+	tc := e.cfg.TableConfig(table.Schema, table.Name)
+	if tc.MaxBytes == 0 {
+		return ""
+	}
+	if tc.OrderBy != "" {
+		return " ORDER BY " + tc.OrderBy
+	}
+	pk := table.PKColumnNames()
+	if len(pk) == 0 {
+		return ""
+	}
+	cols := make([]string, len(pk))
+	for i, c := range pk {
+		cols[i] = schema.QuoteIdent(c) + " DESC"
+	}
+	return " ORDER BY " + strings.Join(cols, ", ")
+}
+
+// sampling returns the row limit and sample percentage for a table. Settings
+// of root, if given, override the table settings.
+func (e *Extractor) sampling(table *schema.Table, root *config.Root) (int, float64) {
+	tc := e.cfg.TableConfig(table.Schema, table.Name)
+	limit, sample := tc.Limit, tc.Sample
+	if root != nil {
+		if root.Limit > 0 {
+			limit = root.Limit
+		}
+		if root.Sample > 0 {
+			sample = root.Sample
+		}
+	}
+	return limit, sample
+}
+
+// limitClause returns a LIMIT clause for the rows still allowed by limit, and
+// false if the limit is already reached.
+func (e *Extractor) limitClause(table *schema.Table, limit int) (string, bool) {
+	if limit <= 0 {
+		return "", true
+	}
+	remaining := limit - e.rowCounts[table.FullName()]
+	if remaining <= 0 {
+		return "", false
+	}
+	return fmt.Sprintf(" LIMIT %d", remaining), true
+}
+
+// collectRow adds a row unless the table's max_bytes budget would be exceeded,
+// in which case the table is marked truncated and errStopRows is returned.
+// FK columns referencing excluded tables are handled per their policy.
+// Rows already collected (see rowKey) are skipped; if follow is set and the
+// earlier copy was collected without following children, its keys now seed
+// child lookups.
+func (e *Extractor) collectRow(table *schema.Table, values []any, follow bool) error {
+	name := table.FullName()
+	key := e.rowKey(table, values)
+	if key != nil {
+		seen, k := e.rowIndex(name), encodeKey(key)
+		if followed, ok := seen.get(k); ok {
+			e.stats.table(table).duplicates++
+			if follow && !followed {
+				seen.set(k, true)
+				if table.PrimaryKey != nil {
+					e.pkList(name).add(key)
+				}
+				e.addKeys(table, values, true)
+			}
+			return nil
+		}
+	}
+	e.applyExcludedRefs(table, values)
+
+	tc := e.cfg.TableConfig(table.Schema, table.Name)
+	if tc.MaxBytes > 0 {
+		size := output.RowSize(values)
+		if e.bytes[name]+size > int64(tc.MaxBytes) {
+			e.truncated[name] = true
+			return errStopRows
+		}
+		e.bytes[name] += size
+	}
+	if err := e.checkLimits(table); err != nil {
+		return err
+	}
+	return e.addRow(table, values, key, follow)
+}
+
+// checkLimits fails the extraction before a row is added past
+// limits.max_rows_per_table or limits.max_total_rows, which guard against
+// a mistaken filter extracting most of a large table.
+func (e *Extractor) checkLimits(table *schema.Table) error {
+	limits := e.cfg.Limits
+	if n := e.rowCounts[table.FullName()]; limits.MaxRowsPerTable > 0 && int64(n) >= limits.MaxRowsPerTable {
+		return fmt.Errorf("%s exceeds limits.max_rows_per_table (%d rows); aborting the extraction", table.FullName(), limits.MaxRowsPerTable)
+	}
+	if limits.MaxTotalRows > 0 && int64(e.total) >= limits.MaxTotalRows {
+		return fmt.Errorf("the extraction exceeds limits.max_total_rows (%d rows) at %s; aborting", limits.MaxTotalRows, table.FullName())
+	}
+	return nil
+}
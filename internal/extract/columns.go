@@ -0,0 +1,170 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/mask"
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// projection rewrites the rows of a table for output according to the
+// drop_columns and set_columns rules of its table config and the mask rules of
+// its columns. Stored generated columns are dropped, since the target computes
+// them and rejects written values. PK and FK tracking always uses the
+// original values.
+type projection struct {
+	// table is the output shape of the table (dropped columns removed)
+	table *schema.Table
+	// keep holds the source column index of each output column
+	keep []int
+	// set maps output column index → static value
+	set map[int]any
+	// mask maps output column index → mask generator
+	mask   map[int]string
+	masker *mask.Masker
+}
+
+// projection returns the output projection of a table, or nil if the table
+// has no column rules.
+func (e *Extractor) projection(table *schema.Table) (*projection, error) {
+	name := table.FullName()
+	if p, ok := e.projections[name]; ok {
+		return p, nil
+	}
+	p, err := e.buildProjection(table)
+	if err != nil {
+		return nil, err
+	}
+	e.projections[name] = p
+	return p, nil
+}
+
+func (e *Extractor) buildProjection(table *schema.Table) (*projection, error) {
+	tc := e.cfg.TableConfig(table.Schema, table.Name)
+	masks := make(map[string]string)
+	for _, col := range table.Columns {
+		if gen := e.cfg.MaskGenerator(table.Schema, table.Name, col.Name); gen != "" {
+			masks[col.Name] = gen
+		}
+	}
+	generated := false
+	for _, col := range table.Columns {
+		generated = generated || col.Generated
+	}
+	if len(tc.DropColumns) == 0 && len(tc.SetColumns) == 0 && len(masks) == 0 && !generated {
+		return nil, nil
+	}
+
+	drop := make(map[string]bool, len(tc.DropColumns))
+	for _, c := range tc.DropColumns {
+		if table.Column(c) == nil {
+			return nil, fmt.Errorf("tables.%s.drop_columns: column %q does not exist in %s", table.Name, c, table.FullName())
+		}
+		drop[c] = true
+	}
+	for c := range tc.SetColumns {
+		if table.Column(c) == nil {
+			return nil, fmt.Errorf("tables.%s.set_columns: column %q does not exist in %s", table.Name, c, table.FullName())
+		}
+	}
+
+	out := &schema.Table{
+		Schema:      table.Schema,
+		Name:        table.Name,
+		PrimaryKey:  table.PrimaryKey,
+		ForeignKeys: table.ForeignKeys,
+	}
+	p := &projection{table: out, set: make(map[int]any), mask: make(map[int]string), masker: e.masker}
+	for i, col := range table.Columns {
+		if drop[col.Name] || col.Generated {
+			continue
+		}
+		if v, ok := tc.SetColumns[col.Name]; ok {
+			p.set[len(p.keep)] = v
+		} else if gen, ok := masks[col.Name]; ok {
+			p.mask[len(p.keep)] = gen
+		}
+		p.keep = append(p.keep, i)
+		out.Columns = append(out.Columns, col)
+	}
+	if table.PrimaryKey != nil {
+		for _, c := range table.PrimaryKey.Columns {
+			if drop[c] {
+				out.PrimaryKey = nil // e.g. no ON CONFLICT target in upsert output
+				break
+			}
+		}
+	}
+	return p, nil
+}
+
+// apply returns the output row for values.
+func (p *projection) apply(values []any) []any {
+	row := make([]any, len(p.keep))
+	for i, idx := range p.keep {
+		if v, ok := p.set[i]; ok {
+			row[i] = v
+			continue
+		}
+		if gen, ok := p.mask[i]; ok {
+			row[i] = p.masker.Apply(gen, values[idx])
+			continue
+		}
+		row[i] = values[idx]
+	}
+	return row
+}
+
+// checkIdentityColumns warns about GENERATED ALWAYS identity columns when the
+// output inserts rows without OVERRIDING SYSTEM VALUE, which the target
+// rejects for them.
+func (e *Extractor) checkIdentityColumns(order []string) {
+	if e.outputOpts.Format != output.FormatUpsert || e.outputOpts.OverridingSystemValue {
+		return
+	}
+	for _, name := range order {
+		table, ok := e.g.Tables[name]
+		if !ok {
+			continue
+		}
+		if cols := table.IdentityAlways(); len(cols) > 0 {
+			e.warnf("%s: identity column %s is GENERATED ALWAYS; its INSERTs fail unless written with OVERRIDING SYSTEM VALUE",
+				table.FullName(), strings.Join(cols, ", "))
+		}
+	}
+}
+
+// checkMaskConsistency warns about relations whose two sides are masked
+// differently, since their masked values can no longer match.
+func (e *Extractor) checkMaskConsistency() {
+	if len(e.cfg.Mask) == 0 {
+		return
+	}
+	var fks []schema.ForeignKey
+	for _, edge := range e.g.Edges {
+		fks = append(fks, edge.FK)
+	}
+	for _, selfRefs := range e.g.SelfRefs {
+		fks = append(fks, selfRefs...)
+	}
+	for _, fk := range fks {
+		if fk.Virtual == schema.VirtualArray || fk.Virtual == schema.VirtualJSON {
+			continue
+		}
+		for i, childCol := range fk.ChildColumns {
+			childGen := e.cfg.MaskGenerator(fk.ChildSchema, fk.ChildTable, childCol)
+			parentGen := e.cfg.MaskGenerator(fk.ParentSchema, fk.ParentTable, fk.ParentColumns[i])
+			if childGen == parentGen {
+				if childGen != "" && !e.masker.Deterministic() {
+					e.warnf("%s: masked key columns need mask_key to stay consistent", fk.Name)
+				}
+				continue
+			}
+			e.warnf("%s: %s.%s.%s (mask %q) and %s.%s.%s (mask %q) are masked differently; references will not match",
+				fk.Name, fk.ChildSchema, fk.ChildTable, childCol, childGen,
+				fk.ParentSchema, fk.ParentTable, fk.ParentColumns[i], parentGen)
+		}
+	}
+}
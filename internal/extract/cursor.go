@@ -0,0 +1,52 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// cursorName is the cursor queryCursor declares.
+const cursorName = "db_sub_data_rows"
+
+// queryCursor runs a query through a server-side cursor in a read-only
+// transaction, fetching fetch_size rows per round trip, so neither side
+// holds more than a batch of a large result at a time and the planner
+// prefers plans returning the first rows early.
+func (e *Extractor) queryCursor(ctx context.Context, query string, args []any, fn func(values []any) error) error {
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, "DECLARE "+cursorName+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH %d FROM %s", e.cfg.FetchSize, cursorName)
+	var fetchArgs []any
+	if e.raw != nil {
+		fetchArgs = e.raw.queryArgs(nil)
+	}
+	for {
+		rows, err := tx.Query(ctx, fetch, fetchArgs...)
+		if err != nil {
+			return err
+		}
+		n, stopped, err := e.scanRows(ctx, rows, fn)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if stopped || n < e.cfg.FetchSize {
+			break
+		}
+	}
+	return tx.Commit(ctx)
+}
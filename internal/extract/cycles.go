@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// checkImmediateFKs fails an extraction whose output keeps the FK checks
+// immediate (see Extractor.immediateFKs) if the table order puts rows
+// before their parents: tables left in cycles or ordered by break_cycle:
+// order.
+func (e *Extractor) checkImmediateFKs(topo graph.TopoResult) error {
+	if !e.immediateFKs {
+		return nil
+	}
+	if topo.HasCycle {
+		return fmt.Errorf("--disable-triggers keeps the FK checks immediate, but the tables in cycles %v are written before their parents; make the FKs DEFERRABLE or break the cycles with fk_rules break_cycle: update", topo.CycleTables)
+	}
+	var broken []string
+	for _, edge := range e.g.Edges {
+		if edge.FK.Virtual == schema.VirtualNone && e.g.IsBroken(edge) && e.cfg.CycleBreak(edge.FK.Name, edge.FK.ChildSchema, edge.FK.ChildTable) == config.BreakCycleOrder {
+			broken = append(broken, edge.FK.Name)
+		}
+	}
+	if len(broken) > 0 {
+		slices.Sort(broken)
+		return fmt.Errorf("--disable-triggers keeps the FK checks immediate, but break_cycle: order writes rows before their parents via %s; use break_cycle: update or make the FKs DEFERRABLE", strings.Join(broken, ", "))
+	}
+	return nil
+}
+
+// deferredFK is a FK whose columns are written NULL and set by an UPDATE
+// after the data (fk_rules break_cycle: update), with the positions of its
+// columns and of the key identifying the rows in the output row.
+type deferredFK struct {
+	fk   schema.ForeignKey
+	cols []int
+	key  []int
+}
+
+// deferredFKs returns the FKs of table written NULL, for the output columns.
+// FKs that cannot be deferred are warned about and written as they are.
+func (e *Extractor) deferredFKs(table *schema.Table, columns []schema.Column) []deferredFK {
+	name := table.FullName()
+	if d, ok := e.deferred[name]; ok {
+		return d
+	}
+	pos := make(map[string]int, len(columns))
+	for i, c := range columns {
+		pos[c.Name] = i
+	}
+	positions := func(names []string) []int {
+		out := make([]int, len(names))
+		for i, n := range names {
+			j, ok := pos[n]
+			if !ok {
+				return nil
+			}
+			out[i] = j
+		}
+		return out
+	}
+
+	var d []deferredFK
+	for _, fk := range table.ForeignKeys {
+		if e.cfg.CycleBreak(fk.Name, fk.ChildSchema, fk.ChildTable) != config.BreakCycleUpdate {
+			continue
+		}
+		cols, key := positions(fk.ChildColumns), positions(table.KeyColumns())
+		switch {
+		case fk.Virtual == schema.VirtualSQL || fk.Virtual == schema.VirtualJSON:
+			e.warnf("%s: break_cycle: update does not apply to %s relations; written as is", fk.Name, fk.Virtual)
+		case !isFKNullable(table, fk):
+			e.warnf("%s: break_cycle: update needs nullable FK columns; written as is", fk.Name)
+		case len(cols) == 0 || len(key) == 0:
+			e.warnf("%s: break_cycle: update needs the FK columns and a primary key or unique key of %s in the output; written as is", fk.Name, name)
+		default:
+			d = append(d, deferredFK{fk: fk, cols: cols, key: key})
+		}
+	}
+	e.deferred[name] = d
+	return d
+}
+
+// deferFKs returns out with the columns of the deferred FKs of a row NULL,
+// and records the UPDATEs setting them to their values in row (the output
+// row before any conversion to wire values). out is copied, not modified.
+func (e *Extractor) deferFKs(table *schema.Table, columns []schema.Column, row, out []any) []any {
+	deferred := e.deferredFKs(table, columns)
+	if len(deferred) == 0 {
+		return out
+	}
+	out = slices.Clone(out)
+	for _, d := range deferred {
+		var set []string
+		for _, j := range d.cols {
+			if row[j] != nil {
+				set = append(set, fmt.Sprintf("%s = %s", schema.QuoteIdent(columns[j].Name), output.SQLLiteral(row[j])))
+			}
+		}
+		if set == nil {
+			continue
+		}
+		where := make([]string, len(d.key))
+		for i, j := range d.key {
+			where[i] = fmt.Sprintf("%s = %s", schema.QuoteIdent(columns[j].Name), output.SQLLiteral(row[j]))
+		}
+		e.updates = append(e.updates, fmt.Sprintf("UPDATE %s SET %s WHERE %s;",
+			table.FromName(), strings.Join(set, ", "), strings.Join(where, " AND ")))
+		for _, j := range d.cols {
+			out[j] = nil
+		}
+	}
+	return out
+}
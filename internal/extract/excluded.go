@@ -0,0 +1,90 @@
+package extract
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// excludedHit records collected rows whose FK references an excluded table.
+type excludedHit struct {
+	edge   graph.Edge
+	policy string
+	rows   int
+	pks    [][]any // sample of affected row PKs
+}
+
+// applyExcludedRefs applies the configured policy to FK columns of a row that
+// reference a table in exclude_tables. With "null" the columns are cleared in
+// place; every affected row is recorded for the report.
+func (e *Extractor) applyExcludedRefs(table *schema.Table, values []any) {
+	refs := e.excludedRefs[table.FullName()]
+	if len(refs) == 0 {
+		return
+	}
+	idx := columnIndexes(table)
+	for _, edge := range refs {
+		hasValue := false
+		for _, c := range edge.FK.ChildColumns {
+			if i, ok := idx[c]; ok && values[i] != nil {
+				hasValue = true
+				break
+			}
+		}
+		if !hasValue {
+			continue
+		}
+
+		key := edge.ChildTable + "/" + edge.FK.Name
+		hit, ok := e.excludedHits[key]
+		if !ok {
+			hit = &excludedHit{
+				edge:   edge,
+				policy: e.cfg.ExcludedParentPolicy(edge.FK.Name, table.Schema, table.Name),
+			}
+			e.excludedHits[key] = hit
+			e.excludedOrder = append(e.excludedOrder, key)
+		}
+		hit.rows++
+		if len(hit.pks) <= maxReportedValues {
+			hit.pks = append(hit.pks, e.rowKey(table, values))
+		}
+
+		if hit.policy == config.ExcludedNull {
+			for _, c := range edge.FK.ChildColumns {
+				if i, ok := idx[c]; ok {
+					values[i] = nil
+				}
+			}
+		}
+	}
+}
+
+// reportExcludedRefs prints the rows affected by FKs to excluded tables and
+// fails if any affected relation uses the "fail" policy.
+func (e *Extractor) reportExcludedRefs() error {
+	var failed []string
+	for _, key := range e.excludedOrder {
+		hit := e.excludedHits[key]
+		ref := fmt.Sprintf("%s(%s) -> %s (excluded)",
+			hit.edge.ChildTable, strings.Join(hit.edge.FK.ChildColumns, ", "), hit.edge.ParentTable)
+		switch hit.policy {
+		case config.ExcludedNull:
+			e.warnf("%s: set to NULL in %d rows, PKs: %s", ref, hit.rows, formatKeys(hit.pks))
+		case config.ExcludedFail:
+			log.Printf("ERROR: %s: referenced by %d rows, PKs: %s", ref, hit.rows, formatKeys(hit.pks))
+			failed = append(failed, hit.edge.FK.Name)
+		default:
+			e.warnf("%s: kept as-is in %d rows (load fails if the table is absent on the target), PKs: %s",
+				ref, hit.rows, formatKeys(hit.pks))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rows reference excluded tables via %s (on_excluded: fail)", strings.Join(failed, ", "))
+	}
+	return nil
+}
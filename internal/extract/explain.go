@@ -0,0 +1,232 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// explainPlan is the part of EXPLAIN (FORMAT JSON) output used for estimates.
+type explainPlan struct {
+	Plan struct {
+		Rows  float64 `json:"Plan Rows"`
+		Width float64 `json:"Plan Width"`
+		Cost  float64 `json:"Total Cost"`
+	} `json:"Plan"`
+}
+
+// estimator builds EXPLAIN-able queries for a dry run. Since no rows are
+// collected, a child query matches its parents through subqueries on their own
+// estimate queries, which are chained as CTEs named after the tables.
+type estimator struct {
+	// queries holds per table the query of the rows seeding child lookups
+	queries map[string]string
+	// deps holds per table the tables its query references
+	deps map[string][]string
+	// order is the order the queries were added in (parents first)
+	order     []string
+	rows      float64
+	bytes     float64
+	cost      float64
+	tableRows int
+	// quiet does not print the estimate of each table
+	quiet bool
+}
+
+func newEstimator() *estimator {
+	return &estimator{queries: make(map[string]string), deps: make(map[string][]string)}
+}
+
+// explain prints the planner's row and cost estimates for a table.
+func (e *Extractor) explain(ctx context.Context, table *schema.Table, root config.Root, isRoot bool) error {
+	name := table.FullName()
+	var query string
+	var deps []string
+	follow := true
+	switch {
+	case e.cfg.TableConfig(table.Schema, table.Name).CopyAll:
+		query = buildRootQuery(table, "", e.filter(table), 0) + e.orderBy(table)
+		follow = false
+	case isRoot:
+		limit, sample := e.sampling(table, &root)
+		limitClause, ok := e.limitClause(table, limit)
+		if !ok {
+			return nil
+		}
+		where, err := rootWhere(e.g, table, root)
+		if err != nil {
+			return err
+		}
+		query = buildRootQuery(table, where, e.filter(table), sample) + e.orderBy(table) + limitClause
+		follow = root.FollowsChildren()
+	default:
+		query, deps = e.estimateChildQuery(table)
+		if query == "" {
+			return nil
+		}
+	}
+
+	var out []byte
+	err := e.pool.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+e.est.with(deps, query)).Scan(&out)
+	if err != nil {
+		return fmt.Errorf("explaining %s: %w", name, err)
+	}
+	var plans []explainPlan
+	if err := json.Unmarshal(out, &plans); err != nil || len(plans) == 0 {
+		return fmt.Errorf("parsing EXPLAIN output for %s: %v", name, err)
+	}
+	plan := plans[0].Plan
+	if !e.est.quiet {
+		fmt.Printf("[explain] %s: ~%.0f rows (cost %.2f)\n", name, plan.Rows, plan.Cost)
+	}
+
+	e.est.rows += plan.Rows
+	e.est.bytes += plan.Rows * plan.Width
+	e.est.cost += plan.Cost
+	e.est.tableRows++
+	if follow {
+		e.est.queries[name] = query
+		e.est.deps[name] = deps
+		e.est.order = append(e.est.order, name)
+	}
+	return nil
+}
+
+// printEstimate prints the estimate totals.
+func (e *Extractor) printEstimate() {
+	fmt.Printf("[explain] total: ~%.0f rows in %d tables (cost %.2f); parent closure and self-references are not estimated\n",
+		e.est.rows, e.est.tableRows, e.est.cost)
+}
+
+// Estimate is the planner's estimate of an extraction, without the parent
+// closure and self-references.
+type Estimate struct {
+	Rows   float64
+	Bytes  float64 // rows times their average width
+	Tables int
+}
+
+// Estimate asks the planner for the rows the extraction will collect, as a
+// dry run with Explain does, without collecting any.
+func (e *Extractor) Estimate(ctx context.Context) (Estimate, error) {
+	saved := e.est
+	e.est = newEstimator()
+	e.est.quiet = true
+	defer func() { e.est = saved }()
+
+	roots := e.rootTables()
+	topo := graph.TopoSortAll(e.g)
+	for _, name := range append(topo.Order, topo.CycleTables...) {
+		tbl, ok := e.g.Tables[name]
+		if !ok {
+			continue
+		}
+		root, isRoot := roots[name]
+		if err := e.explain(ctx, tbl, root, isRoot); err != nil {
+			return Estimate{}, err
+		}
+	}
+	return Estimate{Rows: e.est.rows, Bytes: e.est.bytes, Tables: e.est.tableRows}, nil
+}
+
+// estimateChildQuery returns the child query of table matching the parent
+// estimate queries, and the parent tables it references.
+func (e *Extractor) estimateChildQuery(table *schema.Table) (string, []string) {
+	var conditions []string
+	var deps []string
+	poly := newPolymorphicGroups()
+	for _, fk := range table.ForeignKeys {
+		if fk.IsSelfRef {
+			continue
+		}
+		if follow, _ := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable); !follow {
+			continue
+		}
+		parent := fk.ParentSchema + "." + fk.ParentTable
+		if _, ok := e.est.queries[parent]; !ok {
+			continue
+		}
+		cte := cteName(parent)
+
+		var cond string
+		switch fk.Virtual {
+		case schema.VirtualArray:
+			cond = fmt.Sprintf("%s && ARRAY(SELECT %s FROM %s)", schema.QuoteIdent(fk.ChildColumns[0]), schema.QuoteIdent(fk.ParentColumns[0]), cte)
+		case schema.VirtualSQL:
+			cond = fmt.Sprintf("EXISTS (SELECT 1 FROM %s %s WHERE %s)", cte, sqlParentAlias, sqlCondition(table, fk))
+		case schema.VirtualJSON:
+			cond = fmt.Sprintf("%s IN (SELECT %s::%s FROM %s)",
+				jsonValue(fk), schema.QuoteIdent(fk.ParentColumns[0]), jsonCastType(fk), cte)
+		default:
+			cond = fmt.Sprintf("(%s) IN (SELECT %s FROM %s)",
+				strings.Join(schema.QuoteIdents(fk.ChildColumns), ", "), strings.Join(schema.QuoteIdents(fk.ParentColumns), ", "), cte)
+		}
+		nullCond := ""
+		if isFKNullable(table, fk) {
+			mode, limit := e.nullPolicy(fk)
+			nullCond = buildNullCondition(table, fk, mode, limit)
+		}
+		deps = append(deps, parent)
+		if fk.Virtual == schema.VirtualPolymorphic {
+			poly.add(fk, cond, nullCond)
+			continue
+		}
+		if nullCond != "" {
+			cond = fmt.Sprintf("(%s OR %s)", cond, nullCond)
+		}
+		conditions = append(conditions, cond)
+	}
+	conditions = append(conditions, poly.conditions()...)
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	limit, sample := e.sampling(table, nil)
+	limitClause, ok := e.limitClause(table, limit)
+	if !ok {
+		return "", nil
+	}
+	if filter := e.filter(table); filter != "" {
+		conditions = append(conditions, filter)
+	}
+	q := fmt.Sprintf("SELECT * FROM %s WHERE %s", fromTable(table, sample), strings.Join(conditions, " AND "))
+	return q + e.orderBy(table) + limitClause, deps
+}
+
+// with prefixes query with the CTEs of deps and everything they reference.
+func (est *estimator) with(deps []string, query string) string {
+	needed := make(map[string]bool)
+	var mark func(name string)
+	mark = func(name string) {
+		if needed[name] {
+			return
+		}
+		needed[name] = true
+		for _, d := range est.deps[name] {
+			mark(d)
+		}
+	}
+	for _, d := range deps {
+		mark(d)
+	}
+	if len(needed) == 0 {
+		return query
+	}
+
+	var ctes []string
+	for _, name := range est.order {
+		if needed[name] {
+			ctes = append(ctes, fmt.Sprintf("%s AS (%s)", cteName(name), est.queries[name]))
+		}
+	}
+	return "WITH " + strings.Join(ctes, ", ") + " " + query
+}
+
+func cteName(table string) string {
+	return `"` + strings.ReplaceAll(table, `"`, `""`) + `"`
+}
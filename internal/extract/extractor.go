@@ -2,59 +2,247 @@ package extract
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"slices"
 	"sort"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/hurou927/db-sub-data/internal/config"
 	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/mask"
 	"github.com/hurou927/db-sub-data/internal/output"
 	"github.com/hurou927/db-sub-data/internal/schema"
+	"github.com/hurou927/db-sub-data/internal/telemetry"
 )
 
+// Options controls extraction behavior.
+type Options struct {
+	Verbose bool
+	DryRun  bool
+	// Explain reports the planner's row estimate per table in dry-run mode.
+	Explain bool
+	// VerifySource re-checks every collected FK reference before output is written.
+	VerifySource bool
+	// SkipClosure disables fetching parent rows referenced by collected rows
+	// that were not reached by the traversal.
+	SkipClosure bool
+	// DDL prepends statements creating the extracted tables to the output.
+	DDL bool
+	// Types prepends statements creating the enum, domain and composite
+	// types the extracted columns use; DDL implies it.
+	Types bool
+	// StrictPK fails the extraction if a table in scope has no primary
+	// key, instead of identifying its rows by a unique key.
+	StrictPK bool
+	// FailOnEmptyRoot fails the extraction if the query of a root matches
+	// no rows, instead of warning.
+	FailOnEmptyRoot bool
+	// SpillKeys keeps at most this many keys per table in memory, spilling
+	// the collected keys past it to temporary files in SpillDir (default:
+	// the system temporary directory), so extractions collecting tens of
+	// millions of rows fit in modest memory. 0 keeps all keys in memory.
+	SpillKeys int
+	SpillDir  string
+	// RawText fetches column values in the text format and writes them as
+	// the server sent them, instead of decoding them into Go values and
+	// rendering those.
+	RawText bool
+	// Output controls the output representation.
+	Output output.Options
+	// Progress, if set, receives the progress display (usually stderr).
+	Progress io.Writer
+}
+
 // Extractor orchestrates the subset extraction process.
 type Extractor struct {
-	pool    *pgxpool.Pool
-	cfg     *config.Config
-	g       *graph.Graph
-	verbose bool
-	dryRun  bool
-
-	// collected holds extracted rows per table (full name → rows)
-	collected map[string][][]any
-	// collectedPKs holds PK values per table for child lookups
-	collectedPKs map[string][][]any
+	pool         *pgxpool.Pool
+	cfg          *config.Config
+	g            *graph.Graph
+	verbose      bool
+	dryRun       bool
+	verifySource bool
+	skipClosure  bool
+	ddl          bool
+	types        bool
+	strictPK     bool
+	failEmpty    bool
+	outputOpts   output.Options
+	throttle     *throttle
+	progress     *progress
+	// est collects EXPLAIN estimates (nil unless dry-run with Explain)
+	est *estimator
+
+	// tw receives rows as they are collected (nil in dry-run mode)
+	tw output.TableWriter
+	// projections caches the output column rules per table (nil = unchanged)
+	projections map[string]*projection
+	// current is the projection of the table being written
+	current *projection
+	masker  *mask.Masker
+	// raw fetches the values written as is (nil unless the output takes
+	// wire values)
+	raw *rawFetch
+	// readOnly is set while collecting the rows of a table that are not
+	// written (see writes)
+	readOnly bool
+	// rowCounts holds the number of collected rows per table (full name →
+	// count), and total their sum
+	rowCounts map[string]int
+	total     int
+	// seqMax holds the largest written value per owned sequence
+	seqMax map[string]int64
+	// refs holds the distinct FK values of collected rows (table → FK name → values),
+	// used to fetch missing parents and to verify references
+	refs map[string]map[string]*refSet
+	// collectedPKs holds PK values per table for child lookups. Rows collected
+	// only as parents of other rows are not included.
+	collectedPKs map[string]keyList
+	// seen indexes collected rows by key (table → encodeKey of rowKey →
+	// children followed)
+	seen map[string]keyIndex
+	// spill keeps collectedPKs, seen, keys and refs on disk past SpillKeys
+	// keys each (nil without SpillKeys)
+	spill     *spiller
+	spillKeys int
+	spillDir  string
+	// keys holds the values of the keys other than the PK that relations
+	// reference, like collectedPKs and seen (table → columns → values)
+	keys map[string]map[string]*keyValues
+	// immediateFKs is set when the output disables the user triggers but
+	// neither defers nor disables the FK checks, so parent rows must be
+	// written before the rows referencing them
+	immediateFKs bool
+	// deferred caches the FKs written NULL per table (see deferredFKs), and
+	// updates holds the UPDATEs setting them, written after the data
+	deferred map[string][]deferredFK
+	updates  []string
+	// bytes tracks COPY output size per table for max_bytes budgets
+	bytes map[string]int64
+	// truncated marks tables cut short by their max_bytes budget
+	truncated map[string]bool
+	// excludedRefs maps child full name → FK edges to excluded tables
+	excludedRefs map[string][]graph.Edge
+	// excludedHits records rows affected by excludedRefs, in first-seen order
+	excludedHits  map[string]*excludedHit
+	excludedOrder []string
+
+	// stats, warnings and the start and end time are reported by Report
+	stats    stats
+	warnings []string
+	started  time.Time
+	finished time.Time
+	// out counts the bytes written by Extract or by a TableWriter passed to
+	// ExtractTo that counts them (nil otherwise), and tableStart the count
+	// when the current output block began
+	out        byteCounter
+	tableStart int64
+	tableStats *tableStats
 }
 
 // New creates a new Extractor.
-func New(pool *pgxpool.Pool, cfg *config.Config, g *graph.Graph, verbose, dryRun bool) *Extractor {
-	return &Extractor{
+func New(pool *pgxpool.Pool, cfg *config.Config, g *graph.Graph, opts Options) *Extractor {
+	excludedRefs := make(map[string][]graph.Edge)
+	for _, edge := range g.ExcludedRefs {
+		excludedRefs[edge.ChildTable] = append(excludedRefs[edge.ChildTable], edge)
+	}
+	g.BreakCycles(cfg.BreaksCycle)
+	e := &Extractor{
 		pool:         pool,
 		cfg:          cfg,
 		g:            g,
-		verbose:      verbose,
-		dryRun:       dryRun,
-		collected:    make(map[string][][]any),
-		collectedPKs: make(map[string][][]any),
+		verbose:      opts.Verbose,
+		dryRun:       opts.DryRun,
+		verifySource: opts.VerifySource,
+		skipClosure:  opts.SkipClosure,
+		ddl:          opts.DDL,
+		types:        opts.DDL || opts.Types,
+		strictPK:     opts.StrictPK,
+		failEmpty:    opts.FailOnEmptyRoot,
+		outputOpts:   opts.Output,
+		raw:          newRawFetch(opts),
+		throttle:     newThrottle(cfg.Throttle),
+		rowCounts:    make(map[string]int),
+		seqMax:       make(map[string]int64),
+		projections:  make(map[string]*projection),
+		masker:       mask.New(cfg.MaskKey),
+		refs:         make(map[string]map[string]*refSet),
+		collectedPKs: make(map[string]keyList),
+		seen:         make(map[string]keyIndex),
+		spillKeys:    opts.SpillKeys,
+		spillDir:     opts.SpillDir,
+		keys:         referencedKeys(g),
+		deferred:     make(map[string][]deferredFK),
+		bytes:        make(map[string]int64),
+		truncated:    make(map[string]bool),
+		excludedRefs: excludedRefs,
+		excludedHits: make(map[string]*excludedHit),
+		stats:        make(stats),
 	}
+	if !opts.DryRun {
+		e.progress = newProgress(opts.Progress)
+		if e.progress != nil && e.throttle.enabled() {
+			e.progress.throttle = e.throttle
+		}
+	}
+	if opts.DryRun && opts.Explain {
+		e.est = newEstimator()
+	}
+	return e
 }
 
-// Extract performs the extraction and writes the output.
+// Extract performs the extraction and writes the output in the configured format.
 func (e *Extractor) Extract(ctx context.Context, w io.Writer) error {
-	// Build root table lookup: table name → WHERE clause
-	rootWhere := make(map[string]string)
-	for _, r := range e.cfg.Roots {
-		rootWhere[r.Table] = r.Where
+	out := &countingWriter{w: w}
+	e.out = out
+	tw, err := output.New(out, e.outputOpts)
+	if err != nil {
+		return err
+	}
+	return e.ExtractTo(ctx, tw)
+}
+
+// ExtractTo performs the extraction and streams the output to tw. Only PK and
+// FK values of collected rows are kept in memory (partly on disk with
+// SpillKeys). Rows are written per table in
+// topological order; parent rows fetched later are appended as extra blocks.
+// If the extraction fails after the header was written, no footer (COMMIT) is
+// written.
+func (e *Extractor) ExtractTo(ctx context.Context, tw output.TableWriter) error {
+	e.started = time.Now()
+	defer func() { e.finished = time.Now() }()
+	if bc, ok := tw.(byteCounter); ok && e.out == nil {
+		e.out = bc
+	}
+	defer e.progress.done()
+	if e.spillKeys > 0 {
+		s, err := newSpiller(e.spillDir, e.spillKeys)
+		if err != nil {
+			return fmt.Errorf("creating the key spill directory: %w", err)
+		}
+		e.spill = s
+		defer s.close()
 	}
 
+	roots := e.rootTables()
+
 	// Get topological order
 	topoResult := graph.TopoSortAll(e.g)
 	if topoResult.HasCycle {
-		log.Printf("WARNING: Circular dependencies detected: %v", topoResult.CycleTables)
-		log.Printf("Tables in cycles will be handled with session_replication_role = 'replica'")
+		e.warnf("Circular dependencies detected: %v", topoResult.CycleTables)
+		for _, c := range topoResult.Cycles {
+			log.Printf("  cycle: %s", c)
+			log.Printf("    hint: %s", c.Hint())
+		}
+		log.Printf("Tables in cycles rely on the output disabling or deferring the FK checks")
 	}
 
 	// Process tables in topological order (parents first)
@@ -64,57 +252,220 @@ func (e *Extractor) Extract(ctx context.Context, w io.Writer) error {
 		order = append(order, topoResult.CycleTables...)
 	}
 
-	for _, tableName := range order {
+	if err := e.checkPrimaryKeys(order); err != nil {
+		return err
+	}
+	e.checkMaskConsistency()
+	e.checkIdentityColumns(order)
+	e.checkForeignTables()
+
+	if !e.dryRun {
+		e.tw = tw
+		h, err := e.header(ctx)
+		if err != nil {
+			return err
+		}
+		// split parts commit on their own and never defer the checks
+		_, split := tw.(*output.SplitWriter)
+		e.immediateFKs = e.outputOpts.DisableTriggers && (!h.DeferConstraints || split)
+		if err := e.checkImmediateFKs(topoResult); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+	}
+
+	if err := e.extractPins(ctx); err != nil {
+		return err
+	}
+
+	for i, tableName := range order {
 		tbl, ok := e.g.Tables[tableName]
 		if !ok {
 			continue
 		}
-
-		if where, isRoot := rootWhere[tbl.Name]; isRoot {
-			if err := e.extractRoot(ctx, tbl, where); err != nil {
-				return fmt.Errorf("extracting root %s: %w", tableName, err)
-			}
-		} else if len(e.g.Parents[tableName]) > 0 {
-			if err := e.extractChild(ctx, tbl); err != nil {
-				return fmt.Errorf("extracting child %s: %w", tableName, err)
-			}
+		e.progress.table(i+1, len(order), tableName)
+		root, isRoot := roots[tableName]
+		if err := e.extractTable(ctx, tbl, root, isRoot); err != nil {
+			return err
 		}
-		// Tables with no parents and not a root: skip (isolated or no config)
+	}
 
-		// Handle self-referencing FKs
-		if selfRefs, ok := e.g.SelfRefs[tableName]; ok && len(selfRefs) > 0 {
-			if err := e.extractSelfRef(ctx, tbl, selfRefs); err != nil {
-				return fmt.Errorf("extracting self-ref %s: %w", tableName, err)
+	if !e.skipClosure {
+		if e.dryRun {
+			fmt.Println("[closure] parent rows referenced by collected rows are fetched until the set is closed")
+		} else {
+			e.progress.phase("closure")
+			if err := e.closeParents(ctx, order); err != nil {
+				return fmt.Errorf("closing parent references: %w", err)
 			}
 		}
 	}
 
 	if e.dryRun {
+		if e.est != nil {
+			e.printEstimate()
+		}
 		return nil
 	}
 
-	// Write output in topological order
-	cw := output.NewWriter(w)
-	if err := cw.WriteHeader(); err != nil {
+	for _, tableName := range order {
+		if e.truncated[tableName] {
+			tbl := e.g.Tables[tableName]
+			e.warnf("%s truncated to %d rows by max_bytes %s",
+				tableName, e.rowCounts[tableName], e.cfg.TableConfig(tbl.Schema, tbl.Name).MaxBytes)
+		}
+	}
+
+	if err := e.reportExcludedRefs(); err != nil {
 		return err
 	}
 
-	for _, tableName := range order {
-		tbl, ok := e.g.Tables[tableName]
-		if !ok {
+	if e.verifySource {
+		e.progress.phase("verify")
+		if err := e.verify(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := e.spill.err(); err != nil {
+		return err
+	}
+	return tw.WriteFooter(e.footer())
+}
+
+// extractTable collects the rows of one table in topological order, in a
+// span of its own when tracing is enabled.
+func (e *Extractor) extractTable(ctx context.Context, tbl *schema.Table, root config.Root, isRoot bool) (err error) {
+	name := tbl.FullName()
+	ctx, span := telemetry.Tracer().Start(ctx, "extract "+name,
+		trace.WithAttributes(attribute.String("db.collection.name", name), attribute.Bool("root", isRoot)))
+	defer func() {
+		span.SetAttributes(attribute.Int("rows", e.rowCounts[name]))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if err := e.beginTable(tbl); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	copyAll := e.cfg.TableConfig(tbl.Schema, tbl.Name).CopyAll
+	if e.est != nil {
+		if err := e.explain(ctx, tbl, root, isRoot); err != nil {
+			return err
+		}
+	}
+	if copyAll {
+		if err := e.extractAll(ctx, tbl); err != nil {
+			return fmt.Errorf("copying %s: %w", name, err)
+		}
+	} else if isRoot {
+		if err := e.extractRoot(ctx, tbl, root); err != nil {
+			return fmt.Errorf("extracting root %s: %w", name, err)
+		}
+		// FKs with follow: true also pull rows into root tables
+		if err := e.extractChild(ctx, tbl, e.parentLists(true)); err != nil {
+			return fmt.Errorf("extracting child %s: %w", name, err)
+		}
+	} else if len(e.g.Parents[name]) > 0 {
+		if err := e.extractChild(ctx, tbl, e.parentLists(false)); err != nil {
+			return fmt.Errorf("extracting child %s: %w", name, err)
+		}
+	}
+	// Tables with no parents and not a root: skip (isolated or no config)
+
+	// Handle self-referencing FKs
+	if selfRefs, ok := e.g.SelfRefs[name]; ok && len(selfRefs) > 0 && !copyAll {
+		if err := e.extractSelfRef(ctx, tbl, selfRefs); err != nil {
+			return fmt.Errorf("extracting self-ref %s: %w", name, err)
+		}
+	}
+	if err := e.endTable(); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+
+	if isRoot && root.FollowsParents() {
+		if e.dryRun {
+			fmt.Printf("[parents] %s: referenced parent rows are fetched transitively\n", name)
+		} else if err := e.walkParents(ctx, tbl, e.refs[name]); err != nil {
+			return fmt.Errorf("extracting parents of root %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// header describes the extraction scope and its source schema fingerprint,
+// with the DDL of the tables and their types if requested.
+func (e *Extractor) header(ctx context.Context) (output.Header, error) {
+	names := make([]string, 0, len(e.g.Tables))
+	tables := make([]*schema.Table, 0, len(e.g.Tables))
+	for name, tbl := range e.g.Tables {
+		if !e.writes(tbl) {
 			continue
 		}
-		rows := e.collected[tableName]
-		if err := cw.WriteTableData(tbl, rows); err != nil {
-			return fmt.Errorf("writing %s: %w", tableName, err)
+		names = append(names, name)
+		tables = append(tables, tbl)
+	}
+	sort.Strings(names)
+	h := output.Header{
+		Tables:            names,
+		SchemaFingerprint: schema.Fingerprint(tables),
+		DeferConstraints:  deferrable(tables),
+	}
+	if e.types {
+		types, err := schema.TypeDDL(ctx, e.pool, tables)
+		if err != nil {
+			return h, fmt.Errorf("generating type DDL: %w", err)
+		}
+		h.Types = types
+	}
+	if e.ddl {
+		ddl, err := schema.DDL(ctx, e.pool, tables)
+		if err != nil {
+			return h, fmt.Errorf("generating DDL: %w", err)
 		}
+		h.DDL = ddl
 	}
+	return h, nil
+}
 
-	return cw.WriteFooter()
+// deferrable reports whether the written tables have FK constraints and all
+// of them are deferrable, so the output can defer their checks to COMMIT
+// instead of switching session_replication_role. Without any FK there is
+// nothing to defer and the output keeps session_replication_role.
+func deferrable(tables []*schema.Table) bool {
+	found := false
+	for _, tbl := range tables {
+		for _, fk := range tbl.ForeignKeys {
+			if fk.Virtual != schema.VirtualNone {
+				continue
+			}
+			if !fk.Deferrable {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
 }
 
-func (e *Extractor) extractRoot(ctx context.Context, table *schema.Table, where string) error {
-	query := buildRootQuery(table, where)
+// extractRoot collects the root rows. With direction parents the root rows do
+// not seed child lookups.
+func (e *Extractor) extractRoot(ctx context.Context, table *schema.Table, root config.Root) error {
+	limit, sample := e.sampling(table, &root)
+	limitClause, ok := e.limitClause(table, limit)
+	if !ok {
+		return nil
+	}
+	where, err := rootWhere(e.g, table, root)
+	if err != nil {
+		return err
+	}
+	query := buildRootQuery(table, where, e.filter(table), sample) + e.orderBy(table) + limitClause
 
 	if e.verbose || e.dryRun {
 		fmt.Printf("[root] %s: %s\n", table.FullName(), query)
@@ -123,31 +474,176 @@ func (e *Extractor) extractRoot(ctx context.Context, table *schema.Table, where
 		return nil
 	}
 
-	rows, err := e.pool.Query(ctx, query)
+	follow := root.FollowsChildren()
+	matched := 0
+	err = e.forEachRow(ctx, table, query, nil, func(values []any) error {
+		matched++
+		return e.collectRow(table, values, follow)
+	})
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	if matched == 0 {
+		// almost always a mistake in the WHERE clause rather than intended
+		msg := fmt.Sprintf("root %s matched no rows", table.FullName())
+		if where != "" {
+			msg += fmt.Sprintf(" (where: %s)", where)
+		}
+		if e.failEmpty {
+			return fmt.Errorf("%s (--fail-on-empty-root)", msg)
+		}
+		e.warnf("%s", msg)
+	}
+	e.logRowCount(table)
+	return nil
+}
 
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return err
+// extractAll collects all rows of a copy_all table. The rows do not seed
+// child lookups.
+func (e *Extractor) extractAll(ctx context.Context, table *schema.Table) error {
+	query := buildRootQuery(table, "", e.filter(table), 0) + e.orderBy(table)
+	if e.verbose || e.dryRun {
+		fmt.Printf("[copy_all] %s: %s\n", table.FullName(), query)
+	}
+	if e.dryRun {
+		return nil
+	}
+	err := e.forEachRow(ctx, table, query, nil, func(values []any) error {
+		return e.collectRow(table, values, false)
+	})
+	if err != nil {
+		return err
+	}
+	e.logRowCount(table)
+	return nil
+}
+
+// extractChild collects the child rows referencing collected parent rows (see
+// childBatches).
+func (e *Extractor) extractChild(ctx context.Context, table *schema.Table, lists parentLists) error {
+	queried := false
+	err := e.childBatches(table, lists, func(keys parentKeys, nulls nullPolicy) error {
+		queried = true
+		return e.queryChild(ctx, table, keys, nulls)
+	})
+	if err != nil || !queried {
+		return err
+	}
+	e.logRowCount(table)
+	return nil
+}
+
+// childBatches calls query with the keys and NULL policies of the queries
+// collecting the child rows of table, none if no FK has keys. The keys of
+// each FK with more than batch_size keys are split into batches, read a
+// batch at a time, and a query runs for every combination of the batches
+// of those FKs; rows with a NULL in such a FK are matched by its first
+// batch only. The keys of the other FKs, at most batch_size each, go whole
+// into every query. Queries stop early once table is truncated.
+func (e *Extractor) childBatches(table *schema.Table, lists parentLists, query func(keys parentKeys, nulls nullPolicy) error) error {
+	count := func(fk schema.ForeignKey) int {
+		if l := lists(fk); l != nil {
+			return l.len()
+		}
+		return 0
+	}
+	if !hasKeys(table, count) {
+		return nil
+	}
+
+	batchSize := e.batchSize()
+	var split []schema.ForeignKey
+	whole := make(map[string][][]any)
+	for _, fk := range table.ForeignKeys {
+		if fk.IsSelfRef {
+			continue
+		}
+		if n := count(fk); n > batchSize {
+			split = append(split, fk)
+		} else if n > 0 {
+			whole[fk.Name] = allKeys(lists(fk))
+		}
+	}
+	sort.SliceStable(split, func(i, j int) bool { return count(split[i]) > count(split[j]) })
+
+	batch := make(map[string][][]any, len(split))
+	first := make(map[string]bool, len(split))
+	keys := func(fk schema.ForeignKey) [][]any {
+		if b, ok := batch[fk.Name]; ok {
+			return b
+		}
+		return whole[fk.Name]
+	}
+	nulls := func(fk schema.ForeignKey) (string, int) {
+		if _, ok := batch[fk.Name]; ok && !first[fk.Name] {
+			return config.NullsExclude, 0
+		}
+		return e.nullPolicy(fk)
+	}
+	// run queries the combinations of the batches of split[i:]
+	var run func(i int) error
+	run = func(i int) error {
+		if i == len(split) {
+			return query(keys, nulls)
+		}
+		fk, total, start := split[i], count(split[i]), 0
+		return lists(fk).batches(batchSize, func(b [][]any) error {
+			batch[fk.Name], first[fk.Name] = b, start == 0
+			if e.verbose {
+				fmt.Printf("  [batch] %s: keys %d-%d of %d via %s\n", table.FullName(), start+1, start+len(b), total, fk.Name)
+			}
+			start += len(b)
+			if err := run(i + 1); err != nil {
+				return err
+			}
+			if e.truncated[table.FullName()] {
+				return errStopKeys
+			}
+			return nil
+		})
+	}
+	if err := run(0); err != nil && !errors.Is(err, errStopKeys) {
+		return err
+	}
+	return nil
+}
+
+// parentLists returns the collected parent keys to match per FK, honoring
+// the follow setting of fk_rules. With forcedOnly, only FKs with follow:
+// true are matched. FKs referencing copy_all tables are not matched, since
+// every parent row is extracted.
+func (e *Extractor) parentLists(forcedOnly bool) parentLists {
+	return func(fk schema.ForeignKey) keyList {
+		follow, forced := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable)
+		if !follow || (forcedOnly && !forced) || e.cfg.TableConfig(fk.ParentSchema, fk.ParentTable).CopyAll {
+			return nil
 		}
-		e.addRow(table, values)
+		return e.parentList(fk)
 	}
+}
 
-	if e.verbose {
-		fmt.Printf("  -> %d rows\n", len(e.collected[table.FullName()]))
+// hasKeys reports whether any non-self-referencing FK of table has keys.
+func hasKeys(table *schema.Table, count func(fk schema.ForeignKey) int) bool {
+	for _, fk := range table.ForeignKeys {
+		if !fk.IsSelfRef && count(fk) > 0 {
+			return true
+		}
 	}
-	return rows.Err()
+	return false
 }
 
-func (e *Extractor) extractChild(ctx context.Context, table *schema.Table) error {
-	query, args := buildChildQuery(table, nil, e.collectedPKs)
+// queryChild runs one child query and collects its rows.
+func (e *Extractor) queryChild(ctx context.Context, table *schema.Table, keys parentKeys, nulls nullPolicy) error {
+	limit, sample := e.sampling(table, nil)
+	limitClause, ok := e.limitClause(table, limit)
+	if !ok {
+		return nil
+	}
+	query, args := buildChildQuery(table, keys, nulls, e.filter(table), sample)
 	if query == "" {
 		return nil
 	}
+	query += e.orderBy(table) + limitClause
 
 	if e.verbose || e.dryRun {
 		fmt.Printf("[child] %s: %s\n", table.FullName(), query)
@@ -159,117 +655,340 @@ func (e *Extractor) extractChild(ctx context.Context, table *schema.Table) error
 		return nil
 	}
 
+	var active []schema.ForeignKey
+	for _, fk := range table.ForeignKeys {
+		if !fk.IsSelfRef && len(keys(fk)) > 0 {
+			e.stats.followed(table, fk.Name)
+			active = append(active, fk)
+		}
+	}
+	name := table.FullName()
+	return e.forEachRow(ctx, table, query, args, func(values []any) error {
+		before := e.rowCounts[name]
+		if err := e.collectRow(table, values, true); err != nil {
+			return err
+		}
+		if e.rowCounts[name] > before {
+			e.attributeRow(table, active, values)
+		}
+		return nil
+	})
+}
+
+// batchSize returns the maximum number of parent keys per query.
+func (e *Extractor) batchSize() int {
+	if e.cfg.BatchSize > 0 {
+		return e.cfg.BatchSize
+	}
+	return config.DefaultBatchSize
+}
+
+// nullPolicy resolves the configured nullable FK policy for a FK.
+func (e *Extractor) nullPolicy(fk schema.ForeignKey) (string, int) {
+	return e.cfg.NullFKPolicy(fk.Name, fk.ChildSchema, fk.ChildTable)
+}
+
+// forEachRow runs a query on table through the throttle and calls fn for
+// every row. A query failing transiently is retried (see withRetry); fn may
+// then see the rows of a failed attempt again, which are skipped as collected.
+// A query on a table whose rows can't all be identified (see identifiable)
+// is not retried once it passed rows on, since they would be written twice.
+func (e *Extractor) forEachRow(ctx context.Context, table *schema.Table, query string, args []any, fn func(values []any) error) error {
+	start := time.Now()
+	err := e.withRetry(ctx, identifiable(table), func() (bool, error) {
+		e.stats.query(table)
+		delivered := false
+		err := e.queryRows(ctx, query, args, func(values []any) error {
+			delivered = true
+			return fn(values)
+		})
+		return delivered, err
+	})
+	e.stats.table(table).duration += time.Since(start)
+	if err == nil {
+		err = e.spill.err()
+	}
+	if err != nil {
+		return err
+	}
+	return e.throttle.afterQuery(ctx)
+}
+
+// queryRows runs a query once and calls fn for every row. With fetch_size
+// the rows are fetched through a cursor (see queryCursor).
+func (e *Extractor) queryRows(ctx context.Context, query string, args []any, fn func(values []any) error) error {
+	if e.cfg.FetchSize > 0 {
+		return e.queryCursor(ctx, query, args, fn)
+	}
+	if e.raw != nil {
+		args = e.raw.queryArgs(args)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	rows, err := e.pool.Query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
+	if _, _, err = e.scanRows(ctx, rows, fn); err != nil {
+		// a failed query is cancelled rather than read to its end by Close
+		cancel()
+	}
+	return err
+}
+
+// scanRows calls fn for every row of rows, returning the number of rows
+// read and whether fn stopped the query with errStopRows.
+func (e *Extractor) scanRows(ctx context.Context, rows pgx.Rows, fn func(values []any) error) (int, bool, error) {
+	if e.raw != nil {
+		e.raw.begin(rows)
+	}
+	arrays := arrayColumns(rows)
 
+	n := 0
 	for rows.Next() {
+		n++
 		values, err := rows.Values()
 		if err != nil {
-			return err
+			return n, false, err
+		}
+		if len(arrays) > 0 {
+			if err := nestArrays(rows, arrays, values); err != nil {
+				return n, false, err
+			}
+		}
+		if e.outputOpts.UTC {
+			toUTC(values)
+		}
+		if e.raw != nil {
+			e.raw.next(rows, values)
+		}
+		if err := fn(values); errors.Is(err, errStopRows) {
+			return n, true, nil
+		} else if err != nil {
+			return n, false, &callbackError{err}
+		}
+		if err := e.throttle.row(ctx); err != nil {
+			return n, false, err
 		}
-		e.addRow(table, values)
 	}
+	return n, false, rows.Err()
+}
 
-	if e.verbose {
-		fmt.Printf("  -> %d rows\n", len(e.collected[table.FullName()]))
+// logRowCount prints the collected row count (and throttle state) in verbose mode.
+func (e *Extractor) logRowCount(table *schema.Table) {
+	if !e.verbose {
+		return
 	}
-	return rows.Err()
+	if e.throttle.enabled() {
+		fmt.Printf("  -> %d rows (%s)\n", e.rowCounts[table.FullName()], e.throttle)
+		return
+	}
+	fmt.Printf("  -> %d rows\n", e.rowCounts[table.FullName()])
 }
 
 func (e *Extractor) extractSelfRef(ctx context.Context, table *schema.Table, selfRefs []schema.ForeignKey) error {
-	seedPKs := e.collectedPKs[table.FullName()]
-	if len(seedPKs) == 0 {
-		return nil
-	}
-
+	batchSize := e.batchSize()
 	for _, fk := range selfRefs {
-		extraRows, err := fetchSelfRefRows(ctx, e.pool, table, fk, seedPKs, e.verbose || e.dryRun)
-		if err != nil {
-			return err
+		if follow, _ := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable); !follow {
+			continue
 		}
-
-		// Add new rows (avoid duplicates by PK)
-		existing := e.pkSet(table)
-		for _, row := range extraRows {
-			pkVals := e.extractPK(table, row)
-			key := fmt.Sprintf("%v", pkVals)
-			if !existing[key] {
-				e.addRow(table, row)
-				existing[key] = true
+		if seeds := e.parentList(fk); seeds != nil {
+			err := seeds.batches(batchSize, func(batch [][]any) error {
+				return e.fetchSelfRefRows(ctx, table, fk, batch)
+			})
+			if err != nil {
+				return err
 			}
 		}
-
 		if e.verbose {
 			fmt.Printf("  [self-ref] %s: total %d rows after recursive\n",
-				table.FullName(), len(e.collected[table.FullName()]))
+				table.FullName(), e.rowCounts[table.FullName()])
 		}
 	}
 	return nil
 }
 
-func (e *Extractor) addRow(table *schema.Table, values []any) {
+// addRow writes a row and records its key (see rowKey) and FK values. With
+// follow, its keys seed lookups of child tables.
+func (e *Extractor) addRow(table *schema.Table, values, key []any, follow bool) error {
 	fullName := table.FullName()
-	e.collected[fullName] = append(e.collected[fullName], values)
+	if e.tw != nil && !e.readOnly {
+		row, columns := values, table.Columns
+		if e.current != nil {
+			row, columns = e.current.apply(values), e.current.table.Columns
+		}
+		out := row
+		if e.raw != nil {
+			var err error
+			if out, err = e.raw.output(e.current, values, row); err != nil {
+				return fmt.Errorf("writing %s: %w", fullName, err)
+			}
+		}
+		out = e.deferFKs(table, columns, row, out)
+		if err := e.tw.WriteRow(out); err != nil {
+			return fmt.Errorf("writing %s: %w", fullName, err)
+		}
+		e.trackSequences(columns, row)
+	}
+	e.rowCounts[fullName]++
+	e.total++
+	e.progress.row()
+	e.addRefs(e.tableRefs(fullName), table, values)
+	e.addKeys(table, values, follow)
 
-	// Extract and store PK values for child lookups
-	pkVals := e.extractPK(table, values)
-	if pkVals != nil {
-		e.collectedPKs[fullName] = append(e.collectedPKs[fullName], pkVals)
+	if key == nil {
+		return nil
+	}
+	e.rowIndex(fullName).set(encodeKey(key), follow)
+	if follow && table.PrimaryKey != nil {
+		e.pkList(fullName).add(key)
 	}
+	return nil
 }
 
-func (e *Extractor) extractPK(table *schema.Table, values []any) []any {
-	if table.PrimaryKey == nil {
+// beginTable starts an output block for table.
+func (e *Extractor) beginTable(table *schema.Table) error {
+	e.readOnly = !e.writes(table)
+	if e.tw == nil || e.readOnly {
 		return nil
 	}
+	p, err := e.projection(table)
+	if err != nil {
+		return err
+	}
+	e.current = p
+	e.tableStats = e.stats.table(table)
+	if e.out != nil {
+		e.tableStart = e.out.Written()
+	}
+	if p != nil {
+		return e.tw.BeginTable(p.table)
+	}
+	return e.tw.BeginTable(table)
+}
+
+// endTable ends the current output block.
+func (e *Extractor) endTable() error {
+	if e.tw == nil || e.readOnly {
+		return nil
+	}
+	err := e.tw.EndTable()
+	if e.out != nil {
+		e.tableStats.bytes += e.out.Written() - e.tableStart
+	}
+	return err
+}
+
+// RowCounts returns the number of extracted rows per table.
+func (e *Extractor) RowCounts() map[string]int {
+	counts := make(map[string]int, len(e.rowCounts))
+	for name, n := range e.rowCounts {
+		counts[name] = n
+	}
+	return counts
+}
+
+// totalRows returns the number of collected rows over all tables.
+func (e *Extractor) totalRows() int {
+	return e.total
+}
+
+// isCollected reports whether a row with the same key was already collected.
+func (e *Extractor) isCollected(table *schema.Table, values []any) bool {
+	key := e.rowKey(table, values)
+	if key == nil {
+		return false
+	}
+	_, ok := e.rowIndex(table.FullName()).get(encodeKey(key))
+	return ok
+}
 
-	pkIdxs := e.pkColumnIndexes(table)
-	pk := make([]any, len(pkIdxs))
-	for i, idx := range pkIdxs {
-		if idx < len(values) {
-			pk[i] = values[idx]
+// rowKey returns the values identifying a row among the collected rows of
+// its table: its primary key or, for a table without one, its first unique
+// key without NULLs. It returns nil for a row neither identifies; such rows
+// are never deduplicated, as identical rows of a heap table are distinct.
+func (e *Extractor) rowKey(table *schema.Table, values []any) []any {
+	keys := table.UniqueKeys
+	if table.PrimaryKey != nil {
+		keys = [][]string{table.PrimaryKey.Columns}
+	}
+	idx := columnIndexes(table)
+	for _, cols := range keys {
+		if key := keyOf(idx, cols, values); key != nil {
+			return key
 		}
 	}
-	return pk
+	return nil
 }
 
-func (e *Extractor) pkColumnIndexes(table *schema.Table) []int {
-	if table.PrimaryKey == nil {
-		return nil
+// identifiable reports whether rowKey identifies every row of table: it has
+// a primary key or a unique key over NOT NULL columns.
+func identifiable(table *schema.Table) bool {
+	if table.PrimaryKey != nil {
+		return true
 	}
-	colIdx := make(map[string]int)
-	for i, col := range table.Columns {
-		colIdx[col.Name] = i
+	nullable := make(map[string]bool, len(table.Columns))
+	for _, c := range table.Columns {
+		nullable[c.Name] = c.Nullable
 	}
-	idxs := make([]int, len(table.PrimaryKey.Columns))
-	for i, col := range table.PrimaryKey.Columns {
-		idxs[i] = colIdx[col]
+	for _, cols := range table.UniqueKeys {
+		if !slices.ContainsFunc(cols, func(c string) bool { return nullable[c] }) {
+			return true
+		}
 	}
-	return idxs
+	return false
 }
 
-func (e *Extractor) pkSet(table *schema.Table) map[string]bool {
-	set := make(map[string]bool)
-	for _, row := range e.collected[table.FullName()] {
-		pk := e.extractPK(table, row)
-		set[fmt.Sprintf("%v", pk)] = true
+// attributeRow counts a collected child row for each FK of active through
+// which it references a collected parent row. Rows matched through none
+// (a NULL FK, or a json or sql relation) are counted under "".
+func (e *Extractor) attributeRow(table *schema.Table, active []schema.ForeignKey, values []any) {
+	ts := e.stats.table(table)
+	if ts.fkRows == nil {
+		ts.fkRows = make(map[string]int)
+	}
+	idx := columnIndexes(table)
+	matched := false
+	for _, fk := range active {
+		if !e.tracksRefs(fk) {
+			continue
+		}
+		seen := e.parentSeen(fk)
+		for _, key := range refKeys(fk, idx, values) {
+			if followed, _ := seen.get(encodeKey(key)); followed {
+				ts.fkRows[fk.Name]++
+				matched = true
+				break
+			}
+		}
+	}
+	if !matched {
+		ts.fkRows[""]++
 	}
-	return set
 }
 
 // CollectedSummary returns a summary of collected rows for reporting.
 func (e *Extractor) CollectedSummary() []string {
 	var lines []string
-	keys := make([]string, 0, len(e.collected))
-	for k := range e.collected {
+	keys := make([]string, 0, len(e.rowCounts))
+	for k := range e.rowCounts {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 	for _, k := range keys {
-		lines = append(lines, fmt.Sprintf("  %s: %d rows", k, len(e.collected[k])))
+		line := fmt.Sprintf("  %s: %d rows", k, e.rowCounts[k])
+		if e.truncated[k] {
+			tbl := e.g.Tables[k]
+			line += fmt.Sprintf(" (truncated by max_bytes %s)", e.cfg.TableConfig(tbl.Schema, tbl.Name).MaxBytes)
+		}
+		lines = append(lines, line)
+		if ts := e.stats[k]; ts != nil {
+			lines = append(lines, fkRowLines(ts.fkRows)...)
+			if ts.duplicates > 0 {
+				lines = append(lines, fmt.Sprintf("    duplicates skipped: %d rows", ts.duplicates))
+			}
+		}
 	}
 	return lines
 }
@@ -0,0 +1,27 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// filter returns the condition ANDed into the root, child, self-reference and
+// copy_all queries of table, or "" if none applies: with a tenant, tables
+// having the tenant column only yield the tenant's rows, and each global
+// filter applies to the tables having its column. Parent rows fetched to
+// satisfy FKs are not filtered.
+func (e *Extractor) filter(table *schema.Table) string {
+	var conds []string
+	if t := e.cfg.Tenant; t != nil && table.Column(t.Column) != nil {
+		conds = append(conds, fmt.Sprintf("%s = %s", schema.QuoteIdent(t.Column), output.SQLLiteral(t.Value)))
+	}
+	for _, f := range e.cfg.GlobalFilters {
+		if table.Column(f.Column) != nil {
+			conds = append(conds, "("+f.Predicate+")")
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
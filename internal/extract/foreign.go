@@ -0,0 +1,37 @@
+package extract
+
+import (
+	"sort"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// writes reports whether the rows of table are written to the output: not
+// those of foreign tables under foreign_tables: read, which are traversed
+// only, their rows seeding lookups like the rows of other tables.
+func (e *Extractor) writes(table *schema.Table) bool {
+	return !table.Foreign || e.cfg.ForeignTables != config.ForeignRead
+}
+
+// checkForeignTables warns about the relations to and from the foreign
+// tables skipped under foreign_tables: skip, which are not followed.
+func (e *Extractor) checkForeignTables() {
+	skipped := make(map[string]bool)
+	for _, vr := range e.cfg.Relations() {
+		for _, name := range []string{vr.ChildTable, vr.ParentTable} {
+			key, _ := config.ResolveTable(e.g.Excluded, name)
+			if t := e.g.Excluded[key]; t != nil && t.Foreign {
+				skipped[key] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.warnf("%s is a foreign table and skipped with its relations; set foreign_tables to read or include to traverse it", name)
+	}
+}
@@ -0,0 +1,120 @@
+package extract
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// encodeKey returns the canonical encoding of a key tuple, which indexes
+// collected rows and FK values. Each value is written with a tag of its kind
+// and a length where it varies, so values of different kinds (a bytea and a
+// text, or a NULL and the string "<nil>") never collide, and values the
+// server compares as equal encode the same across the Go types pgx decodes
+// related column types to: integers of any width, float4 and float8,
+// timestamps of any location, and numerics of any scale (1.50 and 1.5).
+func encodeKey(key []any) string {
+	var b []byte
+	for _, v := range key {
+		b = appendKeyValue(b, v)
+	}
+	return string(b)
+}
+
+func appendKeyValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 'N')
+	case string:
+		return appendKeyBytes(append(b, 's'), []byte(v))
+	case []byte:
+		return appendKeyBytes(append(b, 'b'), v)
+	case bool:
+		if v {
+			return append(b, 't')
+		}
+		return append(b, 'f')
+	case int:
+		return appendKeyInt(b, int64(v))
+	case int8:
+		return appendKeyInt(b, int64(v))
+	case int16:
+		return appendKeyInt(b, int64(v))
+	case int32:
+		return appendKeyInt(b, int64(v))
+	case int64:
+		return appendKeyInt(b, v)
+	case uint8:
+		return appendKeyInt(b, int64(v))
+	case uint16:
+		return appendKeyInt(b, int64(v))
+	case uint32:
+		return appendKeyInt(b, int64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return appendKeyBytes(append(b, 'u'), []byte(fmt.Sprint(v)))
+		}
+		return appendKeyInt(b, int64(v))
+	case float32:
+		return binary.BigEndian.AppendUint64(append(b, 'd'), math.Float64bits(float64(v)))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 'd'), math.Float64bits(v))
+	case time.Time:
+		return binary.BigEndian.AppendUint64(append(b, 'T'), uint64(v.UnixMicro()))
+	case [16]byte:
+		return append(append(b, 'U'), v[:]...)
+	case pgtype.Numeric:
+		return appendKeyNumeric(b, v)
+	}
+	// other types by their Go type and formatting
+	return appendKeyBytes(append(b, 'v'), []byte(fmt.Sprintf("%T %v", v, v)))
+}
+
+func appendKeyBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendKeyInt(b []byte, v int64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 'i'), uint64(v))
+}
+
+// appendKeyNumeric writes a numeric without its trailing zeros, so numerics
+// of the same value and different scales are equal; an integral numeric
+// equals the integer.
+func appendKeyNumeric(b []byte, n pgtype.Numeric) []byte {
+	switch {
+	case !n.Valid:
+		return append(b, 'N')
+	case n.NaN:
+		return append(b, 'n', 'N')
+	case n.InfinityModifier == pgtype.Infinity:
+		return append(b, 'n', '+')
+	case n.InfinityModifier == pgtype.NegativeInfinity:
+		return append(b, 'n', '-')
+	}
+	i, exp := new(big.Int).Set(n.Int), n.Exp
+	ten, rem := big.NewInt(10), new(big.Int)
+	for i.Sign() != 0 {
+		q, r := new(big.Int).QuoRem(i, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		i, exp = q, exp+1
+	}
+	if i.Sign() == 0 {
+		exp = 0
+	}
+	if exp >= 0 && exp < 19 {
+		if v := new(big.Int).Mul(i, new(big.Int).Exp(ten, big.NewInt(int64(exp)), nil)); v.IsInt64() {
+			return appendKeyInt(b, v.Int64())
+		}
+	}
+	b = binary.BigEndian.AppendUint32(append(b, 'n'), uint32(exp))
+	text, _ := i.MarshalText()
+	return appendKeyBytes(b, text)
+}
@@ -0,0 +1,141 @@
+package extract
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// keyValues holds the values of a key over the collected rows of a table,
+// for a key other than the primary key that relations reference (usually a
+// unique key).
+type keyValues struct {
+	cols []string
+	// seen indexes the collected rows by key, and follow holds the keys of
+	// the rows seeding child lookups; both are created with the first key
+	seen   keyIndex
+	follow keyList
+}
+
+// referencedKeys returns the keys other than the primary key referenced by
+// the relations of g, by table and columns. Relations referencing the
+// primary key columns in another order are tracked as another key.
+func referencedKeys(g *graph.Graph) map[string]map[string]*keyValues {
+	keys := make(map[string]map[string]*keyValues)
+	for _, tbl := range g.Tables {
+		for _, fk := range tbl.ForeignKeys {
+			name := fk.ParentSchema + "." + fk.ParentTable
+			parent, ok := g.Tables[name]
+			if !ok || referencesPK(parent, fk) {
+				continue
+			}
+			if keys[name] == nil {
+				keys[name] = make(map[string]*keyValues)
+			}
+			col := columnsKey(fk.ParentColumns)
+			if keys[name][col] == nil {
+				keys[name][col] = &keyValues{cols: fk.ParentColumns}
+			}
+		}
+	}
+	return keys
+}
+
+// referencesPK reports whether fk references the primary key of parent, in
+// the order of its columns.
+func referencesPK(parent *schema.Table, fk schema.ForeignKey) bool {
+	pk := parent.PKColumnNames()
+	return len(pk) > 0 && slices.Equal(pk, fk.ParentColumns)
+}
+
+func columnsKey(cols []string) string {
+	return strings.Join(cols, ",")
+}
+
+// addKeys records the referenced keys of a collected row. Keys with a NULL
+// match no reference and are not recorded.
+func (e *Extractor) addKeys(table *schema.Table, values []any, follow bool) {
+	keys := e.keys[table.FullName()]
+	if len(keys) == 0 {
+		return
+	}
+	idx := columnIndexes(table)
+	for _, kv := range keys {
+		key := keyOf(idx, kv.cols, values)
+		if key == nil {
+			continue
+		}
+		if kv.seen == nil {
+			kv.seen, kv.follow = e.newIndex(), e.newList()
+		}
+		k := encodeKey(key)
+		if followed, ok := kv.seen.get(k); ok && (followed || !follow) {
+			continue
+		}
+		kv.seen.set(k, follow)
+		if follow {
+			kv.follow.add(key)
+		}
+	}
+}
+
+// keyOf returns the values of cols in a row, or nil if one is NULL.
+func keyOf(idx map[string]int, cols []string, values []any) []any {
+	key := make([]any, len(cols))
+	for i, c := range cols {
+		j, ok := idx[c]
+		if !ok || j >= len(values) || values[j] == nil {
+			return nil
+		}
+		key[i] = values[j]
+	}
+	return key
+}
+
+// parentList returns the keys of the collected parent rows of fk seeding
+// child lookups, in the order of fk's parent columns, or nil if there are
+// none.
+func (e *Extractor) parentList(fk schema.ForeignKey) keyList {
+	name := fk.ParentSchema + "." + fk.ParentTable
+	if parent, ok := e.g.Tables[name]; ok && referencesPK(parent, fk) {
+		return e.collectedPKs[name]
+	}
+	if kv := e.keys[name][columnsKey(fk.ParentColumns)]; kv != nil && kv.follow != nil {
+		return kv.follow
+	}
+	return nil
+}
+
+// parentSeen indexes the collected parent rows of fk by the columns fk
+// references (key → children followed).
+func (e *Extractor) parentSeen(fk schema.ForeignKey) keyIndex {
+	name := fk.ParentSchema + "." + fk.ParentTable
+	if parent, ok := e.g.Tables[name]; ok && referencesPK(parent, fk) {
+		return e.rowIndex(name)
+	}
+	if kv := e.keys[name][columnsKey(fk.ParentColumns)]; kv != nil && kv.seen != nil {
+		return kv.seen
+	}
+	return memIndex(nil)
+}
+
+// checkPrimaryKeys fails with StrictPK if a table in order has no primary
+// key.
+func (e *Extractor) checkPrimaryKeys(order []string) error {
+	if !e.strictPK {
+		return nil
+	}
+	var missing []string
+	for _, name := range order {
+		if t, ok := e.g.Tables[name]; ok && t.PrimaryKey == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("tables without a primary key (--strict-pk): %s; exclude them with exclude_tables", strings.Join(missing, ", "))
+	}
+	return nil
+}
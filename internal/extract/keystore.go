@@ -0,0 +1,104 @@
+package extract
+
+import "errors"
+
+// errStopKeys ends a keyList.batches iteration early without failing.
+var errStopKeys = errors.New("stop reading keys")
+
+// keyIndex indexes the collected rows of a table by key (encodeKey →
+// children followed).
+type keyIndex interface {
+	get(k string) (followed, ok bool)
+	set(k string, followed bool)
+}
+
+// keyList holds the keys of the collected rows of a table seeding child
+// lookups, in the order the rows were collected.
+type keyList interface {
+	add(key []any)
+	len() int
+	// batches calls fn with the keys in order, at most size at a time, so
+	// spilled keys are read back a batch at a time. Keys added meanwhile
+	// are not passed.
+	batches(size int, fn func(batch [][]any) error) error
+}
+
+// memIndex is a keyIndex held in memory.
+type memIndex map[string]bool
+
+func (m memIndex) get(k string) (bool, bool) {
+	followed, ok := m[k]
+	return followed, ok
+}
+
+func (m memIndex) set(k string, followed bool) {
+	m[k] = followed
+}
+
+// memList is a keyList held in memory.
+type memList struct {
+	keys [][]any
+}
+
+func (l *memList) add(key []any) { l.keys = append(l.keys, key) }
+func (l *memList) len() int      { return len(l.keys) }
+
+func (l *memList) batches(size int, fn func([][]any) error) error {
+	keys := l.keys
+	for start := 0; start < len(keys); start += size {
+		if err := fn(keys[start:min(start+size, len(keys))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allKeys reads all keys of a list into memory.
+func allKeys(l keyList) [][]any {
+	if l == nil || l.len() == 0 {
+		return nil
+	}
+	keys := make([][]any, 0, l.len())
+	l.batches(l.len(), func(batch [][]any) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+	return keys
+}
+
+// newIndex creates a key index, spilling to disk with SpillKeys.
+func (e *Extractor) newIndex() keyIndex {
+	if e.spill != nil {
+		return e.spill.newIndex()
+	}
+	return memIndex{}
+}
+
+// newList creates a key list, spilling to disk with SpillKeys.
+func (e *Extractor) newList() keyList {
+	if e.spill != nil {
+		return e.spill.newList()
+	}
+	return &memList{}
+}
+
+// rowIndex returns the index of the collected rows of a table (see rowKey).
+func (e *Extractor) rowIndex(name string) keyIndex {
+	x, ok := e.seen[name]
+	if !ok {
+		x = e.newIndex()
+		e.seen[name] = x
+	}
+	return x
+}
+
+// pkList returns the primary keys of the collected rows of a table seeding
+// child lookups.
+func (e *Extractor) pkList(name string) keyList {
+	l, ok := e.collectedPKs[name]
+	if !ok {
+		l = e.newList()
+		e.collectedPKs[name] = l
+	}
+	return l
+}
@@ -0,0 +1,136 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// pendingParents is a set of FK values whose parent rows are still to be fetched.
+type pendingParents struct {
+	table *schema.Table
+	refs  map[string]*refSet
+}
+
+// walkParents fetches, transitively, the parent rows referenced through refs
+// (FK name → values) by rows of table. Fetched rows are collected without
+// following their own children and written as extra blocks, after the rows
+// referencing them, which fails if the output keeps the FK checks immediate.
+func (e *Extractor) walkParents(ctx context.Context, table *schema.Table, refs map[string]*refSet) error {
+	queue := []pendingParents{{table: table, refs: refs}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, fk := range p.table.ForeignKeys {
+			rs, ok := p.refs[fk.Name]
+			if !ok || !e.tracksRefs(fk) {
+				continue
+			}
+			parent := e.g.Tables[fk.ParentSchema+"."+fk.ParentTable]
+			fresh, err := e.fetchParents(ctx, parent, fk, rs.keys)
+			if err != nil {
+				return fmt.Errorf("fetching parents of %s via %s: %w", p.table.FullName(), fk.Name, err)
+			}
+			if len(fresh) > 0 {
+				queue = append(queue, pendingParents{table: parent, refs: fresh})
+			}
+		}
+	}
+	return nil
+}
+
+// fetchParents collects the parent rows referenced through fk by keys that are
+// not collected yet, and returns the FK values of the newly collected rows.
+// The keys are read a batch at a time and the missing ones queried in
+// batches of batch_size.
+func (e *Extractor) fetchParents(ctx context.Context, parent *schema.Table, fk schema.ForeignKey, keys keyList) (map[string]*refSet, error) {
+	fresh := make(map[string]*refSet)
+	added, queries := 0, 0
+	batchSize := e.batchSize()
+	fetch := func(batch [][]any) error {
+		if queries++; queries == 1 {
+			e.stats.followed(parent, fk.Name)
+		}
+		query, args := buildParentQuery(parent, fk.ParentColumns, batch)
+		if e.verbose {
+			fmt.Printf("[parents] %s: %d keys via %s\n", parent.FullName(), len(batch), fk.Name)
+		}
+		if err := e.beginTable(parent); err != nil {
+			return err
+		}
+		err := e.forEachRow(ctx, parent, query, args, func(values []any) error {
+			if e.isCollected(parent, values) {
+				return nil
+			}
+			if e.immediateFKs && fk.Virtual == schema.VirtualNone {
+				return fmt.Errorf("%s rows referenced via %s would be written after the rows referencing them, failing the FK checks --disable-triggers keeps immediate; make the FKs DEFERRABLE, or use --skip-closure and roots with direction: children", parent.FullName(), fk.Name)
+			}
+			if err := e.collectRow(parent, values, false); err != nil {
+				return err
+			}
+			e.addRefs(fresh, parent, values)
+			added++
+			return nil
+		})
+		if endErr := e.endTable(); err == nil {
+			err = endErr
+		}
+		return err
+	}
+
+	var missing [][]any
+	err := keys.batches(batchSize, func(batch [][]any) error {
+		missing = append(missing, e.missingParentKeys(fk, batch)...)
+		for len(missing) >= batchSize {
+			if err := fetch(missing[:batchSize:batchSize]); err != nil {
+				return err
+			}
+			missing = missing[batchSize:]
+		}
+		return nil
+	})
+	if err == nil && len(missing) > 0 {
+		err = fetch(missing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.verbose && queries > 0 {
+		fmt.Printf("  -> %d parent rows\n", added)
+	}
+	return fresh, nil
+}
+
+// missingParentKeys drops keys whose parent row is already collected, by
+// the primary key or the other key fk references.
+func (e *Extractor) missingParentKeys(fk schema.ForeignKey, keys [][]any) [][]any {
+	collected := e.parentSeen(fk)
+	var missing [][]any
+	for _, key := range keys {
+		if _, ok := collected.get(encodeKey(key)); !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// closeParents fetches every parent row referenced by a collected row but not
+// collected itself, recursively, so the output satisfies the FK constraints
+// it covers (unless a max_bytes budget cut a parent table short).
+func (e *Extractor) closeParents(ctx context.Context, order []string) error {
+	before := e.totalRows()
+	for _, name := range order {
+		tbl, ok := e.g.Tables[name]
+		if !ok || e.rowCounts[name] == 0 {
+			continue
+		}
+		if err := e.walkParents(ctx, tbl, e.refs[name]); err != nil {
+			return err
+		}
+	}
+	if e.verbose {
+		fmt.Printf("[closure] %d missing parent rows added\n", e.totalRows()-before)
+	}
+	return nil
+}
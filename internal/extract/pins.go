@@ -0,0 +1,74 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// extractPins collects the pinned rows. They seed child lookups like root rows.
+func (e *Extractor) extractPins(ctx context.Context) error {
+	if len(e.cfg.Pins) > 0 {
+		e.progress.phase("pins")
+	}
+	for i, pin := range e.cfg.Pins {
+		table, err := e.pinTable(pin)
+		if err != nil {
+			return fmt.Errorf("pins[%d]: %w", i, err)
+		}
+		pk := table.PKColumnNames()
+		query, args := buildParentQuery(table, pk, pin.Keys())
+		if e.verbose || e.dryRun {
+			fmt.Printf("[pin] %s: %d rows\n", table.FullName(), len(pin.PKs))
+		}
+		if e.dryRun {
+			continue
+		}
+
+		if err := e.beginTable(table); err != nil {
+			return err
+		}
+		// A retried query may return rows again, so the found rows are a set
+		found := make(map[string]bool)
+		err = e.forEachRow(ctx, table, query, args, func(values []any) error {
+			found[encodeKey(e.rowKey(table, values))] = true
+			return e.collectRow(table, values, true)
+		})
+		if endErr := e.endTable(); err == nil {
+			err = endErr
+		}
+		if err != nil {
+			return fmt.Errorf("extracting pinned rows of %s: %w", table.FullName(), err)
+		}
+		if len(found) < len(pin.PKs) {
+			e.warnf("pins[%d]: %d of %d pinned rows of %s do not exist",
+				i, len(pin.PKs)-len(found), len(pin.PKs), table.FullName())
+		}
+	}
+	return nil
+}
+
+// pinTable resolves the table of a pin, whose PKs must match its primary key.
+func (e *Extractor) pinTable(pin config.Pin) (*schema.Table, error) {
+	key, err := config.ResolveTable(e.g.Tables, pin.Table)
+	if err != nil {
+		return nil, err
+	}
+	table := e.g.Tables[key]
+	if table == nil {
+		return nil, fmt.Errorf("table %q not found (or excluded)", pin.Table)
+	}
+	pk := table.PKColumnNames()
+	if len(pk) == 0 {
+		return nil, fmt.Errorf("%s has no primary key", table.FullName())
+	}
+	for _, key := range pin.Keys() {
+		if len(key) != len(pk) {
+			return nil, fmt.Errorf("pk %v does not match the primary key (%s) of %s", key, strings.Join(pk, ", "), table.FullName())
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,242 @@
+package extract
+
+import (
+	"sort"
+
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// Plan steps.
+const (
+	StepRoot    = "root"     // rows selected by the root's where
+	StepCopyAll = "copy_all" // all rows of a copy_all table
+	StepPinned  = "pinned"   // only the rows selected by pins
+	StepChild   = "child"    // rows referencing collected parent rows
+	StepParents = "parents"  // rows referenced by collected rows
+)
+
+// Plan is a machine-readable description of what an extraction would do,
+// derived from the config and schema without querying data.
+type Plan struct {
+	// Tables are the tables that would be queried, in extraction order:
+	// traversed tables first, then tables only fetched as parents.
+	Tables []PlanTable `json:"tables" yaml:"tables"`
+	// Skipped are the tables in the schema that would not be queried.
+	Skipped []PlanSkip `json:"skipped" yaml:"skipped"`
+}
+
+// PlanTable describes how a table's rows are selected.
+type PlanTable struct {
+	Table string `json:"table" yaml:"table"`
+	Step  string `json:"step" yaml:"step"`
+	// Queries are the query shapes; key arrays are passed as parameters.
+	Queries []string `json:"queries,omitempty" yaml:"queries,omitempty"`
+	// DrivenBy are the FKs whose collected parent (child step) or child
+	// (parents step) rows select this table's rows.
+	DrivenBy []PlanFK `json:"driven_by,omitempty" yaml:"driven_by,omitempty"`
+	// SelfRefs are the self-referencing FKs followed recursively.
+	SelfRefs []string `json:"self_refs,omitempty" yaml:"self_refs,omitempty"`
+}
+
+// PlanFK describes a FK driving a table.
+type PlanFK struct {
+	Name          string   `json:"name" yaml:"name"`
+	Table         string   `json:"table" yaml:"table"`
+	Columns       []string `json:"columns" yaml:"columns"`
+	Parent        string   `json:"parent" yaml:"parent"`
+	ParentColumns []string `json:"parent_columns" yaml:"parent_columns"`
+	Nulls         string   `json:"nulls,omitempty" yaml:"nulls,omitempty"`
+}
+
+// PlanSkip describes why a table is not extracted.
+type PlanSkip struct {
+	Table  string `json:"table" yaml:"table"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// Plan returns the extraction plan. excluded are the tables removed from the
+// graph by exclude_tables, include_tables and foreign_tables.
+func (e *Extractor) Plan(excluded []string) Plan {
+	roots := e.rootTables()
+	order := graph.TopoSortAll(e.g)
+	tables := append(order.Order, order.CycleTables...)
+
+	// Tables whose collected rows seed child lookups, to a fixpoint since
+	// cycle tables come last
+	seeding := make(map[string]bool)
+	copyAll := make(map[string]bool)
+	pinned := make(map[string][]string)
+	for _, pin := range e.cfg.Pins {
+		if tbl, err := e.pinTable(pin); err == nil {
+			q, _ := buildParentQuery(tbl, tbl.PKColumnNames(), pin.Keys())
+			pinned[tbl.FullName()] = append(pinned[tbl.FullName()], q)
+		}
+	}
+	for name, tbl := range e.g.Tables {
+		if e.cfg.TableConfig(tbl.Schema, tbl.Name).CopyAll {
+			copyAll[name] = true
+		} else if r, ok := roots[name]; (ok && r.FollowsChildren()) || len(pinned[name]) > 0 {
+			seeding[name] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range tables {
+			if seeding[name] || copyAll[name] || len(e.drivingFKs(e.g.Tables[name], seedingSet(seeding), false)) == 0 {
+				continue
+			}
+			seeding[name] = true
+			changed = true
+		}
+	}
+
+	// Tables whose rows are fetched as parents of collected rows
+	var start []string
+	for name, r := range roots {
+		if r.FollowsParents() || !e.skipClosure {
+			start = append(start, name)
+		}
+	}
+	if !e.skipClosure {
+		for name := range seeding {
+			start = append(start, name)
+		}
+		for name := range copyAll {
+			start = append(start, name)
+		}
+	}
+	referenced := e.g.Reachable(nil, start)
+
+	// Parent rows are fetched after the traversal
+	var p Plan
+	var parents []PlanTable
+	for _, name := range tables {
+		tbl := e.g.Tables[name]
+		pt := PlanTable{Table: name, Queries: pinned[name]}
+		root, isRoot := roots[name]
+		switch {
+		case copyAll[name]:
+			pt.Step = StepCopyAll
+			pt.Queries = append(pt.Queries, buildRootQuery(tbl, "", e.filter(tbl), 0)+e.orderBy(tbl))
+		case isRoot:
+			pt.Step = StepRoot
+			limit, sample := e.sampling(tbl, &root)
+			if limitClause, ok := e.limitClause(tbl, limit); ok {
+				where, _ := rootWhere(e.g, tbl, root) // checked by CheckRoot
+				pt.Queries = append(pt.Queries, buildRootQuery(tbl, where, e.filter(tbl), sample)+e.orderBy(tbl)+limitClause)
+			}
+			if fks := e.drivingFKs(tbl, seedingSet(seeding), true); len(fks) > 0 {
+				pt.DrivenBy = fks
+				pt.Queries = append(pt.Queries, e.planChildQuery(tbl, seeding, true))
+			}
+		case seeding[name]:
+			pt.Step = StepPinned
+			if fks := e.drivingFKs(tbl, seedingSet(seeding), false); len(fks) > 0 {
+				pt.Step = StepChild
+				pt.DrivenBy = fks
+				pt.Queries = append(pt.Queries, e.planChildQuery(tbl, seeding, false))
+			}
+		case referenced[name]:
+			pt.Step = StepParents
+			pt.DrivenBy = e.referencingFKs(name, referenced)
+			if pk := tbl.PKColumnNames(); len(pk) > 0 {
+				q, _ := buildParentQuery(tbl, pk, [][]any{make([]any, len(pk))})
+				pt.Queries = append(pt.Queries, q)
+			}
+			parents = append(parents, pt)
+			continue
+		default:
+			reason := "not reachable from any root"
+			if len(e.g.Parents[name]) > 0 && len(e.drivingFKs(tbl, func(string) bool { return true }, false)) == 0 {
+				reason = "all FKs to parent tables have follow: false"
+			}
+			p.Skipped = append(p.Skipped, PlanSkip{Table: name, Reason: reason})
+			continue
+		}
+		if seeding[name] {
+			for _, fk := range e.g.SelfRefs[name] {
+				if follow, _ := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable); follow {
+					pt.SelfRefs = append(pt.SelfRefs, fk.Name)
+				}
+			}
+		}
+		p.Tables = append(p.Tables, pt)
+	}
+	p.Tables = append(p.Tables, parents...)
+
+	for _, name := range excluded {
+		reason := "excluded by exclude_tables or include_tables"
+		if t := e.g.Excluded[name]; t != nil && t.Foreign {
+			reason = "foreign table (foreign_tables: skip)"
+		}
+		p.Skipped = append(p.Skipped, PlanSkip{Table: name, Reason: reason})
+	}
+	sort.Slice(p.Skipped, func(i, j int) bool { return p.Skipped[i].Table < p.Skipped[j].Table })
+	return p
+}
+
+// drivingFKs returns the followed FKs of table whose parent satisfies
+// isParent. With forcedOnly, only FKs with follow: true are returned.
+func (e *Extractor) drivingFKs(table *schema.Table, isParent func(string) bool, forcedOnly bool) []PlanFK {
+	var fks []PlanFK
+	for _, fk := range table.ForeignKeys {
+		if fk.IsSelfRef {
+			continue
+		}
+		follow, forced := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable)
+		if !follow || (forcedOnly && !forced) {
+			continue
+		}
+		parent := fk.ParentSchema + "." + fk.ParentTable
+		if !isParent(parent) {
+			continue
+		}
+		pfk := planFK(fk)
+		if isFKNullable(table, fk) {
+			pfk.Nulls, _ = e.nullPolicy(fk)
+		}
+		fks = append(fks, pfk)
+	}
+	return fks
+}
+
+// referencingFKs returns the FKs of tables in from that reference table.
+func (e *Extractor) referencingFKs(table string, from map[string]bool) []PlanFK {
+	var fks []PlanFK
+	for _, edge := range e.g.Edges {
+		if edge.ParentTable == table && from[edge.ChildTable] && e.tracksRefs(edge.FK) {
+			fks = append(fks, planFK(edge.FK))
+		}
+	}
+	return fks
+}
+
+// planChildQuery returns the shape of the child query of table.
+func (e *Extractor) planChildQuery(table *schema.Table, seeding map[string]bool, forcedOnly bool) string {
+	keys := func(fk schema.ForeignKey) [][]any {
+		follow, forced := e.cfg.FollowFK(fk.Name, fk.ChildSchema, fk.ChildTable)
+		if !follow || (forcedOnly && !forced) || !seeding[fk.ParentSchema+"."+fk.ParentTable] {
+			return nil
+		}
+		return [][]any{make([]any, len(fk.ParentColumns))}
+	}
+	limit, sample := e.sampling(table, nil)
+	limitClause, _ := e.limitClause(table, limit)
+	q, _ := buildChildQuery(table, keys, e.nullPolicy, e.filter(table), sample)
+	return q + e.orderBy(table) + limitClause
+}
+
+func planFK(fk schema.ForeignKey) PlanFK {
+	return PlanFK{
+		Name:          fk.Name,
+		Table:         fk.ChildSchema + "." + fk.ChildTable,
+		Columns:       fk.ChildColumns,
+		Parent:        fk.ParentSchema + "." + fk.ParentTable,
+		ParentColumns: fk.ParentColumns,
+	}
+}
+
+func seedingSet(seeding map[string]bool) func(string) bool {
+	return func(name string) bool { return seeding[name] }
+}
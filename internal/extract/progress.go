@@ -0,0 +1,138 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// progressInterval is the minimum time between redraws of the progress line.
+const progressInterval = 200 * time.Millisecond
+
+// progress reports the extraction progress: the current table and its
+// position in the topological order, rows fetched, elapsed time, an ETA and
+// the throttle state when one is configured. On a terminal a single status
+// line is redrawn; otherwise a line is printed per finished table. A nil
+// *progress reports nothing.
+type progress struct {
+	w     io.Writer
+	tty   bool
+	start time.Time
+
+	pos, total int
+	label      string
+	tableStart time.Time
+	tableRows  int64
+	rows       int64
+	drawn      time.Time
+	// throttle, when set, is appended to the status line
+	throttle fmt.Stringer
+}
+
+func newProgress(w io.Writer) *progress {
+	if w == nil {
+		return nil
+	}
+	p := &progress{w: w, start: time.Now()}
+	if f, ok := w.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			p.tty = fi.Mode()&os.ModeCharDevice != 0
+		}
+	}
+	return p
+}
+
+// table starts the pos-th (1-based) of total tables.
+func (p *progress) table(pos, total int, name string) {
+	if p == nil {
+		return
+	}
+	p.finish()
+	p.pos, p.total = pos, total
+	p.begin(name)
+}
+
+// phase starts a step after the tables (e.g. the parent closure).
+func (p *progress) phase(label string) {
+	if p == nil {
+		return
+	}
+	p.finish()
+	p.pos, p.total = 0, 0
+	p.begin(label)
+}
+
+func (p *progress) begin(label string) {
+	p.label = label
+	p.tableStart = time.Now()
+	p.tableRows = 0
+	p.draw()
+}
+
+// row counts a fetched row.
+func (p *progress) row() {
+	if p == nil {
+		return
+	}
+	p.rows++
+	p.tableRows++
+	if p.tty && time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// done ends the progress output.
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	p.finish()
+	if p.tty {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+// clear erases the status line before other output to the terminal; it is
+// redrawn with the next row.
+func (p *progress) clear() {
+	if p == nil || !p.tty {
+		return
+	}
+	fmt.Fprint(p.w, "\r\033[K")
+	p.drawn = time.Time{}
+}
+
+// finish reports the end of the current table or phase.
+func (p *progress) finish() {
+	if p.label == "" || p.tty {
+		return
+	}
+	fmt.Fprintf(p.w, "%s%s: %d rows (%s)\n", p.position(), p.label, p.tableRows,
+		time.Since(p.tableStart).Round(time.Millisecond))
+}
+
+func (p *progress) draw() {
+	if !p.tty {
+		return
+	}
+	p.drawn = time.Now()
+	elapsed := time.Since(p.start)
+	line := fmt.Sprintf("%s%s  %d rows  elapsed %s", p.position(), p.label, p.rows, elapsed.Round(time.Second))
+	// The ETA assumes the remaining tables take as long as the finished ones
+	if done := p.pos - 1; done > 0 && p.total > 0 {
+		eta := elapsed / time.Duration(done) * time.Duration(p.total-done)
+		line += fmt.Sprintf("  ETA %s", eta.Round(time.Second))
+	}
+	if p.throttle != nil {
+		line += "  " + p.throttle.String()
+	}
+	fmt.Fprint(p.w, "\r\033[K"+line)
+}
+
+func (p *progress) position() string {
+	if p.total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d] ", p.pos, p.total)
+}
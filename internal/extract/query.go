@@ -2,175 +2,234 @@ package extract
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/hurou927/db-sub-data/internal/config"
 	"github.com/hurou927/db-sub-data/internal/schema"
 )
 
-// buildRootQuery builds a SELECT query for a root table with a WHERE clause.
-func buildRootQuery(table *schema.Table, where string) string {
-	q := fmt.Sprintf("SELECT * FROM %s", table.FullName())
-	if where != "" {
+// buildRootQuery builds a SELECT query for a root table with a WHERE clause
+// and filter (see Extractor.filter).
+func buildRootQuery(table *schema.Table, where, filter string, sample float64) string {
+	q := fmt.Sprintf("SELECT * FROM %s", fromTable(table, sample))
+	switch {
+	case where != "" && filter != "":
+		q += fmt.Sprintf(" WHERE (%s) AND %s", where, filter)
+	case where != "":
 		q += " WHERE " + where
+	case filter != "":
+		q += " WHERE " + filter
 	}
 	return q
 }
 
+// buildParentQuery builds a SELECT query for the rows of a parent table whose
+// cols match one of keys.
+func buildParentQuery(table *schema.Table, cols []string, keys [][]any) (string, []any) {
+	cond, args, _ := buildKeyMatch(schema.QuoteIdents(cols), columnTypes(table, cols), keys, 1)
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s", table.FromName(), cond), args
+}
+
+// buildKeyMatch returns a condition matching exprs (quoted column names or
+// expressions) against keys. Each column is passed as one array parameter,
+// so neither the query text nor the number of parameters grows with the
+// number of keys:
+//
+//	expr = ANY($1::type[])
+//	(expr1, expr2) IN (SELECT * FROM unnest($1::type1[], $2::type2[]))
+func buildKeyMatch(exprs, types []string, keys [][]any, argIdx int) (string, []any, int) {
+	arrays := make([]string, len(types))
+	args := make([]any, len(types))
+	for j, typ := range types {
+		vals := make([]any, len(keys))
+		for i, key := range keys {
+			if j < len(key) {
+				vals[i] = key[j]
+			}
+		}
+		arrays[j] = fmt.Sprintf("$%d::%s[]", argIdx, typ)
+		args[j] = vals
+		argIdx++
+	}
+	if len(exprs) == 1 {
+		return fmt.Sprintf("%s = ANY(%s)", exprs[0], arrays[0]), args, argIdx
+	}
+	return fmt.Sprintf("(%s) IN (SELECT * FROM unnest(%s))",
+		strings.Join(exprs, ", "), strings.Join(arrays, ", ")), args, argIdx
+}
+
+// columnTypes returns the SQL types of cols, used to cast array parameters.
+func columnTypes(table *schema.Table, cols []string) []string {
+	types := make([]string, len(cols))
+	for i, c := range cols {
+		types[i] = "text"
+		if col := table.Column(c); col != nil {
+			types[i] = firstNonEmpty(col.SQLType, col.DataType)
+		}
+	}
+	return types
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// nullPolicy resolves the nullable FK policy ("include-nulls", "exclude-nulls",
+// "include-nulls-limited") and row limit for a FK.
+type nullPolicy func(fk schema.ForeignKey) (string, int)
+
+// parentKeys returns the parent key values to match through a FK.
+type parentKeys func(fk schema.ForeignKey) [][]any
+
+// parentLists returns the collected parent keys to match through a FK.
+type parentLists func(fk schema.ForeignKey) keyList
+
 // buildChildQuery builds a SELECT query for a child table based on collected parent PKs.
-// parentPKs maps parent full name → list of PK value tuples.
-func buildChildQuery(table *schema.Table, g fkGraph, parentPKs map[string][][]any) (string, []any) {
+// keys returns the PK value tuples to match per FK; FKs without keys are not constrained.
+// filter, if set, is ANDed to the conditions. With sample > 0 only that
+// percentage of the table is scanned.
+func buildChildQuery(table *schema.Table, keys parentKeys, nulls nullPolicy, filter string, sample float64) (string, []any) {
 	var conditions []string
 	var args []any
 	argIdx := 1
+	poly := newPolymorphicGroups()
 
 	for _, fk := range table.ForeignKeys {
 		if fk.IsSelfRef {
 			continue
 		}
-		parentKey := fk.ParentSchema + "." + fk.ParentTable
-		pks, ok := parentPKs[parentKey]
-		if !ok || len(pks) == 0 {
+		pks := keys(fk)
+		if len(pks) == 0 {
 			continue
 		}
 
-		// Check if this FK is nullable
-		nullable := isFKNullable(table, fk)
+		// NULL handling applies only to nullable FKs
+		nullCond := ""
+		if isFKNullable(table, fk) {
+			mode, limit := nulls(fk)
+			nullCond = buildNullCondition(table, fk, mode, limit)
+		}
 
 		switch fk.Virtual {
 		case schema.VirtualArray:
-			cond, newArgs, nextIdx := buildArrayOverlap(fk, pks, argIdx)
+			cond, newArgs, nextIdx := buildArrayOverlap(table, fk, pks, argIdx)
 			conditions = append(conditions, cond)
 			args = append(args, newArgs...)
 			argIdx = nextIdx
 		case schema.VirtualJSON:
-			cond, newArgs, nextIdx := buildJSONIN(fk, pks, nullable, argIdx)
+			cond, newArgs, nextIdx := buildJSONIN(fk, pks, nullCond, argIdx)
+			conditions = append(conditions, cond)
+			args = append(args, newArgs...)
+			argIdx = nextIdx
+		case schema.VirtualSQL:
+			cond, newArgs, nextIdx := buildSQLCondition(table, fk, pks, argIdx)
 			conditions = append(conditions, cond)
 			args = append(args, newArgs...)
 			argIdx = nextIdx
+		case schema.VirtualPolymorphic:
+			match, newArgs, nextIdx := buildKeyMatch(schema.QuoteIdents(fk.ChildColumns), columnTypes(table, fk.ChildColumns), pks, argIdx)
+			poly.add(fk, match, nullCond)
+			args = append(args, newArgs...)
+			argIdx = nextIdx
 		default:
-			if len(fk.ChildColumns) == 1 {
-				cond, newArgs, nextIdx := buildSingleColumnIN(fk, pks, nullable, argIdx)
-				conditions = append(conditions, cond)
-				args = append(args, newArgs...)
-				argIdx = nextIdx
-			} else {
-				cond, newArgs, nextIdx := buildCompositeIN(fk, pks, nullable, argIdx)
-				conditions = append(conditions, cond)
-				args = append(args, newArgs...)
-				argIdx = nextIdx
-			}
+			cond, newArgs, nextIdx := buildKeyIN(table, fk, pks, nullCond, argIdx)
+			conditions = append(conditions, cond)
+			args = append(args, newArgs...)
+			argIdx = nextIdx
 		}
 	}
+	conditions = append(conditions, poly.conditions()...)
 
 	if len(conditions) == 0 {
 		return "", nil
 	}
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
 
 	q := fmt.Sprintf("SELECT * FROM %s WHERE %s",
-		table.FullName(), strings.Join(conditions, " AND "))
+		fromTable(table, sample), strings.Join(conditions, " AND "))
 	return q, args
 }
 
-func buildSingleColumnIN(fk schema.ForeignKey, pks [][]any, nullable bool, argIdx int) (string, []any, int) {
-	col := fk.ChildColumns[0]
-
-	if len(pks) > 10000 {
-		// For large value sets, we'll still use IN but the caller should
-		// use temp tables. For now, cap at reasonable size.
-		pks = pks[:10000]
+// fromTable returns the table reference, with a TABLESAMPLE BERNOULLI clause
+// when sample (a percentage) is set.
+func fromTable(table *schema.Table, sample float64) string {
+	if sample <= 0 {
+		return table.FromName()
 	}
-
-	placeholders := make([]string, len(pks))
-	args := make([]any, len(pks))
-	for i, pk := range pks {
-		placeholders[i] = fmt.Sprintf("$%d", argIdx)
-		args[i] = pk[0] // single column, first value
-		argIdx++
-	}
-
-	cond := fmt.Sprintf("%s IN (%s)", col, strings.Join(placeholders, ", "))
-	if nullable {
-		cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, col)
-	}
-	return cond, args, argIdx
+	return fmt.Sprintf("%s TABLESAMPLE BERNOULLI (%s)", table.FromName(), strconv.FormatFloat(sample, 'g', -1, 64))
 }
 
-func buildCompositeIN(fk schema.ForeignKey, pks [][]any, nullable bool, argIdx int) (string, []any, int) {
-	cols := strings.Join(fk.ChildColumns, ", ")
-
-	if len(pks) > 10000 {
-		pks = pks[:10000]
+// buildNullCondition returns the predicate matching child rows whose FK is NULL,
+// or "" when such rows should be excluded. With include-nulls-limited, at most
+// limit NULL rows are matched (chosen by ctid).
+func buildNullCondition(table *schema.Table, fk schema.ForeignKey, mode string, limit int) string {
+	var isNull string
+	if fk.Virtual == schema.VirtualJSON {
+		isNull = jsonField(fk) + " IS NULL"
+	} else {
+		checks := make([]string, len(fk.ChildColumns))
+		for i, c := range fk.ChildColumns {
+			checks[i] = schema.QuoteIdent(c) + " IS NULL"
+		}
+		isNull = strings.Join(checks, " AND ")
+		if len(checks) > 1 {
+			isNull = "(" + isNull + ")"
+		}
 	}
 
-	var tuples []string
-	var args []any
-	for _, pk := range pks {
-		placeholders := make([]string, len(fk.ChildColumns))
-		for j := range fk.ChildColumns {
-			placeholders[j] = fmt.Sprintf("$%d", argIdx)
-			if j < len(pk) {
-				args = append(args, pk[j])
-			} else {
-				args = append(args, nil)
-			}
-			argIdx++
-		}
-		tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+	switch mode {
+	case config.NullsExclude:
+		return ""
+	case config.NullsIncludeLimited:
+		return fmt.Sprintf("(%s AND ctid IN (SELECT ctid FROM %s WHERE %s LIMIT %d))",
+			isNull, table.FromName(), isNull, limit)
+	default:
+		return isNull
 	}
+}
 
-	cond := fmt.Sprintf("(%s) IN (%s)", cols, strings.Join(tuples, ", "))
-	if nullable {
-		nullChecks := make([]string, len(fk.ChildColumns))
-		for i, c := range fk.ChildColumns {
-			nullChecks[i] = c + " IS NULL"
-		}
-		cond = fmt.Sprintf("(%s OR (%s))", cond, strings.Join(nullChecks, " AND "))
+// buildKeyIN generates the condition matching a scalar or composite FK
+// against the parent keys (see buildKeyMatch).
+func buildKeyIN(table *schema.Table, fk schema.ForeignKey, pks [][]any, nullCond string, argIdx int) (string, []any, int) {
+	cond, args, argIdx := buildKeyMatch(schema.QuoteIdents(fk.ChildColumns), columnTypes(table, fk.ChildColumns), pks, argIdx)
+	if nullCond != "" {
+		cond = fmt.Sprintf("(%s OR %s)", cond, nullCond)
 	}
 	return cond, args, argIdx
 }
 
-// buildSelfRefQuery builds a recursive CTE for self-referencing tables.
-func buildSelfRefQuery(table *schema.Table, fk schema.ForeignKey, seedPKs [][]any) (string, []any) {
-	if table.PrimaryKey == nil || len(seedPKs) == 0 {
+// buildSelfRefQuery builds a recursive CTE for self-referencing tables,
+// starting from the rows whose columns referenced by fk hold seedKeys.
+// filter, if set, restricts the rows returned (not the recursion). Rows
+// reached more than once are returned more than once and skipped when
+// collected, which unlike DISTINCT works for columns without equality
+// (json, point).
+func buildSelfRefQuery(table *schema.Table, fk schema.ForeignKey, seedKeys [][]any, filter string) (string, []any) {
+	if len(seedKeys) == 0 {
 		return "", nil
 	}
 
-	pkCols := table.PrimaryKey.Columns
 	fkChildCols := fk.ChildColumns
 	fkParentCols := fk.ParentColumns
 
-	var args []any
-	argIdx := 1
-
-	// Build seed condition: PK IN (...)
-	var seedCond string
-	if len(pkCols) == 1 {
-		placeholders := make([]string, len(seedPKs))
-		for i, pk := range seedPKs {
-			placeholders[i] = fmt.Sprintf("$%d", argIdx)
-			args = append(args, pk[0])
-			argIdx++
-		}
-		seedCond = fmt.Sprintf("%s IN (%s)", pkCols[0], strings.Join(placeholders, ", "))
-	} else {
-		var tuples []string
-		for _, pk := range seedPKs {
-			phs := make([]string, len(pkCols))
-			for j := range pkCols {
-				phs[j] = fmt.Sprintf("$%d", argIdx)
-				args = append(args, pk[j])
-				argIdx++
-			}
-			tuples = append(tuples, "("+strings.Join(phs, ", ")+")")
-		}
-		seedCond = fmt.Sprintf("(%s) IN (%s)",
-			strings.Join(pkCols, ", "), strings.Join(tuples, ", "))
-	}
+	// Build seed condition: parent columns IN (...)
+	seedCond, args, _ := buildKeyMatch(schema.QuoteIdents(fkParentCols), columnTypes(table, fkParentCols), seedKeys, 1)
 
 	// Build recursive join condition
 	joinConds := make([]string, len(fkChildCols))
 	for i := range fkChildCols {
-		joinConds[i] = fmt.Sprintf("t.%s = r.%s", fkParentCols[i], fkChildCols[i])
+		joinConds[i] = fmt.Sprintf("t.%s = r.%s", schema.QuoteIdent(fkParentCols[i]), schema.QuoteIdent(fkChildCols[i]))
+	}
+	if fk.Virtual == schema.VirtualPolymorphic {
+		joinConds = append(joinConds, fmt.Sprintf("r.%s = %s", schema.QuoteIdent(fk.TypeColumn), quoteLiteral(fk.TypeValue)))
 	}
 
 	q := fmt.Sprintf(`WITH RECURSIVE tree AS (
@@ -178,58 +237,141 @@ func buildSelfRefQuery(table *schema.Table, fk schema.ForeignKey, seedPKs [][]an
   UNION ALL
   SELECT t.* FROM %s t JOIN tree r ON %s
 )
-SELECT DISTINCT * FROM tree`,
-		table.FullName(), seedCond,
-		table.FullName(), strings.Join(joinConds, " AND "))
+SELECT * FROM tree`,
+		table.FromName(), seedCond,
+		table.FromName(), strings.Join(joinConds, " AND "))
+	if filter != "" {
+		q += " WHERE " + filter
+	}
 
 	return q, args
 }
 
-// buildArrayOverlap generates: child.array_col && ARRAY[$1,$2,...]
+// buildArrayOverlap generates: child.array_col && $1::type
 // Uses the overlap operator to find rows where the array contains any of the parent PKs.
-func buildArrayOverlap(fk schema.ForeignKey, pks [][]any, argIdx int) (string, []any, int) {
+func buildArrayOverlap(table *schema.Table, fk schema.ForeignKey, pks [][]any, argIdx int) (string, []any, int) {
 	col := fk.ChildColumns[0]
 
-	if len(pks) > 10000 {
-		pks = pks[:10000]
+	vals := make([]any, len(pks))
+	for i, pk := range pks {
+		vals[i] = pk[0]
 	}
 
-	placeholders := make([]string, len(pks))
-	args := make([]any, len(pks))
-	for i, pk := range pks {
-		placeholders[i] = fmt.Sprintf("$%d", argIdx)
-		args[i] = pk[0]
-		argIdx++
+	cond := fmt.Sprintf("%s && $%d::%s", schema.QuoteIdent(col), argIdx, columnTypes(table, fk.ChildColumns)[0])
+	return cond, []any{vals}, argIdx + 1
+}
+
+// sqlParentAlias is the alias of the parent table in the condition of a sql
+// virtual relation.
+const sqlParentAlias = "vr_parent"
+
+// buildSQLCondition generates the condition of a sql virtual relation:
+//
+//	EXISTS (SELECT 1 FROM parent vr_parent WHERE vr_parent.pk = ANY($1::type[]) AND (condition))
+func buildSQLCondition(table *schema.Table, fk schema.ForeignKey, pks [][]any, argIdx int) (string, []any, int) {
+	exprs := make([]string, len(fk.ParentColumns))
+	for i, c := range fk.ParentColumns {
+		exprs[i] = sqlParentAlias + "." + schema.QuoteIdent(c)
 	}
+	match, args, argIdx := buildKeyMatch(exprs, fk.ParentTypes, pks, argIdx)
+	cond := fmt.Sprintf("EXISTS (SELECT 1 FROM %s.%s %s WHERE %s AND (%s))",
+		schema.QuoteIdent(fk.ParentSchema), schema.QuoteIdent(fk.ParentTable), sqlParentAlias, match, sqlCondition(table, fk))
+	return cond, args, argIdx
+}
 
-	cond := fmt.Sprintf("%s && ARRAY[%s]", col, strings.Join(placeholders, ", "))
+// sqlCondition expands the {child} and {parent} placeholders of a sql virtual
+// relation's condition.
+func sqlCondition(table *schema.Table, fk schema.ForeignKey) string {
+	return strings.NewReplacer("{child}", table.QuotedName(), "{parent}", sqlParentAlias).Replace(fk.Condition)
+}
+
+// buildJSONIN generates: (child.json_col->>'key')::type = ANY($1::type[])
+// Extracts a value from JSONB via ->> and casts it to the parent column type;
+// text parent columns and unknown types are compared as text.
+func buildJSONIN(fk schema.ForeignKey, pks [][]any, nullCond string, argIdx int) (string, []any, int) {
+	typ := jsonCastType(fk)
+	keys := pks
+	if typ == "text" {
+		keys = make([][]any, len(pks))
+		for i, pk := range pks {
+			keys[i] = []any{fmt.Sprintf("%v", pk[0])}
+		}
+	}
+
+	cond, args, argIdx := buildKeyMatch([]string{jsonValue(fk)}, []string{typ}, keys, argIdx)
+	if nullCond != "" {
+		cond = fmt.Sprintf("(%s OR %s)", cond, nullCond)
+	}
 	return cond, args, argIdx
 }
 
-// buildJSONIN generates: (child.json_col->>'key')::text IN ($1,$2,...)
-// Extracts a value from JSONB via ->> and compares as text.
-func buildJSONIN(fk schema.ForeignKey, pks [][]any, nullable bool, argIdx int) (string, []any, int) {
-	col := fk.ChildColumns[0]
-	jsonPath := fk.JSONPath
+// jsonField returns the text extraction of a JSON virtual relation's key:
+// (json_col->>'key').
+func jsonField(fk schema.ForeignKey) string {
+	return fmt.Sprintf("(%s->>%s)", schema.QuoteIdent(fk.ChildColumns[0]), quoteLiteral(fk.JSONPath))
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// polymorphicGroups collects the conditions of polymorphic relations by id
+// column. The relations of one id column are alternatives: a row matches if
+// it references a collected parent of its own type, so their conditions are
+// joined with OR instead of AND.
+type polymorphicGroups struct {
+	order []string
+	conds map[string][]string
+	nulls map[string]string
+}
 
-	if len(pks) > 10000 {
-		pks = pks[:10000]
+func newPolymorphicGroups() *polymorphicGroups {
+	return &polymorphicGroups{conds: make(map[string][]string), nulls: make(map[string]string)}
+}
+
+// add records the condition matching the id column of fk; nullCond (the
+// same for all relations of an id column) matches rows with a NULL id.
+func (p *polymorphicGroups) add(fk schema.ForeignKey, match, nullCond string) {
+	key := fk.ChildColumns[0]
+	if _, ok := p.conds[key]; !ok {
+		p.order = append(p.order, key)
 	}
+	cond := fmt.Sprintf("(%s = %s AND %s)", schema.QuoteIdent(fk.TypeColumn), quoteLiteral(fk.TypeValue), match)
+	p.conds[key] = append(p.conds[key], cond)
+	p.nulls[key] = nullCond
+}
 
-	placeholders := make([]string, len(pks))
-	args := make([]any, len(pks))
-	for i, pk := range pks {
-		placeholders[i] = fmt.Sprintf("$%d", argIdx)
-		args[i] = fmt.Sprintf("%v", pk[0]) // compare as text
-		argIdx++
+// conditions returns one condition per id column.
+func (p *polymorphicGroups) conditions() []string {
+	var conditions []string
+	for _, key := range p.order {
+		alts := p.conds[key]
+		if p.nulls[key] != "" {
+			alts = append(alts, p.nulls[key])
+		}
+		if len(alts) == 1 {
+			conditions = append(conditions, alts[0])
+		} else {
+			conditions = append(conditions, "("+strings.Join(alts, " OR ")+")")
+		}
 	}
+	return conditions
+}
 
-	expr := fmt.Sprintf("(%s->>'%s')", col, jsonPath)
-	cond := fmt.Sprintf("%s IN (%s)", expr, strings.Join(placeholders, ", "))
-	if nullable {
-		cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, expr)
+// jsonValue returns jsonField cast to the type of the parent column.
+func jsonValue(fk schema.ForeignKey) string {
+	if typ := jsonCastType(fk); typ != "text" {
+		return fmt.Sprintf("%s::%s", jsonField(fk), typ)
 	}
-	return cond, args, argIdx
+	return jsonField(fk)
+}
+
+// jsonCastType returns the type JSON values of fk are compared as.
+func jsonCastType(fk schema.ForeignKey) string {
+	if fk.JSONType == "" || fk.JSONType == "text" || strings.HasPrefix(fk.JSONType, "character") {
+		return "text"
+	}
+	return fk.JSONType
 }
 
 func isFKNullable(table *schema.Table, fk schema.ForeignKey) bool {
@@ -244,6 +386,3 @@ func isFKNullable(table *schema.Table, fk schema.ForeignKey) bool {
 	}
 	return false
 }
-
-// fkGraph is a minimal interface for buildChildQuery to avoid circular imports.
-type fkGraph interface{}
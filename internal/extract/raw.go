@@ -0,0 +1,129 @@
+package extract
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/hurou927/db-sub-data/internal/output"
+)
+
+// byteaOID is the type OID of bytea.
+const byteaOID = 17
+
+// rawFetch fetches rows in a result format the output takes as is (binary
+// COPY, or the text format with RawText), so column values are written as
+// the server sent them. The decoded values are still used for PK and FK
+// tracking, masks and set_columns; for binary COPY the values masks and
+// set_columns produce are encoded for the column type.
+type rawFetch struct {
+	// format is the result format code requested for every column
+	format  int16
+	typeMap *pgtype.Map
+	// oids are the column type OIDs of the current query
+	oids []uint32
+	// row holds the values of the current row (nil for NULL)
+	row []any
+}
+
+// newRawFetch returns the raw fetch of the options, or nil if the output is
+// rendered from decoded values.
+func newRawFetch(opts Options) *rawFetch {
+	switch {
+	case opts.Output.CopyFormat == output.CopyBinary:
+		return &rawFetch{format: pgx.BinaryFormatCode}
+	case opts.RawText:
+		return &rawFetch{format: pgx.TextFormatCode}
+	}
+	return nil
+}
+
+// queryArgs prepends the result format to the arguments of a query.
+func (r *rawFetch) queryArgs(args []any) []any {
+	return append([]any{pgx.QueryResultFormats{r.format}}, args...)
+}
+
+// begin records the column types of a query's result.
+func (r *rawFetch) begin(rows pgx.Rows) {
+	r.typeMap = rows.Conn().TypeMap()
+	r.oids = r.oids[:0]
+	for _, fd := range rows.FieldDescriptions() {
+		r.oids = append(r.oids, fd.DataTypeOID)
+	}
+}
+
+// next records the raw values of the current row. In the binary format it
+// also adjusts the decoded values: values of types pgx does not know are
+// decoded to []byte where the text format gives a string, and keys of such
+// types (e.g. citext or enums, whose binary form is their text) are matched
+// as strings.
+func (r *rawFetch) next(rows pgx.Rows, values []any) {
+	raw := rows.RawValues()
+	r.row = make([]any, len(raw))
+	for i, v := range raw {
+		switch {
+		case v == nil:
+		case r.format == pgx.TextFormatCode:
+			r.row[i] = output.Text(v)
+		default:
+			// RawValues is only valid until the next row
+			r.row[i] = output.Binary(append([]byte(nil), v...))
+		}
+	}
+	if r.format == pgx.TextFormatCode {
+		return
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok && r.oids[i] != byteaOID {
+			if _, known := r.typeMap.TypeForOID(r.oids[i]); !known {
+				values[i] = string(b)
+			}
+		}
+	}
+}
+
+// output returns the row to write: the raw values, except for the columns
+// of set_columns and masks, whose values in row are kept (encoded for
+// binary COPY). values are the decoded values of the source row, row the
+// output row projected by p (or values, if p is nil).
+func (r *rawFetch) output(p *projection, values, row []any) ([]any, error) {
+	out := make([]any, len(row))
+	for i := range row {
+		idx := i
+		if p != nil {
+			idx = p.keep[i]
+			_, set := p.set[i]
+			_, masked := p.mask[i]
+			if set || masked {
+				v, err := r.encode(idx, row[i])
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %w", p.table.Columns[i].Name, err)
+				}
+				out[i] = v
+				continue
+			}
+		}
+		// a value cleared by the excluded-parent policy is NULL
+		if values[idx] != nil {
+			out[i] = r.row[idx]
+		}
+	}
+	return out, nil
+}
+
+// encode encodes a value for source column idx in the binary format; the
+// text outputs render it themselves.
+func (r *rawFetch) encode(idx int, v any) (any, error) {
+	if v == nil || r.format == pgx.TextFormatCode {
+		return v, nil
+	}
+	buf, err := r.typeMap.Encode(r.oids[idx], r.format, v, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %v for binary COPY: %w", v, err)
+	}
+	if buf == nil {
+		return nil, nil
+	}
+	return output.Binary(buf), nil
+}
@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// refSet holds the distinct non-NULL values of one FK over the collected rows
+// of its child table, in first-seen order. For array virtual relations each
+// element is a value; JSON and sql virtual relations are not tracked. Like
+// the collected keys, both spill to disk with SpillKeys.
+type refSet struct {
+	keys  keyList
+	index keyIndex
+}
+
+func (rs *refSet) add(key []any) {
+	k := encodeKey(key)
+	if _, ok := rs.index.get(k); ok {
+		return
+	}
+	rs.index.set(k, false)
+	rs.keys.add(key)
+}
+
+// tracksRefs reports whether FK values of fk are recorded for parent lookups.
+func (e *Extractor) tracksRefs(fk schema.ForeignKey) bool {
+	if fk.Virtual == schema.VirtualJSON || fk.Virtual == schema.VirtualSQL {
+		return false
+	}
+	_, ok := e.g.Tables[fk.ParentSchema+"."+fk.ParentTable]
+	return ok
+}
+
+// addRefs records the FK values of a row into refs (FK name → values).
+func (e *Extractor) addRefs(refs map[string]*refSet, table *schema.Table, values []any) {
+	idx := columnIndexes(table)
+	for _, fk := range table.ForeignKeys {
+		if !e.tracksRefs(fk) {
+			continue
+		}
+		for _, key := range refKeys(fk, idx, values) {
+			e.refSetFor(refs, fk.Name).add(key)
+		}
+	}
+}
+
+// refKeys returns the non-NULL values of fk in a row: one key, or one per
+// element for an array relation, or none if a polymorphic relation's type
+// column does not select fk's parent.
+func refKeys(fk schema.ForeignKey, idx map[string]int, values []any) [][]any {
+	if fk.Virtual == schema.VirtualPolymorphic {
+		j, ok := idx[fk.TypeColumn]
+		if !ok || values[j] == nil || fmt.Sprintf("%v", values[j]) != fk.TypeValue {
+			return nil
+		}
+	}
+	if fk.Virtual == schema.VirtualArray {
+		j, ok := idx[fk.ChildColumns[0]]
+		if !ok {
+			return nil
+		}
+		var keys [][]any
+		for _, elem := range arrayElements(values[j]) {
+			keys = append(keys, []any{elem})
+		}
+		return keys
+	}
+	key := make([]any, len(fk.ChildColumns))
+	for i, c := range fk.ChildColumns {
+		j, ok := idx[c]
+		if !ok || values[j] == nil {
+			return nil
+		}
+		key[i] = values[j]
+	}
+	return [][]any{key}
+}
+
+func (e *Extractor) refSetFor(refs map[string]*refSet, name string) *refSet {
+	rs, ok := refs[name]
+	if !ok {
+		rs = &refSet{keys: e.newList(), index: e.newIndex()}
+		refs[name] = rs
+	}
+	return rs
+}
+
+// arrayElements returns the non-NULL elements of an array value, flattening
+// multi-dimensional arrays.
+func arrayElements(v any) []any {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return []any{v} // not an array (or bytea)
+	}
+	var elems []any
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i).Interface()
+		if nested := reflect.ValueOf(elem); nested.Kind() == reflect.Slice && nested.Type().Elem().Kind() != reflect.Uint8 {
+			elems = append(elems, arrayElements(elem)...)
+		} else if elem != nil {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// tableRefs returns the FK values recorded for a table's collected rows.
+func (e *Extractor) tableRefs(table string) map[string]*refSet {
+	refs, ok := e.refs[table]
+	if !ok {
+		refs = make(map[string]*refSet)
+		e.refs[table] = refs
+	}
+	return refs
+}
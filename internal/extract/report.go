@@ -0,0 +1,185 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// Report summarizes an extraction for auditing and comparing extracts.
+type Report struct {
+	// ConfigHash identifies the extraction settings (see config.Config.Hash).
+	ConfigHash string        `json:"config_hash"`
+	StartedAt  time.Time     `json:"started_at"`
+	DurationMS int64         `json:"duration_ms"`
+	Rows       int           `json:"rows"`
+	Bytes      int64         `json:"bytes"`
+	Queries    int           `json:"queries"`
+	Tables     []TableReport `json:"tables"`
+	Warnings   []string      `json:"warnings"`
+}
+
+// TableReport holds the statistics of one table. Bytes is the size of the
+// table's output (0 when streaming to a custom TableWriter).
+type TableReport struct {
+	Table      string   `json:"table"`
+	Rows       int      `json:"rows"`
+	Bytes      int64    `json:"bytes"`
+	Queries    int      `json:"queries"`
+	DurationMS int64    `json:"duration_ms"`
+	FKs        []string `json:"fks_followed"`
+	// RowsByFK counts the child rows matched through each FK; a row
+	// referencing several collected parents counts for each of them. Rows
+	// matched through none (NULL FK, json or sql relation) count as "other".
+	RowsByFK map[string]int `json:"rows_by_fk,omitempty"`
+	// Duplicates counts the rows fetched again (e.g. through another FK or
+	// the self-reference) and skipped as already collected.
+	Duplicates int  `json:"duplicates,omitempty"`
+	Truncated  bool `json:"truncated,omitempty"`
+}
+
+// tableStats accumulates the statistics of one table.
+type tableStats struct {
+	queries  int
+	duration time.Duration
+	bytes    int64
+	fks      map[string]bool
+	// fkRows counts the child rows matched per FK (see attributeRow)
+	fkRows map[string]int
+	// duplicates counts the rows skipped as already collected
+	duplicates int
+}
+
+// stats holds the per-table statistics of an extraction (full name → stats).
+type stats map[string]*tableStats
+
+func (s stats) table(table *schema.Table) *tableStats {
+	ts, ok := s[table.FullName()]
+	if !ok {
+		ts = &tableStats{fks: make(map[string]bool)}
+		s[table.FullName()] = ts
+	}
+	return ts
+}
+
+func (s stats) query(table *schema.Table) {
+	s.table(table).queries++
+}
+
+func (s stats) followed(table *schema.Table, fk string) {
+	s.table(table).fks[fk] = true
+}
+
+// byteCounter reports the bytes of output written so far.
+type byteCounter interface {
+	Written() int64
+}
+
+// countingWriter counts the bytes written to the output.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Written() int64 {
+	return c.n
+}
+
+// warnf logs a warning and records it for the report.
+func (e *Extractor) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	e.progress.clear()
+	log.Printf("WARNING: %s", msg)
+	e.warnings = append(e.warnings, msg)
+}
+
+// Report returns the statistics of the extraction.
+func (e *Extractor) Report() Report {
+	r := Report{
+		ConfigHash: e.cfg.Hash(),
+		StartedAt:  e.started,
+		DurationMS: e.finished.Sub(e.started).Milliseconds(),
+		Tables:     []TableReport{},
+		Warnings:   append([]string{}, e.warnings...),
+	}
+	names := make(map[string]bool)
+	for name := range e.stats {
+		names[name] = true
+	}
+	for name := range e.rowCounts {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		t := TableReport{
+			Table:     name,
+			Rows:      e.rowCounts[name],
+			FKs:       []string{},
+			Truncated: e.truncated[name],
+		}
+		if ts := e.stats[name]; ts != nil {
+			t.Bytes = ts.bytes
+			t.Queries = ts.queries
+			t.DurationMS = ts.duration.Milliseconds()
+			t.Duplicates = ts.duplicates
+			for fk := range ts.fks {
+				t.FKs = append(t.FKs, fk)
+			}
+			sort.Strings(t.FKs)
+			if len(ts.fkRows) > 0 {
+				t.RowsByFK = make(map[string]int, len(ts.fkRows))
+				for fk, n := range ts.fkRows {
+					if fk == "" {
+						fk = "other"
+					}
+					t.RowsByFK[fk] = n
+				}
+			}
+		}
+		r.Rows += t.Rows
+		r.Bytes += t.Bytes
+		r.Queries += t.Queries
+		r.Tables = append(r.Tables, t)
+	}
+	return r
+}
+
+// fkRowLines describes the child rows matched per FK for the summary, the
+// FKs that matched the most rows first.
+func fkRowLines(fkRows map[string]int) []string {
+	names := make([]string, 0, len(fkRows))
+	for name := range fkRows {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if fkRows[names[i]] != fkRows[names[j]] {
+			return fkRows[names[i]] > fkRows[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	lines := make([]string, 0, len(fkRows))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("    via %s: %d rows", name, fkRows[name]))
+	}
+	if n := fkRows[""]; n > 0 {
+		lines = append(lines, fmt.Sprintf("    via other conditions (NULL FK, json or sql relation): %d rows", n))
+	}
+	return lines
+}
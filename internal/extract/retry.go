@@ -0,0 +1,74 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// transientCodes are SQLSTATEs of failures that may succeed when retried.
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure (also standby recovery conflicts)
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// callbackError is an error returned by the row callback of a query, e.g.
+// failing to write the output, which is never retried.
+type callbackError struct{ err error }
+
+func (e *callbackError) Error() string { return e.err.Error() }
+func (e *callbackError) Unwrap() error { return e.err }
+
+// isTransient reports whether err is worth retrying: a transient server
+// error, a connection exception (class 08) or a lost connection.
+func isTransient(err error) bool {
+	var cbErr *callbackError
+	if errors.As(err, &cbErr) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return transientCodes[pgErr.Code] || pgErr.Code[:2] == "08"
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withRetry runs query until it succeeds, fails with a non-transient error or
+// runs out of attempts, waiting with exponential backoff in between. query
+// reports whether it already passed rows on; such a query is only retried if
+// rerunnable.
+func (e *Extractor) withRetry(ctx context.Context, rerunnable bool, query func() (bool, error)) error {
+	backoff := e.cfg.Retry.BackoffDuration
+	for attempt := 1; ; attempt++ {
+		delivered, err := query()
+		if err == nil || attempt >= e.cfg.Retry.Attempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		if delivered && !rerunnable {
+			e.warnf("%v; not retried, rows without a primary or unique key were already written", err)
+			return err
+		}
+		e.warnf("%v; retrying in %s (attempt %d of %d)", err, backoff, attempt+1, e.cfg.Retry.Attempts)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, e.cfg.Retry.MaxBackoffDuration)
+	}
+}
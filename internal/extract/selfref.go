@@ -4,36 +4,28 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/jackc/pgx/v5/pgxpool"
-
 	"github.com/hurou927/db-sub-data/internal/schema"
 )
 
-// fetchSelfRefRows retrieves all rows from a self-referencing table using
-// a recursive CTE starting from the given seed PK values.
-func fetchSelfRefRows(ctx context.Context, pool *pgxpool.Pool, table *schema.Table, fk schema.ForeignKey, seedPKs [][]any, verbose bool) ([][]any, error) {
-	query, args := buildSelfRefQuery(table, fk, seedPKs)
+// fetchSelfRefRows collects all rows of a self-referencing table reachable
+// through fk, using a recursive CTE starting from the rows whose columns
+// referenced by fk hold seedKeys. Rows already collected are skipped.
+func (e *Extractor) fetchSelfRefRows(ctx context.Context, table *schema.Table, fk schema.ForeignKey, seedKeys [][]any) error {
+	query, args := buildSelfRefQuery(table, fk, seedKeys, e.filter(table))
 	if query == "" {
-		return nil, nil
+		return nil
 	}
 
-	if verbose {
+	if e.verbose || e.dryRun {
 		fmt.Printf("  [self-ref] %s: %s (args: %v)\n", table.FullName(), query, args)
 	}
 
-	rows, err := pool.Query(ctx, query, args...)
+	e.stats.followed(table, fk.Name)
+	err := e.forEachRow(ctx, table, query, args, func(values []any) error {
+		return e.collectRow(table, values, true)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("self-ref query for %s: %w", table.FullName(), err)
-	}
-	defer rows.Close()
-
-	var result [][]any
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return nil, err
-		}
-		result = append(result, values)
+		return fmt.Errorf("self-ref query for %s: %w", table.FullName(), err)
 	}
-	return result, rows.Err()
+	return nil
 }
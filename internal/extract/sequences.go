@@ -0,0 +1,55 @@
+package extract
+
+import (
+	"sort"
+
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// trackSequences records the largest value written to each column owned by a
+// sequence (serial / identity columns).
+func (e *Extractor) trackSequences(columns []schema.Column, row []any) {
+	for i, col := range columns {
+		if col.Sequence == "" || i >= len(row) {
+			continue
+		}
+		v, ok := sequenceValue(row[i])
+		if !ok {
+			continue
+		}
+		if cur, seen := e.seqMax[col.Sequence]; !seen || v > cur {
+			e.seqMax[col.Sequence] = v
+		}
+	}
+}
+
+func sequenceValue(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// footer returns the output footer setting the deferred FK columns (see
+// deferFKs) and each tracked sequence past the largest extracted value, so
+// inserts on the target do not collide.
+func (e *Extractor) footer() output.Footer {
+	names := make([]string, 0, len(e.seqMax))
+	for name := range e.seqMax {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	f := output.Footer{Statements: e.updates}
+	for _, name := range names {
+		f.Sequences = append(f.Sequences, output.SequenceValue{Name: name, Value: e.seqMax[name]})
+	}
+	return f
+}
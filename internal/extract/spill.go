@@ -0,0 +1,408 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func init() {
+	// types of key values spilled lists hold in []any, besides the basic
+	// types gob knows
+	gob.Register([16]byte{})
+	gob.Register(time.Time{})
+	gob.Register(pgtype.Numeric{})
+	gob.Register(pgtype.Time{})
+	gob.Register(pgtype.Interval{})
+	gob.Register(netip.Prefix{})
+}
+
+// runBlock is the number of records of a run per entry of its sparse index.
+const runBlock = 128
+
+// maxRuns is the number of runs of an index before they are merged into one.
+const maxRuns = 8
+
+// spiller creates the key indexes and lists of an extraction with
+// SpillKeys: each keeps at most limit keys in memory and spills the rest to
+// files in a temporary directory, removed by close.
+//
+// An index spills its keys as sorted runs, looked up through a sparse
+// index of every runBlock-th key and merged when there are more than
+// maxRuns; a list spills its keys as gob-encoded chunks. The first I/O
+// error is kept and reported by err; lookups after it may miss keys.
+type spiller struct {
+	dir      string
+	limit    int
+	files    int
+	firstErr error
+}
+
+func newSpiller(parent string, limit int) (*spiller, error) {
+	dir, err := os.MkdirTemp(parent, "db-sub-data-keys-")
+	if err != nil {
+		return nil, err
+	}
+	return &spiller{dir: dir, limit: limit}, nil
+}
+
+// err returns the first error spilling or reading keys.
+func (s *spiller) err() error {
+	if s == nil {
+		return nil
+	}
+	return s.firstErr
+}
+
+func (s *spiller) fail(err error) {
+	if s.firstErr == nil {
+		s.firstErr = fmt.Errorf("spilling keys to %s: %w", s.dir, err)
+	}
+}
+
+// close removes the spilled files.
+func (s *spiller) close() error {
+	return os.RemoveAll(s.dir)
+}
+
+func (s *spiller) create() (*os.File, error) {
+	s.files++
+	return os.Create(filepath.Join(s.dir, fmt.Sprintf("%06d", s.files)))
+}
+
+func (s *spiller) newIndex() keyIndex {
+	return &spillIndex{s: s, mem: make(map[string]bool)}
+}
+
+func (s *spiller) newList() keyList {
+	return &spillList{s: s}
+}
+
+// spillIndex is a keyIndex spilling to sorted runs. Entries in memory are
+// newer than those of the runs, and later runs newer than earlier ones, so
+// a key whose children were followed later is found as such.
+type spillIndex struct {
+	s    *spiller
+	mem  map[string]bool
+	runs []*keyRun
+}
+
+func (x *spillIndex) get(k string) (bool, bool) {
+	if followed, ok := x.mem[k]; ok {
+		return followed, true
+	}
+	for i := len(x.runs) - 1; i >= 0; i-- {
+		followed, ok, err := x.runs[i].find(k)
+		if err != nil {
+			x.s.fail(err)
+			return false, false
+		}
+		if ok {
+			return followed, true
+		}
+	}
+	return false, false
+}
+
+func (x *spillIndex) set(k string, followed bool) {
+	x.mem[k] = followed
+	if len(x.mem) < x.s.limit || x.s.firstErr != nil {
+		return
+	}
+	if err := x.flush(); err != nil {
+		x.s.fail(err)
+	}
+}
+
+// flush writes the entries in memory as a new run, merging the runs when
+// there are too many.
+func (x *spillIndex) flush() error {
+	keys := make([]string, 0, len(x.mem))
+	for k := range x.mem {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	rw, err := x.s.newRun()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := rw.write(k, x.mem[k]); err != nil {
+			return err
+		}
+	}
+	run, err := rw.finish()
+	if err != nil {
+		return err
+	}
+	x.runs = append(x.runs, run)
+	x.mem = make(map[string]bool)
+	if len(x.runs) > maxRuns {
+		return x.merge()
+	}
+	return nil
+}
+
+// merge replaces the runs with one, keeping the newest entry of each key.
+func (x *spillIndex) merge() error {
+	readers := make([]*runReader, len(x.runs))
+	for i, run := range x.runs {
+		r, err := run.reader()
+		if err != nil {
+			return err
+		}
+		readers[i] = r
+	}
+	rw, err := x.s.newRun()
+	if err != nil {
+		return err
+	}
+	for {
+		// the smallest key, from the newest run holding it
+		newest := -1
+		for i, r := range readers {
+			if !r.done && (newest < 0 || r.key <= readers[newest].key) {
+				newest = i
+			}
+		}
+		if newest < 0 {
+			break
+		}
+		k := readers[newest].key
+		if err := rw.write(k, readers[newest].followed); err != nil {
+			return err
+		}
+		for _, r := range readers {
+			if !r.done && r.key == k {
+				if err := r.next(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	run, err := rw.finish()
+	if err != nil {
+		return err
+	}
+	for _, old := range x.runs {
+		old.remove()
+	}
+	x.runs = []*keyRun{run}
+	return nil
+}
+
+// keyRun is a file of entries sorted by key, each written as the uvarint
+// length of the key, the key and a byte for followed.
+type keyRun struct {
+	f    *os.File
+	size int64
+	// index holds every runBlock-th key and offsets its offset
+	index   []string
+	offsets []int64
+}
+
+// find looks up a key, reading the block of the run that may hold it.
+func (r *keyRun) find(k string) (followed, ok bool, err error) {
+	i := sort.SearchStrings(r.index, k)
+	if i == len(r.index) || r.index[i] != k {
+		i--
+	}
+	if i < 0 {
+		return false, false, nil
+	}
+	end := r.size
+	if i+1 < len(r.offsets) {
+		end = r.offsets[i+1]
+	}
+	block := make([]byte, end-r.offsets[i])
+	if _, err := r.f.ReadAt(block, r.offsets[i]); err != nil {
+		return false, false, err
+	}
+	br := bytes.NewReader(block)
+	for br.Len() > 0 {
+		key, f, err := readEntry(br)
+		if err != nil {
+			return false, false, err
+		}
+		if key == k {
+			return f, true, nil
+		}
+		if key > k {
+			break
+		}
+	}
+	return false, false, nil
+}
+
+func (r *keyRun) reader() (*runReader, error) {
+	rr := &runReader{r: bufio.NewReader(io.NewSectionReader(r.f, 0, r.size))}
+	return rr, rr.next()
+}
+
+func (r *keyRun) remove() {
+	r.f.Close()
+	os.Remove(r.f.Name())
+}
+
+// runReader reads the entries of a run in order.
+type runReader struct {
+	r        *bufio.Reader
+	key      string
+	followed bool
+	done     bool
+}
+
+func (rr *runReader) next() error {
+	key, followed, err := readEntry(rr.r)
+	if errors.Is(err, io.EOF) {
+		rr.done = true
+		return nil
+	}
+	rr.key, rr.followed = key, followed
+	return err
+}
+
+func readEntry(r io.ByteReader) (string, bool, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", false, err
+	}
+	buf := make([]byte, n+1)
+	for i := range buf {
+		if buf[i], err = r.ReadByte(); err != nil {
+			return "", false, io.ErrUnexpectedEOF
+		}
+	}
+	return string(buf[:n]), buf[n] == 1, nil
+}
+
+// runWriter writes the entries of a run, in key order.
+type runWriter struct {
+	w   *bufio.Writer
+	run *keyRun
+	n   int
+}
+
+func (s *spiller) newRun() (*runWriter, error) {
+	f, err := s.create()
+	if err != nil {
+		return nil, err
+	}
+	return &runWriter{w: bufio.NewWriter(f), run: &keyRun{f: f}}, nil
+}
+
+func (rw *runWriter) write(k string, followed bool) error {
+	if rw.n%runBlock == 0 {
+		rw.run.index = append(rw.run.index, k)
+		rw.run.offsets = append(rw.run.offsets, rw.run.size)
+	}
+	rw.n++
+	entry := binary.AppendUvarint(nil, uint64(len(k)))
+	entry = append(entry, k...)
+	if followed {
+		entry = append(entry, 1)
+	} else {
+		entry = append(entry, 0)
+	}
+	n, err := rw.w.Write(entry)
+	rw.run.size += int64(n)
+	return err
+}
+
+func (rw *runWriter) finish() (*keyRun, error) {
+	if err := rw.w.Flush(); err != nil {
+		return nil, err
+	}
+	return rw.run, nil
+}
+
+// spillList is a keyList spilling its keys in chunks of limit keys.
+type spillList struct {
+	s   *spiller
+	mem [][]any
+	f   *os.File
+	// chunks holds the offsets of the spilled chunks, which end at size
+	chunks []int64
+	size   int64
+	n      int
+}
+
+func (l *spillList) add(key []any) {
+	l.mem = append(l.mem, key)
+	l.n++
+	if len(l.mem) < l.s.limit || l.s.firstErr != nil {
+		return
+	}
+	if err := l.flush(); err != nil {
+		l.s.fail(err)
+	}
+}
+
+func (l *spillList) flush() error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(l.mem); err != nil {
+		return err
+	}
+	if l.f == nil {
+		f, err := l.s.create()
+		if err != nil {
+			return err
+		}
+		l.f = f
+	}
+	if _, err := l.f.WriteAt(buf.Bytes(), l.size); err != nil {
+		return err
+	}
+	l.chunks = append(l.chunks, l.size)
+	l.size += int64(buf.Len())
+	l.mem = nil
+	return nil
+}
+
+func (l *spillList) len() int {
+	return l.n
+}
+
+// batches reads the spilled keys back a chunk at a time, followed by those
+// in memory. A read error is kept by the spiller and ends the keys early.
+func (l *spillList) batches(size int, fn func([][]any) error) error {
+	chunks, end, mem := l.chunks, l.size, l.mem
+	var pending [][]any
+	for i, off := range chunks {
+		next := end
+		if i+1 < len(chunks) {
+			next = chunks[i+1]
+		}
+		var chunk [][]any
+		if err := gob.NewDecoder(io.NewSectionReader(l.f, off, next-off)).Decode(&chunk); err != nil {
+			l.s.fail(err)
+			return l.s.err()
+		}
+		pending = append(pending, chunk...)
+		for len(pending) >= size {
+			if err := fn(pending[:size:size]); err != nil {
+				return err
+			}
+			pending = pending[size:]
+		}
+	}
+	pending = append(pending, mem...)
+	for start := 0; start < len(pending); start += size {
+		if err := fn(pending[start:min(start+size, len(pending))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
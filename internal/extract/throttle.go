@@ -0,0 +1,88 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+)
+
+// throttle limits row throughput and adds a pause after each query so
+// scheduled extractions don't spike load on the source. Concurrent queries
+// are limited by the size of the connection pool (see
+// config.Throttle.MaxConcurrentQueries).
+type throttle struct {
+	maxRowsPerSec float64
+	batchSleep    time.Duration
+
+	start time.Time
+	rows  int64
+	slept time.Duration
+}
+
+func newThrottle(cfg config.Throttle) *throttle {
+	return &throttle{
+		maxRowsPerSec: cfg.MaxRowsPerSec,
+		batchSleep:    cfg.BatchSleepDuration,
+	}
+}
+
+// enabled reports whether any limit is configured.
+func (t *throttle) enabled() bool {
+	return t.maxRowsPerSec > 0 || t.batchSleep > 0
+}
+
+// row accounts for one fetched row and sleeps when ahead of max_rows_per_sec.
+func (t *throttle) row(ctx context.Context) error {
+	if t.maxRowsPerSec <= 0 {
+		return nil
+	}
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.rows++
+	due := time.Duration(float64(t.rows) / t.maxRowsPerSec * float64(time.Second))
+	if ahead := due - time.Since(t.start); ahead > 10*time.Millisecond {
+		return t.sleep(ctx, ahead)
+	}
+	return nil
+}
+
+// afterQuery pauses for batch_sleep between queries.
+func (t *throttle) afterQuery(ctx context.Context) error {
+	if t.batchSleep <= 0 {
+		return nil
+	}
+	return t.sleep(ctx, t.batchSleep)
+}
+
+func (t *throttle) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		t.slept += d
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// String describes the current throttle state for progress output.
+func (t *throttle) String() string {
+	var parts []string
+	if t.maxRowsPerSec > 0 {
+		rate := 0.0
+		if elapsed := time.Since(t.start).Seconds(); !t.start.IsZero() && elapsed > 0 {
+			rate = float64(t.rows) / elapsed
+		}
+		parts = append(parts, fmt.Sprintf("%.0f/%.0f rows/s", rate, t.maxRowsPerSec))
+	}
+	if t.batchSleep > 0 {
+		parts = append(parts, fmt.Sprintf("batch sleep %s", t.batchSleep))
+	}
+	parts = append(parts, fmt.Sprintf("slept %s", t.slept.Round(time.Millisecond)))
+	return "throttle: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,33 @@
+package extract
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// toUTC converts the timestamps of a row to UTC, including those in arrays
+// and range bounds. pgx decodes timestamptz values in the local time zone of
+// the extracting host; timestamp and date values are already UTC.
+func toUTC(values []any) {
+	for i, v := range values {
+		values[i] = valueToUTC(v)
+	}
+}
+
+func valueToUTC(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC()
+	case []any:
+		toUTC(v)
+	case pgtype.Range[any]:
+		v.Lower, v.Upper = valueToUTC(v.Lower), valueToUTC(v.Upper)
+		return v
+	case pgtype.Multirange[pgtype.Range[any]]:
+		for i, r := range v {
+			v[i] = valueToUTC(r).(pgtype.Range[any])
+		}
+	}
+	return v
+}
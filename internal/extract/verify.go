@@ -0,0 +1,166 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// maxReportedValues caps how many missing references are printed per relation.
+const maxReportedValues = 10
+
+// verifyIssue describes collected rows referencing a parent row that is not in the subset.
+type verifyIssue struct {
+	fk schema.ForeignKey
+	// notCollected are referenced parent keys that exist in the source but were not extracted
+	notCollected [][]any
+	// missing are referenced parent keys that do not exist in the source at all
+	missing [][]any
+}
+
+// verify checks that every FK reference in the collected rows points at a
+// collected parent row. References that are not collected are re-queried in
+// the source: rows that exist there are reported with an explanation, rows
+// that do not exist indicate a concurrent change or an extractor bug and fail
+// the extraction.
+//
+// Scalar and composite references are checked against the parent's primary
+// key or the other key they reference, with array virtual relations checked
+// per element; JSON and sql virtual relations are skipped.
+func (e *Extractor) verify(ctx context.Context) error {
+	var fks []schema.ForeignKey
+	for _, edge := range e.g.Edges {
+		fks = append(fks, edge.FK)
+	}
+	for _, selfRefs := range e.g.SelfRefs {
+		fks = append(fks, selfRefs...)
+	}
+	sort.Slice(fks, func(i, j int) bool { return fks[i].Name < fks[j].Name })
+
+	var issues []verifyIssue
+	for _, fk := range fks {
+		issue, err := e.verifyFK(ctx, fk)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", fk.Name, err)
+		}
+		if len(issue.notCollected) > 0 || len(issue.missing) > 0 {
+			issues = append(issues, issue)
+		}
+	}
+
+	if len(issues) == 0 {
+		if e.verbose {
+			fmt.Fprintf(os.Stderr, "Verification passed: %d relations checked\n", len(fks))
+		}
+		return nil
+	}
+
+	missingTotal := 0
+	for _, issue := range issues {
+		ref := fmt.Sprintf("%s.%s(%s) -> %s.%s(%s)",
+			issue.fk.ChildSchema, issue.fk.ChildTable, strings.Join(issue.fk.ChildColumns, ", "),
+			issue.fk.ParentSchema, issue.fk.ParentTable, strings.Join(issue.fk.ParentColumns, ", "))
+		if len(issue.notCollected) > 0 {
+			msg := fmt.Sprintf("%s: %d referenced parent rows exist in the source but were not extracted (not reachable from roots): %s",
+				ref, len(issue.notCollected), formatKeys(issue.notCollected))
+			fmt.Fprintln(os.Stderr, "WARNING: "+msg)
+			e.warnings = append(e.warnings, msg)
+		}
+		if len(issue.missing) > 0 {
+			fmt.Fprintf(os.Stderr, "ERROR: %s: %d referenced parent rows do not exist in the source (changed during extraction?): %s\n",
+				ref, len(issue.missing), formatKeys(issue.missing))
+			missingTotal += len(issue.missing)
+		}
+	}
+
+	if missingTotal > 0 {
+		return fmt.Errorf("source verification failed: %d references to non-existent parent rows", missingTotal)
+	}
+	return nil
+}
+
+// verifyFK checks a single relation.
+func (e *Extractor) verifyFK(ctx context.Context, fk schema.ForeignKey) (verifyIssue, error) {
+	issue := verifyIssue{fk: fk}
+	if fk.Virtual == schema.VirtualJSON || fk.Virtual == schema.VirtualSQL {
+		return issue, nil
+	}
+
+	child := e.g.Tables[fk.ChildSchema+"."+fk.ChildTable]
+	parent := e.g.Tables[fk.ParentSchema+"."+fk.ParentTable]
+	if child == nil || parent == nil {
+		return issue, nil
+	}
+
+	collected := e.parentSeen(fk)
+	var unresolved [][]any
+	if rs, ok := e.refs[child.FullName()][fk.Name]; ok {
+		err := rs.keys.batches(e.batchSize(), func(batch [][]any) error {
+			for _, key := range batch {
+				if _, ok := collected.get(encodeKey(key)); !ok {
+					unresolved = append(unresolved, key)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return issue, err
+		}
+	}
+	if len(unresolved) == 0 {
+		return issue, nil
+	}
+
+	existing, err := e.existingKeys(ctx, parent, fk.ParentColumns, unresolved)
+	if err != nil {
+		return issue, err
+	}
+	for _, ref := range unresolved {
+		if existing[encodeKey(ref)] {
+			issue.notCollected = append(issue.notCollected, ref)
+		} else {
+			issue.missing = append(issue.missing, ref)
+		}
+	}
+	return issue, nil
+}
+
+// existingKeys returns the subset of keys that exist in the source table.
+func (e *Extractor) existingKeys(ctx context.Context, table *schema.Table, cols []string, keys [][]any) (map[string]bool, error) {
+	quoted := schema.QuoteIdents(cols)
+	cond, args, _ := buildKeyMatch(quoted, columnTypes(table, cols), keys, 1)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoted, ", "), table.FromName(), cond)
+
+	existing := make(map[string]bool)
+	err := e.forEachRow(ctx, table, query, args, func(values []any) error {
+		existing[encodeKey(values)] = true
+		return nil
+	})
+	return existing, err
+}
+
+// columnIndexes maps column names to their position in a fetched row.
+func columnIndexes(table *schema.Table) map[string]int {
+	idx := make(map[string]int, len(table.Columns))
+	for i, col := range table.Columns {
+		idx[col.Name] = i
+	}
+	return idx
+}
+
+// formatKeys renders up to maxReportedValues keys for a report line.
+func formatKeys(keys [][]any) string {
+	parts := make([]string, 0, maxReportedValues+1)
+	for i, key := range keys {
+		if i == maxReportedValues {
+			parts = append(parts, fmt.Sprintf("... (%d more)", len(keys)-maxReportedValues))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%v", key))
+	}
+	return strings.Join(parts, " ")
+}
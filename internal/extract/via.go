@@ -0,0 +1,129 @@
+package extract
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// CheckRoot reports an error if the table of root is not in g or its via
+// relation cannot be resolved.
+func CheckRoot(g *graph.Graph, root config.Root) error {
+	keys := g.TableKeys(root.Table)
+	switch len(keys) {
+	case 0:
+		return fmt.Errorf("root table %q not found in schema", root.Table)
+	case 1:
+	default:
+		sort.Strings(keys)
+		return fmt.Errorf("root table %q is ambiguous (%s); qualify it with the schema", root.Table, strings.Join(keys, ", "))
+	}
+	_, err := rootWhere(g, g.Tables[keys[0]], root)
+	return err
+}
+
+// rootTables returns the roots keyed by the full name of their table, as
+// resolved by CheckRoot.
+func (e *Extractor) rootTables() map[string]config.Root {
+	roots := make(map[string]config.Root)
+	for _, r := range e.cfg.Roots {
+		if keys := e.g.TableKeys(r.Table); len(keys) == 1 {
+			roots[keys[0]] = r
+		}
+	}
+	return roots
+}
+
+// rootWhere returns the WHERE condition of a root table: root.Where, ANDed
+// with the condition of root.Via if set.
+func rootWhere(g *graph.Graph, table *schema.Table, root config.Root) (string, error) {
+	if root.Via == nil {
+		return root.Where, nil
+	}
+	cond, err := viaCondition(g, table, root.Via)
+	if err != nil {
+		return "", fmt.Errorf("root %s: %w", table.FullName(), err)
+	}
+	if root.Where != "" {
+		cond = fmt.Sprintf("%s AND (%s)", cond, root.Where)
+	}
+	return cond, nil
+}
+
+// viaCondition builds the condition selecting the rows of table related to
+// the rows of via.Table matching via.Where:
+//
+//	(fk_cols) IN (SELECT pk_cols FROM via WHERE ...)   -- table references via
+//	(pk_cols) IN (SELECT fk_cols FROM via WHERE ...)   -- via references table
+func viaCondition(g *graph.Graph, table *schema.Table, via *config.Via) (string, error) {
+	keys := g.TableKeys(via.Table)
+	if len(keys) != 1 {
+		if len(keys) == 0 {
+			return "", fmt.Errorf("via table %q not found in schema", via.Table)
+		}
+		sort.Strings(keys)
+		return "", fmt.Errorf("via table %q is ambiguous (%s); qualify it with the schema", via.Table, strings.Join(keys, ", "))
+	}
+	other := g.Tables[keys[0]]
+
+	type match struct {
+		fk   schema.ForeignKey
+		cols []string // columns of table
+		sub  []string // columns of the via table
+	}
+	var matches []match
+	consider := func(fk schema.ForeignKey, parent *schema.Table, cols, sub []string) {
+		if fk.ParentSchema+"."+fk.ParentTable != parent.FullName() || (via.FK != "" && fk.Name != via.FK) {
+			return
+		}
+		if fk.Virtual != schema.VirtualNone && fk.Virtual != schema.VirtualColumn && fk.Virtual != schema.VirtualPolymorphic {
+			return
+		}
+		matches = append(matches, match{fk: fk, cols: cols, sub: sub})
+	}
+	for _, fk := range table.ForeignKeys {
+		consider(fk, other, fk.ChildColumns, fk.ParentColumns)
+	}
+	if other != table {
+		for _, fk := range other.ForeignKeys {
+			consider(fk, table, fk.ParentColumns, fk.ChildColumns)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no FK between %s and via table %s", table.FullName(), other.FullName())
+	case 1:
+	default:
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = m.fk.Name
+		}
+		return "", fmt.Errorf("several FKs between %s and via table %s, set via.fk to one of: %s",
+			table.FullName(), other.FullName(), strings.Join(names, ", "))
+	}
+
+	m := matches[0]
+	var outer, inner []string
+	if via.Where != "" {
+		inner = append(inner, "("+via.Where+")")
+	}
+	if m.fk.Virtual == schema.VirtualPolymorphic {
+		typeCond := fmt.Sprintf("%s = %s", schema.QuoteIdent(m.fk.TypeColumn), quoteLiteral(m.fk.TypeValue))
+		if m.fk.ChildSchema+"."+m.fk.ChildTable == table.FullName() {
+			outer = append(outer, typeCond)
+		} else {
+			inner = append(inner, typeCond)
+		}
+	}
+	sub := fmt.Sprintf("SELECT %s FROM %s", strings.Join(schema.QuoteIdents(m.sub), ", "), other.FromName())
+	if len(inner) > 0 {
+		sub += " WHERE " + strings.Join(inner, " AND ")
+	}
+	outer = append(outer, fmt.Sprintf("(%s) IN (%s)", strings.Join(schema.QuoteIdents(m.cols), ", "), sub))
+	return strings.Join(outer, " AND "), nil
+}
@@ -0,0 +1,264 @@
+package golden
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// fileExt is the extension of per-table fixture files.
+const fileExt = ".copy"
+
+// maxDiffLines caps how many added/removed rows are printed per table.
+const maxDiffLines = 10
+
+// fixture is the normalized content of one table.
+type fixture struct {
+	columns string
+	rows    []string
+}
+
+// Writer is an output.TableWriter that normalizes the extract into one
+// fixture file per table (column header + rows sorted lexically), and either
+// writes them into a directory or compares them against it.
+type Writer struct {
+	dir    string
+	check  bool
+	out    io.Writer
+	tables map[string]*fixture
+
+	// table and current are the table being written
+	table   string
+	current *fixture
+}
+
+// NewWriter creates a golden writer. With check=false, fixtures in dir are
+// replaced; with check=true, WriteFooter compares against dir, prints per-table
+// diffs to out, and returns an error if anything changed.
+func NewWriter(dir string, check bool, out io.Writer) *Writer {
+	return &Writer{dir: dir, check: check, out: out, tables: make(map[string]*fixture)}
+}
+
+// WriteHeader implements output.TableWriter. The header is not part of the fixture.
+func (gw *Writer) WriteHeader(output.Header) error {
+	return nil
+}
+
+// BeginTable implements output.TableWriter.
+func (gw *Writer) BeginTable(table *schema.Table) error {
+	fx, ok := gw.tables[table.FullName()]
+	if !ok {
+		fx = &fixture{columns: strings.Join(table.ColumnNames(), "\t")}
+	}
+	gw.table = table.FullName()
+	gw.current = fx
+	return nil
+}
+
+// WriteRow implements output.TableWriter.
+func (gw *Writer) WriteRow(row []any) error {
+	// Tables without rows get no fixture
+	gw.tables[gw.table] = gw.current
+	gw.current.rows = append(gw.current.rows, output.FormatRow(row))
+	return nil
+}
+
+// EndTable implements output.TableWriter.
+func (gw *Writer) EndTable() error {
+	gw.current = nil
+	return nil
+}
+
+// WriteFooter implements output.TableWriter by writing or checking the fixtures.
+func (gw *Writer) WriteFooter(output.Footer) error {
+	for _, fx := range gw.tables {
+		sort.Strings(fx.rows)
+	}
+	if gw.check {
+		return gw.compare()
+	}
+	return gw.write()
+}
+
+func (gw *Writer) write() error {
+	if err := os.MkdirAll(gw.dir, 0o755); err != nil {
+		return fmt.Errorf("creating golden directory: %w", err)
+	}
+
+	// Remove fixtures of tables that no longer have rows
+	existing, err := listFixtures(gw.dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range existing {
+		if _, ok := gw.tables[name]; !ok {
+			if err := os.Remove(fixturePath(gw.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, fx := range gw.tables {
+		var b strings.Builder
+		b.WriteString(fx.columns)
+		b.WriteString("\n")
+		for _, row := range fx.rows {
+			b.WriteString(row)
+			b.WriteString("\n")
+		}
+		if err := os.WriteFile(fixturePath(gw.dir, name), []byte(b.String()), 0o644); err != nil {
+			return fmt.Errorf("writing golden fixture %s: %w", name, err)
+		}
+	}
+	fmt.Fprintf(gw.out, "Golden fixtures updated: %d tables in %s\n", len(gw.tables), gw.dir)
+	return nil
+}
+
+func (gw *Writer) compare() error {
+	existing, err := listFixtures(gw.dir)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, name := range existing {
+		names[name] = true
+	}
+	for name := range gw.tables {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	changed := 0
+	for _, name := range sorted {
+		want, err := readFixture(gw.dir, name)
+		if err != nil {
+			return err
+		}
+		got := gw.tables[name]
+		if got == nil {
+			got = &fixture{}
+		}
+		if gw.diff(name, want, got) {
+			changed++
+		}
+	}
+
+	if changed > 0 {
+		return fmt.Errorf("golden check failed: %d tables differ from %s", changed, gw.dir)
+	}
+	fmt.Fprintf(gw.out, "Golden fixtures match: %d tables\n", len(sorted))
+	return nil
+}
+
+// diff prints the differences for one table and reports whether any exist.
+func (gw *Writer) diff(name string, want, got *fixture) bool {
+	if want == nil {
+		fmt.Fprintf(gw.out, "=== %s: new table (%d rows)\n", name, len(got.rows))
+		return true
+	}
+	if want.columns != got.columns && len(got.rows) > 0 {
+		fmt.Fprintf(gw.out, "=== %s: columns changed\n  - %s\n  + %s\n", name, want.columns, got.columns)
+		return true
+	}
+
+	added, removed := diffSorted(want.rows, got.rows)
+	if len(added) == 0 && len(removed) == 0 {
+		return false
+	}
+	fmt.Fprintf(gw.out, "=== %s: +%d -%d rows\n", name, len(added), len(removed))
+	printLines(gw.out, "-", removed)
+	printLines(gw.out, "+", added)
+	return true
+}
+
+// diffSorted returns rows only in got (added) and only in want (removed).
+// Both inputs must be sorted.
+func diffSorted(want, got []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(want) && j < len(got) {
+		switch {
+		case want[i] == got[j]:
+			i++
+			j++
+		case want[i] < got[j]:
+			removed = append(removed, want[i])
+			i++
+		default:
+			added = append(added, got[j])
+			j++
+		}
+	}
+	removed = append(removed, want[i:]...)
+	added = append(added, got[j:]...)
+	return added, removed
+}
+
+func printLines(w io.Writer, prefix string, lines []string) {
+	for i, line := range lines {
+		if i == maxDiffLines {
+			fmt.Fprintf(w, "  %s ... (%d more)\n", prefix, len(lines)-maxDiffLines)
+			return
+		}
+		fmt.Fprintf(w, "  %s %s\n", prefix, line)
+	}
+}
+
+func fixturePath(dir, table string) string {
+	return filepath.Join(dir, table+fileExt)
+}
+
+// listFixtures returns the table names of fixture files in dir.
+func listFixtures(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading golden directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), fileExt); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// readFixture loads a fixture file, returning nil if it does not exist.
+func readFixture(dir, table string) (*fixture, error) {
+	f, err := os.Open(fixturePath(dir, table))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fx := &fixture{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<30)
+	first := true
+	for sc.Scan() {
+		if first {
+			fx.columns = sc.Text()
+			first = false
+			continue
+		}
+		fx.rows = append(fx.rows, sc.Text())
+	}
+	return fx, sc.Err()
+}
@@ -31,12 +31,27 @@ type Graph struct {
 	// Parents maps child full name → list of parent full names
 	Parents map[string][]string
 
+	// ExcludedRefs are FK edges from in-scope tables to tables removed by exclude_tables
+	ExcludedRefs []Edge
+
+	// Excluded maps the full names of the tables removed by excludeSet to the tables
+	Excluded map[string]*schema.Table
+
 	// adjacency for undirected connectivity
 	Adjacency map[string]map[string]bool
+
+	// Broken are the FK edges ignored by TopoSort (see BreakCycles), by
+	// child full name and FK name
+	Broken map[string]bool
+
+	// Views are the views and materialized views shown with the tables by
+	// WriteMermaid and WriteText (set by analyze --views); they are not
+	// part of the FK graph
+	Views []schema.View
 }
 
 // Build constructs a directed graph from introspected tables.
-// Tables in excludeSet are skipped. FKs referencing tables outside
+// Tables in excludeSet (full names) are skipped. FKs referencing tables outside
 // the known set are ignored. virtualRelations are injected as additional FK edges.
 func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualRelations []config.VirtualRelation) *Graph {
 	g := &Graph{
@@ -45,11 +60,13 @@ func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualR
 		Children:  make(map[string][]string),
 		Parents:   make(map[string][]string),
 		Adjacency: make(map[string]map[string]bool),
+		Excluded:  make(map[string]*schema.Table),
 	}
 
 	// Filter excluded tables
 	for name, tbl := range tables {
-		if excludeSet[tbl.Name] {
+		if excludeSet[name] {
+			g.Excluded[name] = tbl
 			continue
 		}
 		g.Tables[name] = tbl
@@ -66,7 +83,7 @@ func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualR
 		child := g.Tables[childKey]
 		parent := g.Tables[parentKey]
 		fk := schema.ForeignKey{
-			Name:          fmt.Sprintf("virtual_%s_%s_%s", child.Name, vr.ChildColumn, parent.Name),
+			Name:          virtualName(child, parent, vr),
 			ChildSchema:   child.Schema,
 			ChildTable:    child.Name,
 			ChildColumns:  []string{vr.ChildColumn},
@@ -76,6 +93,34 @@ func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualR
 			IsSelfRef:     childKey == parentKey,
 			Virtual:       schema.VirtualType(vr.Type),
 			JSONPath:      vr.JSONPath,
+			TypeColumn:    vr.TypeColumn,
+			TypeValue:     vr.TypeValue,
+		}
+		if fk.Virtual == schema.VirtualSQL {
+			// The condition relates the rows; parents are matched by their
+			// primary key, or a unique key
+			if parent.KeyColumns() == nil {
+				continue
+			}
+			fk.ChildColumns = nil
+			fk.ParentColumns = parent.KeyColumns()
+			fk.Condition = vr.Condition
+			for _, c := range fk.ParentColumns {
+				col := parent.Column(c)
+				typ := col.SQLType
+				if typ == "" {
+					typ = col.DataType
+				}
+				fk.ParentTypes = append(fk.ParentTypes, typ)
+			}
+		}
+		if fk.Virtual == schema.VirtualJSON {
+			if col := parent.Column(vr.ParentColumn); col != nil {
+				fk.JSONType = col.SQLType
+				if fk.JSONType == "" {
+					fk.JSONType = col.DataType
+				}
+			}
 		}
 		child.ForeignKeys = append(child.ForeignKeys, fk)
 	}
@@ -85,6 +130,9 @@ func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualR
 		for _, fk := range tbl.ForeignKeys {
 			parentKey := fk.ParentSchema + "." + fk.ParentTable
 			if _, ok := g.Tables[parentKey]; !ok {
+				if _, known := tables[parentKey]; known {
+					g.ExcludedRefs = append(g.ExcludedRefs, Edge{FK: fk, ChildTable: name, ParentTable: parentKey})
+				}
 				continue // parent table not in scope
 			}
 
@@ -109,19 +157,39 @@ func Build(tables map[string]*schema.Table, excludeSet map[string]bool, virtualR
 	return g
 }
 
-// findTableKey finds the full "schema.table" key by unqualified table name.
-func findTableKey(tables map[string]*schema.Table, name string) string {
-	// Try as-is first (already qualified)
-	if _, ok := tables[name]; ok {
-		return name
+// virtualName returns the name of the FK injected for a virtual relation.
+func virtualName(child, parent *schema.Table, vr config.VirtualRelation) string {
+	if vr.Type == string(schema.VirtualSQL) {
+		return fmt.Sprintf("virtual_%s_%s", child.Name, parent.Name)
+	}
+	if vr.TypeColumn != "" {
+		return fmt.Sprintf("polymorphic_%s_%s_%s", child.Name, vr.ChildColumn, vr.TypeValue)
 	}
-	// Search by unqualified name
-	for key, tbl := range tables {
-		if tbl.Name == name {
-			return key
+	return fmt.Sprintf("virtual_%s_%s_%s", child.Name, vr.ChildColumn, parent.Name)
+}
+
+// findTableKey finds the full "schema.table" key of a qualified or
+// unqualified table name; ambiguous names (reported by
+// config.CheckTableNames) find none.
+func findTableKey(tables map[string]*schema.Table, name string) string {
+	key, _ := config.ResolveTable(tables, name)
+	return key
+}
+
+// BreakCycles makes TopoSort ignore the FK edges whose FK breaks reports,
+// so the FK cycles through them no longer constrain the table order.
+func (g *Graph) BreakCycles(breaks func(fk schema.ForeignKey) bool) {
+	g.Broken = make(map[string]bool)
+	for _, e := range g.Edges {
+		if breaks(e.FK) {
+			g.Broken[e.ChildTable+"/"+e.FK.Name] = true
 		}
 	}
-	return ""
+}
+
+// IsBroken reports whether TopoSort ignores an edge.
+func (g *Graph) IsBroken(e Edge) bool {
+	return g.Broken[e.ChildTable+"/"+e.FK.Name]
 }
 
 // Roots returns tables that have no outgoing FK edges (no parents).
@@ -5,10 +5,12 @@ import (
 	"io"
 	"sort"
 	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
 )
 
 // WriteMermaid writes the graph in Mermaid format to w.
-// Each connected component is a subgraph.
+// Each connected component is a subgraph, followed by the views if set.
 func WriteMermaid(w io.Writer, g *Graph) error {
 	components := FindComponents(g)
 
@@ -42,23 +44,22 @@ func WriteMermaid(w io.Writer, g *Graph) error {
 			if !tableSet[edge.ChildTable] {
 				continue
 			}
-			label := strings.Join(edge.FK.ChildColumns, ", ")
+			label := mermaidLabel(edge.FK.ChildColumns)
 			edgeKey := fmt.Sprintf("%s-->%s:%s", mermaidID(edge.ChildTable), mermaidID(edge.ParentTable), label)
 			if edgesWritten[edgeKey] {
 				continue
 			}
 			edgesWritten[edgeKey] = true
 			fmt.Fprintf(w, "        %s -->|%s| %s\n",
-				mermaidID(edge.ChildTable), label, mermaidID(edge.ParentTable))
+				mermaidNode(edge.ChildTable), label, mermaidNode(edge.ParentTable))
 		}
 
 		// Write self-referential edges
 		for _, t := range comp.Tables {
 			if selfRefs, ok := g.SelfRefs[t]; ok {
 				for _, fk := range selfRefs {
-					label := strings.Join(fk.ChildColumns, ", ")
 					fmt.Fprintf(w, "        %s -->|%s| %s\n",
-						mermaidID(t), label, mermaidID(t))
+						mermaidNode(t), mermaidLabel(fk.ChildColumns), mermaidNode(t))
 				}
 			}
 		}
@@ -66,7 +67,7 @@ func WriteMermaid(w io.Writer, g *Graph) error {
 		// Write standalone nodes (roots with no edges in this component)
 		for _, t := range comp.Tables {
 			if !hasEdge(g, t, tableSet) {
-				fmt.Fprintf(w, "        %s\n", mermaidID(t))
+				fmt.Fprintf(w, "        %s\n", mermaidNode(t))
 			}
 		}
 
@@ -75,6 +76,7 @@ func WriteMermaid(w io.Writer, g *Graph) error {
 			fmt.Fprintln(w)
 		}
 	}
+	writeMermaidViews(w, g)
 
 	return nil
 }
@@ -103,7 +105,12 @@ func WriteText(w io.Writer, g *Graph) error {
 
 	topoResult := TopoSortAll(g)
 	if topoResult.HasCycle {
-		fmt.Fprintf(w, "WARNING: Circular dependencies detected: %v\n\n", topoResult.CycleTables)
+		fmt.Fprintf(w, "WARNING: Circular dependencies detected: %v\n", topoResult.CycleTables)
+		for _, c := range topoResult.Cycles {
+			fmt.Fprintf(w, "  cycle: %s\n", c)
+			fmt.Fprintf(w, "    hint: %s\n", c.Hint())
+		}
+		fmt.Fprintln(w)
 	}
 
 	// Warn about tables without PKs
@@ -161,13 +168,42 @@ func WriteText(w io.Writer, g *Graph) error {
 		}
 		fmt.Fprintln(w)
 	}
+	writeTextViews(w, g)
 
 	return nil
 }
 
 // mermaidID converts a schema.table name to a Mermaid-safe node ID.
+// mermaidID returns the node ID of a table: its name with the dot and the
+// other characters Mermaid IDs cannot hold replaced by underscores.
 func mermaidID(fullName string) string {
-	return strings.ReplaceAll(fullName, ".", "_")
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, fullName)
+}
+
+// mermaidNode returns the node of a table, labelled with its quoted name
+// when the name needs quoting (mixed case, spaces, reserved words).
+func mermaidNode(fullName string) string {
+	quoted := schema.QuoteQualified(fullName)
+	if quoted == fullName {
+		return mermaidID(fullName)
+	}
+	return mermaidID(fullName) + `["` + mermaidEscape(quoted) + `"]`
+}
+
+// mermaidLabel returns the edge label listing the quoted FK columns.
+func mermaidLabel(cols []string) string {
+	return mermaidEscape(strings.Join(schema.QuoteIdents(cols), ", "))
+}
+
+// mermaidEscape replaces the characters that end a Mermaid label with
+// entity codes.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(s)
 }
 
 func hasEdge(g *Graph, table string, componentTables map[string]bool) bool {
@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Step is one FK edge of a path, traversed from child to parent (Up) or from
+// parent to child.
+type Step struct {
+	Edge Edge
+	Up   bool
+}
+
+// From returns the table the step starts at.
+func (s Step) From() string {
+	if s.Up {
+		return s.Edge.ChildTable
+	}
+	return s.Edge.ParentTable
+}
+
+// To returns the table the step ends at.
+func (s Step) To() string {
+	if s.Up {
+		return s.Edge.ParentTable
+	}
+	return s.Edge.ChildTable
+}
+
+// Paths returns every simple path of at most maxDepth FK edges between from
+// and to, following edges in either direction. Paths are ordered by length.
+func (g *Graph) Paths(from, to string, maxDepth int) [][]Step {
+	steps := make(map[string][]Step)
+	for _, edge := range g.Edges {
+		steps[edge.ChildTable] = append(steps[edge.ChildTable], Step{Edge: edge, Up: true})
+		steps[edge.ParentTable] = append(steps[edge.ParentTable], Step{Edge: edge})
+	}
+
+	var paths [][]Step
+	visited := map[string]bool{from: true}
+	var path []Step
+	var dfs func(node string)
+	dfs = func(node string) {
+		if node == to {
+			paths = append(paths, append([]Step(nil), path...))
+			return
+		}
+		if len(path) == maxDepth {
+			return
+		}
+		for _, s := range steps[node] {
+			next := s.To()
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			path = append(path, s)
+			dfs(next)
+			path = path[:len(path)-1]
+			visited[next] = false
+		}
+	}
+	if from != to {
+		dfs(from)
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return formatPath(paths[i]) < formatPath(paths[j])
+	})
+	return paths
+}
+
+// WritePaths writes paths, one step per line with the FK columns and
+// constraint name, e.g.
+//
+//	public.orders.user_id → public.users.id  (orders_user_id_fkey)
+func WritePaths(w io.Writer, from, to string, paths [][]Step) {
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "No FK path between %s and %s\n", from, to)
+		return
+	}
+	fmt.Fprintf(w, "%d paths between %s and %s:\n", len(paths), from, to)
+	for i, path := range paths {
+		fmt.Fprintf(w, "\nPath %d (%d hops): %s\n", i+1, len(path), formatPath(path))
+		for _, s := range path {
+			dir := "parent"
+			if !s.Up {
+				dir = "child"
+			}
+			fmt.Fprintf(w, "  %s → %s  [%s: %s]\n", s.From(), s.To(), dir, formatEdge(s.Edge))
+		}
+	}
+}
+
+// formatEdge describes a FK as "child.cols → parent.cols (name)".
+func formatEdge(e Edge) string {
+	return fmt.Sprintf("%s.%s → %s.%s (%s)",
+		e.ChildTable, strings.Join(e.FK.ChildColumns, ","),
+		e.ParentTable, strings.Join(e.FK.ParentColumns, ","), e.FK.Name)
+}
+
+func formatPath(path []Step) string {
+	if len(path) == 0 {
+		return ""
+	}
+	names := []string{path[0].From()}
+	for _, s := range path {
+		names = append(names, s.To())
+	}
+	return strings.Join(names, " - ")
+}
@@ -0,0 +1,92 @@
+package graph
+
+import "github.com/hurou927/db-sub-data/internal/schema"
+
+// TableKeys returns the full names of tables matching name, either
+// schema-qualified or unqualified (in any schema).
+func (g *Graph) TableKeys(name string) []string {
+	if _, ok := g.Tables[name]; ok {
+		return []string{name}
+	}
+	var keys []string
+	for key, tbl := range g.Tables {
+		if tbl.Name == name {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Reachable returns the tables an extraction can touch: the tables reached
+// from childRoots by following FKs from parent to child, plus every table
+// referenced (transitively) by those tables or by parentRoots.
+func (g *Graph) Reachable(childRoots, parentRoots []string) map[string]bool {
+	down := walk(childRoots, g.Children)
+	start := append([]string(nil), parentRoots...)
+	for t := range down {
+		start = append(start, t)
+	}
+	return walk(start, g.Parents)
+}
+
+// walk returns start and every table reachable from it through next.
+func walk(start []string, next map[string][]string) map[string]bool {
+	visited := make(map[string]bool)
+	queue := make([]string, 0, len(start))
+	for _, t := range start {
+		if !visited[t] {
+			visited[t] = true
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, n := range next[node] {
+			if !visited[n] {
+				visited[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return visited
+}
+
+// Subgraph returns a copy of the graph restricted to the tables in keep.
+// Edges to tables outside keep are dropped.
+func (g *Graph) Subgraph(keep map[string]bool) *Graph {
+	sub := &Graph{
+		Tables:    make(map[string]*schema.Table),
+		SelfRefs:  make(map[string][]schema.ForeignKey),
+		Children:  make(map[string][]string),
+		Parents:   make(map[string][]string),
+		Adjacency: make(map[string]map[string]bool),
+	}
+	for name, tbl := range g.Tables {
+		if keep[name] {
+			sub.Tables[name] = tbl
+			sub.Adjacency[name] = make(map[string]bool)
+		}
+	}
+	for name, fks := range g.SelfRefs {
+		if keep[name] {
+			sub.SelfRefs[name] = fks
+		}
+	}
+	for _, edge := range g.Edges {
+		if !keep[edge.ChildTable] || !keep[edge.ParentTable] {
+			continue
+		}
+		sub.Edges = append(sub.Edges, edge)
+		sub.Children[edge.ParentTable] = append(sub.Children[edge.ParentTable], edge.ChildTable)
+		sub.Parents[edge.ChildTable] = append(sub.Parents[edge.ChildTable], edge.ParentTable)
+		sub.Adjacency[edge.ChildTable][edge.ParentTable] = true
+		sub.Adjacency[edge.ParentTable][edge.ChildTable] = true
+	}
+	for _, edge := range g.ExcludedRefs {
+		if keep[edge.ChildTable] {
+			sub.ExcludedRefs = append(sub.ExcludedRefs, edge)
+		}
+	}
+	return sub
+}
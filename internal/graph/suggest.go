@@ -0,0 +1,156 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// keySuffixes are column name suffixes that usually hold a reference to another table's key.
+var keySuffixes = []string{"id", "uuid"}
+
+// SuggestVirtualRelations proposes virtual relations for columns that look like
+// references by naming convention (e.g. user_id → users.id, tag_ids → tags.id)
+// and whose type matches the candidate parent's single-column PK, but that are
+// not covered by any FK constraint or configured virtual relation. Tables
+// are named schema-qualified where the bare name exists in several schemas
+// (see config.TableName).
+func SuggestVirtualRelations(g *Graph) []config.VirtualRelation {
+	names := make([]string, 0, len(g.Tables))
+	// all holds the excluded tables too, whose names make bare names ambiguous
+	all := make(map[string]*schema.Table, len(g.Tables)+len(g.Excluded))
+	for name, tbl := range g.Tables {
+		names = append(names, name)
+		all[name] = tbl
+	}
+	for name, tbl := range g.Excluded {
+		all[name] = tbl
+	}
+	sort.Strings(names)
+
+	var suggestions []config.VirtualRelation
+	for _, name := range names {
+		tbl := g.Tables[name]
+
+		// Columns already covered by a (real or virtual) FK are not candidates
+		covered := make(map[string]bool)
+		for _, fk := range tbl.ForeignKeys {
+			for _, c := range fk.ChildColumns {
+				covered[c] = true
+			}
+		}
+
+		for _, col := range tbl.Columns {
+			if covered[col.Name] {
+				continue
+			}
+			if vr, ok := suggestForColumn(g, all, tbl, col); ok {
+				suggestions = append(suggestions, vr)
+			}
+		}
+	}
+	return suggestions
+}
+
+// suggestForColumn tries to match a single column against the PK of another table.
+func suggestForColumn(g *Graph, all map[string]*schema.Table, tbl *schema.Table, col schema.Column) (config.VirtualRelation, bool) {
+	for _, suffix := range keySuffixes {
+		// Scalar reference: <base>_<suffix> with the same type as the parent PK
+		if base, ok := strings.CutSuffix(col.Name, "_"+suffix); ok && base != "" {
+			if parent, pkCol := findParentByBase(g, tbl, base, suffix); parent != nil && pkCol.DataType == col.DataType {
+				return config.VirtualRelation{
+					ChildTable:   config.TableName(all, tbl),
+					ChildColumn:  col.Name,
+					Type:         string(schema.VirtualColumn),
+					ParentTable:  config.TableName(all, parent),
+					ParentColumn: pkCol.Name,
+				}, true
+			}
+		}
+
+		// Array reference: <base>_<suffix>s whose element type matches the parent PK
+		if base, ok := strings.CutSuffix(col.Name, "_"+suffix+"s"); ok && base != "" {
+			if parent, pkCol := findParentByBase(g, tbl, base, suffix); parent != nil && "_"+pkCol.DataType == col.DataType {
+				return config.VirtualRelation{
+					ChildTable:   config.TableName(all, tbl),
+					ChildColumn:  col.Name,
+					Type:         string(schema.VirtualArray),
+					ParentTable:  config.TableName(all, parent),
+					ParentColumn: pkCol.Name,
+				}, true
+			}
+		}
+	}
+	return config.VirtualRelation{}, false
+}
+
+// findParentByBase looks for a table named after base (singular or plural) whose
+// single-column PK is named <suffix> or <base>_<suffix>. Tables in the child's own
+// schema are preferred over same-named tables in other schemas.
+func findParentByBase(g *Graph, child *schema.Table, base, suffix string) (*schema.Table, *schema.Column) {
+	for _, candidate := range tableNameCandidates(base) {
+		var matches []*schema.Table
+		for _, tbl := range g.Tables {
+			if tbl.Name != candidate {
+				continue
+			}
+			pk := tbl.PKColumnNames()
+			if len(pk) != 1 || (pk[0] != suffix && pk[0] != base+"_"+suffix) {
+				continue
+			}
+			matches = append(matches, tbl)
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			iSame, jSame := matches[i].Schema == child.Schema, matches[j].Schema == child.Schema
+			if iSame != jSame {
+				return iSame
+			}
+			return matches[i].FullName() < matches[j].FullName()
+		})
+		best := matches[0]
+		if col := best.Column(best.PKColumnNames()[0]); col != nil {
+			return best, col
+		}
+	}
+	return nil, nil
+}
+
+// tableNameCandidates returns plausible table names for a reference base name.
+func tableNameCandidates(base string) []string {
+	candidates := []string{base, base + "s", base + "es"}
+	if stem, ok := strings.CutSuffix(base, "y"); ok {
+		candidates = append(candidates, stem+"ies")
+	}
+	return candidates
+}
+
+// WriteSuggestions writes suggested virtual relations as a ready-to-paste
+// virtual_relations YAML block.
+func WriteSuggestions(w io.Writer, suggestions []config.VirtualRelation) error {
+	if len(suggestions) == 0 {
+		_, err := fmt.Fprintln(w, "# No virtual relation candidates found.")
+		return err
+	}
+
+	fmt.Fprintf(w, "# %d virtual relation candidate(s) inferred from column names and types.\n", len(suggestions))
+	fmt.Fprintln(w, "# Review before pasting into the config file.")
+	fmt.Fprintln(w, "virtual_relations:")
+	for i, vr := range suggestions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "  - child_table: %q\n", vr.ChildTable)
+		fmt.Fprintf(w, "    child_column: %q\n", vr.ChildColumn)
+		fmt.Fprintf(w, "    type: %q\n", vr.Type)
+		fmt.Fprintf(w, "    parent_table: %q\n", vr.ParentTable)
+		fmt.Fprintf(w, "    parent_column: %q\n", vr.ParentColumn)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+func TestSuggestVirtualRelationsQualifiesAmbiguousNames(t *testing.T) {
+	users := func(schemaName string) *schema.Table {
+		return &schema.Table{
+			Schema:     schemaName,
+			Name:       "users",
+			Columns:    []schema.Column{{Name: "id", DataType: "int8"}},
+			PrimaryKey: &schema.PrimaryKey{Columns: []string{"id"}},
+		}
+	}
+	tables := map[string]*schema.Table{
+		"public.users": users("public"),
+		"app.users":    users("app"),
+		"public.orders": {
+			Schema:     "public",
+			Name:       "orders",
+			Columns:    []schema.Column{{Name: "id", DataType: "int8"}, {Name: "user_id", DataType: "int8"}},
+			PrimaryKey: &schema.PrimaryKey{Columns: []string{"id"}},
+		},
+	}
+
+	suggestions := SuggestVirtualRelations(Build(tables, nil, nil))
+	if len(suggestions) != 1 {
+		t.Fatalf("got %d suggestions, want 1: %+v", len(suggestions), suggestions)
+	}
+	vr := suggestions[0]
+	if vr.ChildTable != "orders" || vr.ParentTable != "public.users" {
+		t.Errorf("got child_table %q, parent_table %q; want orders, public.users", vr.ChildTable, vr.ParentTable)
+	}
+	cfg := &config.Config{VirtualRelations: suggestions}
+	if err := cfg.CheckTableNames(tables); err != nil {
+		t.Errorf("suggested relations fail CheckTableNames: %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package graph
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // TopoResult holds the result of topological sorting.
 type TopoResult struct {
@@ -8,12 +12,52 @@ type TopoResult struct {
 	Order []string
 	// HasCycle is true if the graph contains a cycle.
 	HasCycle bool
-	// CycleTables lists tables involved in cycles (if any).
+	// CycleTables lists tables involved in cycles (if any), including tables
+	// that only depend on a cycle.
 	CycleTables []string
+	// Cycles holds the strongly connected groups of tables forming cycles.
+	Cycles []Cycle
+}
+
+// Cycle is a group of tables that reference each other through FKs.
+type Cycle struct {
+	Tables []string
+	// Edges are the FK edges between the tables; each lies on a cycle.
+	Edges []Edge
+	// Nullable are the edges whose FK columns are nullable. Deferring any of
+	// them (loading NULL first, or a DEFERRABLE constraint) breaks the cycles
+	// it lies on.
+	Nullable []Edge
+}
+
+// String lists the FK edges of the cycle, e.g. "a.b_id → b, b.a_id → a".
+func (c Cycle) String() string {
+	parts := make([]string, len(c.Edges))
+	for i, e := range c.Edges {
+		parts[i] = edgeRef(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Hint suggests how to break the cycle.
+func (c Cycle) Hint() string {
+	if len(c.Nullable) == 0 {
+		return "no FK in the cycle is nullable; it can only be loaded with FK checks disabled"
+	}
+	parts := make([]string, len(c.Nullable))
+	for i, e := range c.Nullable {
+		parts[i] = fmt.Sprintf("%s (%s)", edgeRef(e), e.FK.Name)
+	}
+	return "nullable FK that could be deferred (fk_rules break_cycle: update, or DEFERRABLE): " + strings.Join(parts, ", ")
+}
+
+func edgeRef(e Edge) string {
+	return fmt.Sprintf("%s.%s → %s", e.ChildTable, strings.Join(e.FK.ChildColumns, ","), e.ParentTable)
 }
 
 // TopoSort performs Kahn's algorithm on the given set of tables within the graph.
-// Returns tables in dependency order: parents first, then children.
+// Returns tables in dependency order: parents first, then children. Broken
+// edges (see Graph.BreakCycles) do not constrain the order.
 func TopoSort(g *Graph, tables []string) TopoResult {
 	tableSet := make(map[string]bool, len(tables))
 	for _, t := range tables {
@@ -28,11 +72,17 @@ func TopoSort(g *Graph, tables []string) TopoResult {
 	}
 
 	// Build local parent map (only edges within the subset)
+	edges := make(map[string][]Edge)
+	for _, e := range g.Edges {
+		if !g.IsBroken(e) {
+			edges[e.ChildTable] = append(edges[e.ChildTable], e)
+		}
+	}
 	localParents := make(map[string][]string)
 	localChildren := make(map[string][]string)
 	for _, t := range tables {
-		for _, p := range g.Parents[t] {
-			if tableSet[p] {
+		for _, e := range edges[t] {
+			if p := e.ParentTable; tableSet[p] {
 				localParents[t] = append(localParents[t], p)
 				localChildren[p] = append(localChildren[p], t)
 				inDegree[t]++
@@ -71,11 +121,107 @@ func TopoSort(g *Graph, tables []string) TopoResult {
 				result.CycleTables = append(result.CycleTables, t)
 			}
 		}
+		result.Cycles = findCycles(g, result.CycleTables)
 	}
 
 	return result
 }
 
+// findCycles returns the strongly connected components (Tarjan) of more than
+// one table among tables.
+func findCycles(g *Graph, tables []string) []Cycle {
+	inSet := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		inSet[t] = true
+	}
+	out := make(map[string][]Edge)
+	for _, e := range g.Edges {
+		if inSet[e.ChildTable] && inSet[e.ParentTable] && !g.IsBroken(e) {
+			out[e.ChildTable] = append(out[e.ChildTable], e)
+		}
+	}
+
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var sccs [][]string
+	var connect func(t string)
+	connect = func(t string) {
+		index[t] = len(index)
+		low[t] = index[t]
+		stack = append(stack, t)
+		onStack[t] = true
+		for _, e := range out[t] {
+			p := e.ParentTable
+			if _, seen := index[p]; !seen {
+				connect(p)
+				low[t] = min(low[t], low[p])
+			} else if onStack[p] {
+				low[t] = min(low[t], index[p])
+			}
+		}
+		if low[t] != index[t] {
+			return
+		}
+		var scc []string
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			scc = append(scc, n)
+			if n == t {
+				break
+			}
+		}
+		if len(scc) > 1 {
+			sccs = append(sccs, scc)
+		}
+	}
+	sorted := append([]string(nil), tables...)
+	sort.Strings(sorted)
+	for _, t := range sorted {
+		if _, seen := index[t]; !seen {
+			connect(t)
+		}
+	}
+
+	cycles := make([]Cycle, 0, len(sccs))
+	for _, scc := range sccs {
+		sort.Strings(scc)
+		member := make(map[string]bool, len(scc))
+		for _, t := range scc {
+			member[t] = true
+		}
+		c := Cycle{Tables: scc}
+		for _, t := range scc {
+			for _, e := range out[t] {
+				if !member[e.ParentTable] {
+					continue
+				}
+				c.Edges = append(c.Edges, e)
+				if isNullableFK(g, e) {
+					c.Nullable = append(c.Nullable, e)
+				}
+			}
+		}
+		cycles = append(cycles, c)
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Tables[0] < cycles[j].Tables[0] })
+	return cycles
+}
+
+// isNullableFK reports whether any FK column of the edge's child is nullable.
+func isNullableFK(g *Graph, e Edge) bool {
+	tbl := g.Tables[e.ChildTable]
+	for _, c := range e.FK.ChildColumns {
+		if col := tbl.Column(c); col != nil && col.Nullable {
+			return true
+		}
+	}
+	return false
+}
+
 // TopoSortAll performs topological sort across all tables in the graph.
 func TopoSortAll(g *Graph) TopoResult {
 	var all []string
@@ -90,5 +236,9 @@ func ValidateCycles(result TopoResult) error {
 	if !result.HasCycle {
 		return nil
 	}
-	return fmt.Errorf("circular dependency detected among tables: %v", result.CycleTables)
+	parts := make([]string, len(result.Cycles))
+	for i, c := range result.Cycles {
+		parts[i] = c.String()
+	}
+	return fmt.Errorf("circular dependency detected among tables: %v (%s)", result.CycleTables, strings.Join(parts, "; "))
 }
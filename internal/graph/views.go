@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// viewsInScope returns the views of g reading, directly or through other
+// views, a table of g, with their Uses restricted to those tables and views.
+func viewsInScope(g *Graph) []schema.View {
+	in := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, v := range g.Views {
+			if in[v.FullName()] {
+				continue
+			}
+			for _, u := range v.Uses {
+				if _, ok := g.Tables[u]; ok || in[u] {
+					in[v.FullName()] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	var views []schema.View
+	for _, v := range g.Views {
+		if !in[v.FullName()] {
+			continue
+		}
+		var uses []string
+		for _, u := range v.Uses {
+			if _, ok := g.Tables[u]; ok || in[u] {
+				uses = append(uses, u)
+			}
+		}
+		v.Uses = uses
+		views = append(views, v)
+	}
+	return views
+}
+
+// writeMermaidViews writes the views in scope as nodes, hexagons for views
+// and cylinders for materialized views, with dotted edges to the relations
+// they read.
+func writeMermaidViews(w io.Writer, g *Graph) {
+	views := viewsInScope(g)
+	if len(views) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    subgraph views")
+	for _, v := range views {
+		label := mermaidEscape(schema.QuoteQualified(v.FullName()))
+		if v.Materialized {
+			fmt.Fprintf(w, "        %s[(\"%s\")]\n", mermaidID(v.FullName()), label)
+		} else {
+			fmt.Fprintf(w, "        %s{{\"%s\"}}\n", mermaidID(v.FullName()), label)
+		}
+	}
+	fmt.Fprintln(w, "    end")
+	for _, v := range views {
+		for _, u := range v.Uses {
+			fmt.Fprintf(w, "    %s -.-> %s\n", mermaidID(v.FullName()), mermaidID(u))
+		}
+	}
+}
+
+// writeTextViews lists the views in scope with the relations they read.
+func writeTextViews(w io.Writer, g *Graph) {
+	views := viewsInScope(g)
+	if len(views) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== Views (%d) ===\n", len(views))
+	for _, v := range views {
+		kind := "view"
+		if v.Materialized {
+			kind = "materialized view"
+		}
+		fmt.Fprintf(w, "  %s (%s) reads %s\n", v.FullName(), kind, strings.Join(v.Uses, ", "))
+	}
+	fmt.Fprintln(w)
+}
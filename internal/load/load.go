@@ -0,0 +1,459 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/hurou927/db-sub-data/internal/output"
+)
+
+// Options controls how a dump is applied.
+type Options struct {
+	// CommitEvery commits after every N COPY rows (0 = no row-based chunking).
+	CommitEvery int64
+	// PerTable commits after every COPY block.
+	PerTable bool
+	// StateFile records the last committed position so a failed load can resume.
+	StateFile string
+	// Resume skips everything up to the position recorded in StateFile.
+	Resume  bool
+	Verbose bool
+	// CheckSchema is called with the schema fingerprint and table list found in
+	// the dump header, before any data is applied. Returning an error aborts the load.
+	CheckSchema func(ctx context.Context, fingerprint string, tables []string) error
+}
+
+// State is the last committed position of a chunked load.
+type State struct {
+	Block int    `json:"block"` // index of the COPY block (0-based)
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"` // rows of Block already committed
+}
+
+// Stats summarizes an applied dump.
+type Stats struct {
+	Tables  int
+	Rows    int64
+	Commits int
+}
+
+// loader applies a dump statement by statement inside managed transactions.
+type loader struct {
+	conn *pgx.Conn
+	tx   pgx.Tx
+	opts Options
+
+	// resume is the position to skip to (nil when not resuming)
+	resume *State
+	block  int
+	stats  Stats
+	// replica is set once session_replication_role is set to replica
+	replica bool
+}
+
+// Apply reads a dump produced by extract and applies it to conn. BEGIN/COMMIT
+// in the dump are ignored; transactions are managed according to opts.
+// session_replication_role is set to replica for the whole session (so it
+// survives chunk commits) and reset afterwards; the dump's own settings of it
+// are skipped. A dump disabling the triggers per table, or deferring its
+// constraints and loaded in a single transaction, runs without it, relying
+// on the dump's ALTER TABLE or SET CONSTRAINTS statements.
+func Apply(ctx context.Context, conn *pgx.Conn, r io.Reader, opts Options) (Stats, error) {
+	l := &loader{conn: conn, opts: opts}
+	defer func() {
+		if l.replica {
+			conn.Exec(context.Background(), "RESET session_replication_role")
+		}
+	}()
+
+	if opts.Resume {
+		st, err := readState(opts.StateFile)
+		if err != nil {
+			return l.stats, err
+		}
+		l.resume = st
+		if st != nil && opts.Verbose {
+			fmt.Fprintf(os.Stderr, "Resuming after %d committed rows of %s (block %d)\n", st.Rows, st.Table, st.Block)
+		}
+	}
+
+	if err := l.begin(ctx); err != nil {
+		return l.stats, err
+	}
+	defer func() {
+		if l.tx != nil {
+			l.tx.Rollback(context.Background())
+		}
+	}()
+
+	br := bufio.NewReader(r)
+	var pending strings.Builder
+	var headerTables []string
+	var hasDDL, deferred, noTriggers, started bool
+	for {
+		line, err := readLine(br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return l.stats, err
+		}
+
+		if v, ok := strings.CutPrefix(line, "-- schema-tables: "); ok && pending.Len() == 0 {
+			headerTables = strings.Split(v, ",")
+			continue
+		}
+		if line == "-- schema-ddl: included" && pending.Len() == 0 {
+			// The dump creates its tables, so there is no target schema to check
+			hasDDL = true
+			continue
+		}
+		if line == "-- constraints: deferred" && pending.Len() == 0 {
+			deferred = true
+			continue
+		}
+		if line == "-- triggers: disabled" && pending.Len() == 0 {
+			noTriggers = true
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "-- schema-fingerprint: "); ok && pending.Len() == 0 {
+			if opts.CheckSchema != nil && !hasDDL {
+				if err := opts.CheckSchema(ctx, v, headerTables); err != nil {
+					return l.stats, err
+				}
+			}
+			continue
+		}
+
+		if pending.Len() == 0 && (line == "" || strings.HasPrefix(line, "--")) {
+			continue
+		}
+		if !started {
+			// The header comments are read. The dump defers the checks only
+			// within its single transaction, not across chunk commits.
+			started = true
+			chunked := opts.CommitEvery > 0 || opts.PerTable
+			if !noTriggers && (!deferred || chunked) {
+				if err := l.setReplica(ctx); err != nil {
+					return l.stats, err
+				}
+			}
+		}
+
+		switch {
+		case pending.Len() == 0 && (line == "BEGIN;" || line == "COMMIT;"):
+			continue
+		case pending.Len() == 0 && strings.HasPrefix(line, "SET session_replication_role"):
+			continue
+		case pending.Len() == 0 && strings.HasPrefix(line, "COPY "):
+			if err := l.copyBlock(ctx, line, br); err != nil {
+				return l.stats, err
+			}
+			continue
+		}
+
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if !strings.HasSuffix(line, ";") {
+			continue
+		}
+		stmt := pending.String()
+		pending.Reset()
+		if err := l.exec(ctx, stmt); err != nil {
+			return l.stats, err
+		}
+	}
+
+	if err := l.commit(ctx, nil); err != nil {
+		return l.stats, err
+	}
+	l.tx = nil
+	if opts.StateFile != "" {
+		if err := os.Remove(opts.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return l.stats, err
+		}
+	}
+	return l.stats, nil
+}
+
+// setReplica sets session_replication_role to replica for the session.
+func (l *loader) setReplica(ctx context.Context) error {
+	if _, err := l.conn.Exec(ctx, "SET session_replication_role = 'replica'"); err != nil {
+		return fmt.Errorf("setting session_replication_role (requires superuser or SET privilege on it): %w", err)
+	}
+	l.replica = true
+	return nil
+}
+
+// exec runs a plain statement. While skipping to a resume point only SET
+// statements are replayed, so destructive statements are not run twice.
+func (l *loader) exec(ctx context.Context, stmt string) error {
+	if l.skipping() && !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(stmt)), "SET ") {
+		return nil
+	}
+	if _, err := l.tx.Exec(ctx, stmt); err != nil {
+		return fmt.Errorf("executing %q: %w", strings.TrimSpace(stmt), err)
+	}
+	return nil
+}
+
+// skipping reports whether statements at the current position were already
+// committed by the run being resumed.
+func (l *loader) skipping() bool {
+	if l.resume == nil {
+		return false
+	}
+	return l.block < l.resume.Block || (l.block == l.resume.Block && l.resume.Rows > 0)
+}
+
+// copyBlock streams one COPY block, committing in chunks as configured.
+func (l *loader) copyBlock(ctx context.Context, header string, br *bufio.Reader) error {
+	table := copyTable(header)
+	copySQL := strings.TrimSuffix(header, ";")
+	csv := strings.HasSuffix(copySQL, " WITH (FORMAT csv)")
+	bin := strings.HasSuffix(copySQL, " WITH (FORMAT binary)")
+	if bin {
+		// a binary stream is only valid with its header and trailer, so
+		// every chunk gets them
+		header := make([]byte, len(output.BinaryCopyHeader))
+		if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header, output.BinaryCopyHeader) {
+			return fmt.Errorf("reading COPY data for %s: invalid binary COPY header", table)
+		}
+	}
+	block := l.block
+	l.block++
+
+	var skip int64
+	if l.resume != nil {
+		switch {
+		case block < l.resume.Block:
+			skip = -1 // skip the whole block
+		case block == l.resume.Block:
+			skip = l.resume.Rows
+		}
+	}
+
+	var buf bytes.Buffer
+	var buffered, done int64
+	flush := func() error {
+		if buffered == 0 {
+			return nil
+		}
+		data := io.Reader(&buf)
+		if bin {
+			data = io.MultiReader(bytes.NewReader(output.BinaryCopyHeader), &buf, bytes.NewReader(output.BinaryCopyTrailer))
+		}
+		if _, err := l.tx.Conn().PgConn().CopyFrom(ctx, data, copySQL); err != nil {
+			return fmt.Errorf("copying into %s: %w", table, err)
+		}
+		buf.Reset()
+		buffered = 0
+		return nil
+	}
+
+	for {
+		var line string
+		var err error
+		switch {
+		case bin:
+			line, err = readBinaryTuple(br)
+		case csv:
+			line, err = readCSVRecord(br)
+		default:
+			line, err = readLine(br)
+		}
+		if err != nil {
+			return fmt.Errorf("reading COPY data for %s: %w", table, err)
+		}
+		if line == `\.` {
+			break
+		}
+		if skip < 0 {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			done++
+			continue
+		}
+
+		buf.WriteString(line)
+		if !bin {
+			buf.WriteByte('\n')
+		}
+		buffered++
+		done++
+		l.stats.Rows++
+
+		if l.opts.CommitEvery > 0 && buffered >= l.opts.CommitEvery {
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := l.checkpoint(ctx, &State{Block: block, Table: table, Rows: done}); err != nil {
+				return err
+			}
+		}
+	}
+	if skip < 0 {
+		return nil
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	l.stats.Tables++
+	if l.opts.Verbose {
+		fmt.Fprintf(os.Stderr, "  %s: %d rows\n", table, done)
+	}
+	if l.opts.PerTable {
+		return l.checkpoint(ctx, &State{Block: block + 1, Table: table})
+	}
+	return nil
+}
+
+// checkpoint commits the current transaction, records st, and begins a new one.
+func (l *loader) checkpoint(ctx context.Context, st *State) error {
+	if err := l.commit(ctx, st); err != nil {
+		return err
+	}
+	return l.begin(ctx)
+}
+
+func (l *loader) begin(ctx context.Context) error {
+	tx, err := l.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	l.tx = tx
+	return nil
+}
+
+func (l *loader) commit(ctx context.Context, st *State) error {
+	if err := l.tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	l.stats.Commits++
+	if st != nil && l.opts.StateFile != "" {
+		if err := writeState(l.opts.StateFile, st); err != nil {
+			return err
+		}
+		if l.opts.Verbose {
+			fmt.Fprintf(os.Stderr, "  committed %s up to row %d\n", st.Table, st.Rows)
+		}
+	}
+	return nil
+}
+
+// copyTable extracts the table name from a "COPY table (cols) FROM stdin;"
+// line. The name ends at the first space outside double quotes.
+func copyTable(header string) string {
+	rest := strings.TrimPrefix(header, "COPY ")
+	quoted := false
+	for i, r := range rest {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			return rest[:i]
+		}
+	}
+	return rest
+}
+
+// readLine reads a line without its LF or CRLF terminator.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readCSVRecord reads a CSV record without its terminator. Quoted values
+// may span lines; a record ends at a line break outside quotes.
+func readCSVRecord(br *bufio.Reader) (string, error) {
+	var record strings.Builder
+	quotes := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", err
+		}
+		record.WriteString(line)
+		quotes += strings.Count(line, `"`)
+		if quotes%2 == 0 || err != nil {
+			break
+		}
+	}
+	line := strings.TrimSuffix(record.String(), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readBinaryTuple reads a tuple of a binary COPY stream, or at its trailer
+// the terminator line following it, returning \.
+func readBinaryTuple(br *bufio.Reader) (string, error) {
+	var tuple bytes.Buffer
+	var n [4]byte
+	if _, err := io.ReadFull(br, n[:2]); err != nil {
+		return "", err
+	}
+	if bytes.Equal(n[:2], output.BinaryCopyTrailer) {
+		if line, err := readLine(br); err != nil || line != "" {
+			return "", fmt.Errorf("invalid binary COPY trailer")
+		}
+		return readLine(br)
+	}
+	tuple.Write(n[:2])
+	for fields := binary.BigEndian.Uint16(n[:2]); fields > 0; fields-- {
+		if _, err := io.ReadFull(br, n[:]); err != nil {
+			return "", err
+		}
+		tuple.Write(n[:])
+		size := int32(binary.BigEndian.Uint32(n[:]))
+		if size < 0 {
+			continue // NULL
+		}
+		if _, err := io.CopyN(&tuple, br, int64(size)); err != nil {
+			return "", err
+		}
+	}
+	return tuple.String(), nil
+}
+
+func readState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading load state: %w", err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parsing load state: %w", err)
+	}
+	return &st, nil
+}
+
+func writeState(path string, st *State) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing load state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
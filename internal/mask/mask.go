@@ -0,0 +1,118 @@
+// Package mask replaces column values with generated fake data.
+package mask
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Generator produces a fake value using r.
+type Generator func(r *rand.Rand) any
+
+var generators = map[string]Generator{
+	"email": fakeEmail,
+	"name":  fakeName,
+	"phone": fakePhone,
+	"lorem": fakeLorem,
+	"uuid":  fakeUUID,
+	"null":  func(*rand.Rand) any { return nil },
+}
+
+// Names returns the available generator names.
+func Names() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that a generator exists.
+func Validate(name string) error {
+	if _, ok := generators[name]; !ok {
+		return fmt.Errorf("unknown mask generator %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return nil
+}
+
+// Masker applies generators to values.
+type Masker struct {
+	rnd *rand.Rand
+	key []byte
+}
+
+// New creates a Masker. With an empty key values are random; otherwise each
+// generator is seeded by HMAC-SHA256(key, generator name + value), so the same
+// input always yields the same output, in every table and run.
+func New(key string) *Masker {
+	if key != "" {
+		return &Masker{key: []byte(key)}
+	}
+	return &Masker{rnd: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+}
+
+// Deterministic reports whether the Masker maps equal inputs to equal outputs.
+func (m *Masker) Deterministic() bool {
+	return m.key != nil
+}
+
+// Apply returns the masked replacement for v. NULL stays NULL.
+func (m *Masker) Apply(name string, v any) any {
+	if v == nil {
+		return nil
+	}
+	if m.key == nil {
+		return generators[name](m.rnd)
+	}
+	mac := hmac.New(sha256.New, m.key)
+	fmt.Fprintf(mac, "%s\x00%v", name, v)
+	sum := mac.Sum(nil)
+	r := rand.New(rand.NewPCG(binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])))
+	return generators[name](r)
+}
+
+func fakeEmail(r *rand.Rand) any {
+	return fmt.Sprintf("%s.%s%d@example.com",
+		strings.ToLower(pick(r, firstNames)), strings.ToLower(pick(r, lastNames)), r.IntN(10000))
+}
+
+func fakeName(r *rand.Rand) any {
+	return pick(r, firstNames) + " " + pick(r, lastNames)
+}
+
+func fakePhone(r *rand.Rand) any {
+	return fmt.Sprintf("555-%03d-%04d", r.IntN(1000), r.IntN(10000))
+}
+
+func fakeLorem(r *rand.Rand) any {
+	n := 5 + r.IntN(8)
+	words := make([]string, n)
+	for i := range words {
+		words[i] = pick(r, loremWords)
+	}
+	words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	return strings.Join(words, " ") + "."
+}
+
+func fakeUUID(r *rand.Rand) any {
+	var b [16]byte
+	for i := 0; i < 16; i += 8 {
+		v := r.Uint64()
+		for j := range 8 {
+			b[i+j] = byte(v >> (8 * j))
+		}
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func pick(r *rand.Rand, list []string) string {
+	return list[r.IntN(len(list))]
+}
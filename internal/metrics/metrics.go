@@ -0,0 +1,226 @@
+// Package metrics exposes extraction metrics in the Prometheus text format,
+// on a /metrics endpoint or pushed to a Pushgateway, so scheduled extractions
+// can be monitored and alerted on.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/hurou927/db-sub-data/internal/extract"
+)
+
+// durationBuckets are the upper bounds (seconds) of the query duration histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Metrics collects the metrics of one run. It is a pgx tracer observing the
+// duration and errors of every query; the per-table metrics are set by
+// Finish when the extraction ends.
+type Metrics struct {
+	mu      sync.Mutex
+	queries int64
+	errors  int64
+	// buckets counts the queries per durationBuckets bound (not cumulative)
+	buckets []int64
+	seconds float64
+
+	finished bool
+	success  bool
+	end      time.Time
+	report   *extract.Report
+}
+
+// New returns empty metrics.
+func New() *Metrics {
+	return &Metrics{buckets: make([]int64, len(durationBuckets)+1)}
+}
+
+type startKey struct{}
+
+func (m *Metrics) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func (m *Metrics) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	m.observe(ctx, data.Err)
+}
+
+func (m *Metrics) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromStartData) context.Context {
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func (m *Metrics) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	m.observe(ctx, data.Err)
+}
+
+func (m *Metrics) observe(ctx context.Context, err error) {
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	d := time.Since(start).Seconds()
+	i := sort.SearchFloat64s(durationBuckets, d)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries++
+	if err != nil {
+		m.errors++
+	}
+	m.buckets[i]++
+	m.seconds += d
+}
+
+// Finish records the outcome of the extraction. report is nil if the
+// extraction did not start.
+func (m *Metrics) Finish(report *extract.Report, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = true
+	m.success = err == nil
+	m.end = time.Now()
+	m.report = report
+}
+
+// Succeeded reports whether Finish recorded a successful extraction.
+func (m *Metrics) Succeeded() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.success
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	header(&b, "db_sub_data_queries_total", "counter", "Queries executed.")
+	fmt.Fprintf(&b, "db_sub_data_queries_total %d\n", m.queries)
+	header(&b, "db_sub_data_query_errors_total", "counter", "Queries that failed.")
+	fmt.Fprintf(&b, "db_sub_data_query_errors_total %d\n", m.errors)
+	header(&b, "db_sub_data_query_duration_seconds", "histogram", "Duration of the queries.")
+	var cumulative int64
+	for i, le := range durationBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(&b, "db_sub_data_query_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&b, "db_sub_data_query_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.queries)
+	fmt.Fprintf(&b, "db_sub_data_query_duration_seconds_sum %g\n", m.seconds)
+	fmt.Fprintf(&b, "db_sub_data_query_duration_seconds_count %d\n", m.queries)
+
+	if m.finished {
+		header(&b, "db_sub_data_extract_success", "gauge", "Whether the extraction succeeded (1) or failed (0).")
+		fmt.Fprintf(&b, "db_sub_data_extract_success %d\n", boolValue(m.success))
+		if m.success {
+			header(&b, "db_sub_data_extract_last_success_timestamp_seconds", "gauge", "Time the last successful extraction finished.")
+			fmt.Fprintf(&b, "db_sub_data_extract_last_success_timestamp_seconds %d\n", m.end.Unix())
+		}
+	}
+	if r := m.report; r != nil {
+		header(&b, "db_sub_data_extract_duration_seconds", "gauge", "Duration of the extraction.")
+		fmt.Fprintf(&b, "db_sub_data_extract_duration_seconds %g\n", float64(r.DurationMS)/1000)
+		header(&b, "db_sub_data_extract_rows", "gauge", "Rows extracted in total.")
+		fmt.Fprintf(&b, "db_sub_data_extract_rows %d\n", r.Rows)
+		header(&b, "db_sub_data_extract_bytes", "gauge", "Bytes of output written in total.")
+		fmt.Fprintf(&b, "db_sub_data_extract_bytes %d\n", r.Bytes)
+		header(&b, "db_sub_data_extract_warnings", "gauge", "Warnings reported by the extraction.")
+		fmt.Fprintf(&b, "db_sub_data_extract_warnings %d\n", len(r.Warnings))
+
+		header(&b, "db_sub_data_table_rows", "gauge", "Rows extracted per table.")
+		for _, t := range r.Tables {
+			fmt.Fprintf(&b, "db_sub_data_table_rows{table=\"%s\"} %d\n", escape(t.Table), t.Rows)
+		}
+		header(&b, "db_sub_data_table_bytes", "gauge", "Bytes of output written per table.")
+		for _, t := range r.Tables {
+			fmt.Fprintf(&b, "db_sub_data_table_bytes{table=\"%s\"} %d\n", escape(t.Table), t.Bytes)
+		}
+		header(&b, "db_sub_data_table_queries", "gauge", "Queries run per table.")
+		for _, t := range r.Tables {
+			fmt.Fprintf(&b, "db_sub_data_table_queries{table=\"%s\"} %d\n", escape(t.Table), t.Queries)
+		}
+		header(&b, "db_sub_data_table_duration_seconds", "gauge", "Time spent querying per table.")
+		for _, t := range r.Tables {
+			fmt.Fprintf(&b, "db_sub_data_table_duration_seconds{table=\"%s\"} %g\n", escape(t.Table), float64(t.DurationMS)/1000)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteText(w)
+}
+
+// Serve serves the metrics on http://addr/metrics until the returned
+// server is closed.
+func (m *Metrics) Serve(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(l)
+	return srv, nil
+}
+
+// Push sends the metrics to the Pushgateway at gateway under the job name.
+// A successful run replaces the job's metrics (PUT); a failed run only
+// replaces the metrics it has (POST), keeping the last success timestamp.
+func (m *Metrics) Push(ctx context.Context, gateway, job string) error {
+	var body bytes.Buffer
+	if err := m.WriteText(&body); err != nil {
+		return err
+	}
+	method := http.MethodPost
+	if m.Succeeded() {
+		method = http.MethodPut
+	}
+	u := strings.TrimRight(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return fmt.Errorf("pushing metrics: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushing metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushing metrics: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func header(b *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// escape escapes a label value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,287 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcsChunkSize is the size of the chunks of a GCS resumable upload (a
+// multiple of 256KiB).
+const gcsChunkSize = 16 << 20
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsWriter streams a GCS resumable upload.
+type gcsWriter struct {
+	chunker
+	ctx     context.Context
+	token   *gcsToken
+	session string
+	offset  int64
+}
+
+func newGCSWriter(ctx context.Context, bucket, key string) (*gcsWriter, error) {
+	w := &gcsWriter{ctx: ctx, token: &gcsToken{}}
+	w.chunker = chunker{size: gcsChunkSize, upload: w.uploadChunk}
+
+	start := "https://storage.googleapis.com/upload/storage/v1/b/" + url.PathEscape(bucket) +
+		"/o?uploadType=resumable&name=" + url.QueryEscape(key)
+	resp, err := send(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, start, nil)
+		if err != nil {
+			return nil, err
+		}
+		return req, w.token.authorize(req)
+	})
+	if err == nil && resp.StatusCode/100 != 2 {
+		err = responseError(resp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("starting upload to gs://%s/%s: %w", bucket, key, err)
+	}
+	resp.Body.Close()
+	w.session = resp.Header.Get("Location")
+	return w, nil
+}
+
+func (w *gcsWriter) uploadChunk(chunk []byte, last bool) error {
+	// Content-Range is "bytes first-last/total", total "*" until the end
+	total := "*"
+	if last {
+		total = fmt.Sprint(w.offset + int64(len(chunk)))
+	}
+	contentRange := fmt.Sprintf("bytes %d-%d/%s", w.offset, w.offset+int64(len(chunk))-1, total)
+	if len(chunk) == 0 {
+		contentRange = "bytes */" + total
+	}
+	resp, err := send(w.ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(w.ctx, http.MethodPut, w.session, bytes.NewReader(chunk))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Range", contentRange)
+		return req, w.token.authorize(req)
+	})
+	if err != nil {
+		return fmt.Errorf("uploading bytes %d-: %w", w.offset, err)
+	}
+	// 308 Resume Incomplete acknowledges a chunk before the last
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusPermanentRedirect {
+		return fmt.Errorf("uploading bytes %d-: %w", w.offset, responseError(resp))
+	}
+	resp.Body.Close()
+	w.offset += int64(len(chunk))
+	return nil
+}
+
+// Close uploads the last chunk, which completes the upload.
+func (w *gcsWriter) Close() error {
+	if err := w.flush(); err != nil {
+		w.Abort()
+		return err
+	}
+	return nil
+}
+
+// Abort cancels the upload session.
+func (w *gcsWriter) Abort() error {
+	// The extraction's context may be cancelled by now
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, w.session, nil)
+	if err != nil {
+		return err
+	}
+	if err := w.token.authorize(req); err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("aborting upload: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// gcsToken is an OAuth access token for GCS, from (in order)
+// $GOOGLE_OAUTH_ACCESS_TOKEN, the service account key or gcloud user
+// credentials of $GOOGLE_APPLICATION_CREDENTIALS or
+// ~/.config/gcloud/application_default_credentials.json, or the metadata
+// server of GCE, GKE and Cloud Run. It is refreshed before it expires.
+type gcsToken struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}
+
+func (t *gcsToken) authorize(req *http.Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.value == "" || time.Until(t.expires) < time.Minute {
+		value, ttl, err := fetchGCSToken(req.Context())
+		if err != nil {
+			return fmt.Errorf("getting GCS credentials: %w", err)
+		}
+		t.value, t.expires = value, time.Now().Add(ttl)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.value)
+	return nil
+}
+
+// tokenResponse is the response of an OAuth token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func fetchGCSToken(ctx context.Context) (string, time.Duration, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, time.Hour, nil
+	}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			adc := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(adc); err == nil {
+				path = adc
+			}
+		}
+	}
+	var r tokenResponse
+	var err error
+	if path != "" {
+		r, err = credentialsToken(ctx, path)
+	} else {
+		r, err = metadataToken(ctx)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return r.AccessToken, time.Duration(r.ExpiresIn) * time.Second, nil
+}
+
+// credentialsToken exchanges the credentials of a key file for a token.
+func credentialsToken(ctx context.Context, path string) (tokenResponse, error) {
+	var r tokenResponse
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return r, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	form := url.Values{}
+	tokenURI := "https://oauth2.googleapis.com/token"
+	switch creds.Type {
+	case "service_account":
+		if creds.TokenURI != "" {
+			tokenURI = creds.TokenURI
+		}
+		assertion, err := signJWT(creds.ClientEmail, tokenURI, creds.PrivateKey)
+		if err != nil {
+			return r, fmt.Errorf("signing with %s: %w", path, err)
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return r, fmt.Errorf("%s: unsupported credentials type %q (supported: service_account, authorized_user)", path, creds.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return r, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r, doToken(req, &r)
+}
+
+// metadataToken gets the token of the instance's service account.
+func metadataToken(ctx context.Context) (tokenResponse, error) {
+	var r tokenResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return r, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	if err := doToken(req, &r); err != nil {
+		return r, fmt.Errorf("no credentials (set GOOGLE_APPLICATION_CREDENTIALS) and no metadata server: %w", err)
+	}
+	return r, nil
+}
+
+func doToken(req *http.Request, r *tokenResponse) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(r)
+}
+
+// signJWT builds the RS256-signed assertion of a service account.
+func signJWT(email, audience, privateKey string) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not RSA")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": gcsScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,131 @@
+// Package objstore streams output to object storage (s3://bucket/key and
+// gs://bucket/key) in parts, so large extracts need no local staging.
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Writer uploads an object as it is written. Close completes the upload;
+// Abort discards it, so a failed extraction leaves no object behind.
+type Writer interface {
+	io.WriteCloser
+	Abort() error
+}
+
+var client = &http.Client{Timeout: 10 * time.Minute}
+
+// maxAttempts is the number of tries of a part upload.
+const maxAttempts = 3
+
+// IsURL reports whether path is an object storage URL.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// Create starts uploading the object at rawURL.
+func Create(ctx context.Context, rawURL string) (Writer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid object URL %q (expected %s://bucket/key)", rawURL, u.Scheme)
+	}
+	switch u.Scheme {
+	case "s3":
+		return newS3Writer(ctx, bucket, key)
+	case "gs":
+		return newGCSWriter(ctx, bucket, key)
+	}
+	return nil, fmt.Errorf("unsupported object URL scheme %q (supported: s3, gs)", u.Scheme)
+}
+
+// escapePath escapes the segments of an object key for a URL path.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// chunker buffers the written bytes into chunks of size and uploads each
+// full chunk with upload.
+type chunker struct {
+	size   int
+	buf    []byte
+	upload func(chunk []byte, last bool) error
+	err    error
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := min(c.size-len(c.buf), len(p))
+		c.buf = append(c.buf, p[:m]...)
+		p = p[m:]
+		if len(c.buf) == c.size {
+			if c.err = c.upload(c.buf, false); c.err != nil {
+				return 0, c.err
+			}
+			c.buf = c.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// flush uploads the remaining bytes as the last chunk.
+func (c *chunker) flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	c.err = c.upload(c.buf, true)
+	return c.err
+}
+
+// send sends the request built by newReq, retrying server errors and
+// network failures, and returns the response for the caller to close.
+func send(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var req *http.Request
+		if req, err = newReq(); err != nil {
+			return nil, err
+		}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err == nil {
+			err = responseError(resp)
+		}
+		if attempt == maxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// responseError returns the status and the start of the body of a failed
+// response, and closes it.
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
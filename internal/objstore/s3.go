@@ -0,0 +1,162 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/awsauth"
+)
+
+// s3PartSize is the size of the first 1000 parts of an S3 upload; later
+// parts grow by this much every 1000 parts, so the 10000 parts S3 allows
+// hold about 880GB.
+const s3PartSize = 16 << 20
+
+// s3Writer streams an S3 multipart upload, with the credentials and region
+// of the environment. $AWS_ENDPOINT_URL_S3 (or $AWS_ENDPOINT_URL) selects an
+// S3-compatible endpoint, addressed path-style.
+type s3Writer struct {
+	chunker
+	ctx      context.Context
+	creds    awsauth.Credentials
+	region   string
+	url      string
+	uploadID string
+	etags    []string
+}
+
+func newS3Writer(ctx context.Context, bucket, key string) (*s3Writer, error) {
+	creds, err := awsauth.EnvCredentials()
+	if err != nil {
+		return nil, err
+	}
+	region := awsauth.EnvRegion()
+	if region == "" {
+		region = "us-east-1"
+	}
+	objectURL := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escapePath(key)
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		objectURL = strings.TrimRight(endpoint, "/") + "/" + bucket + "/" + escapePath(key)
+	}
+
+	w := &s3Writer{ctx: ctx, creds: creds, region: region, url: objectURL}
+	w.chunker = chunker{size: s3PartSize, upload: w.uploadPart}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := w.call(http.MethodPost, url.Values{"uploads": {""}}, nil, &result); err != nil {
+		return nil, fmt.Errorf("starting upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	w.uploadID = result.UploadID
+	return w, nil
+}
+
+func (w *s3Writer) uploadPart(part []byte, last bool) error {
+	if len(part) == 0 && len(w.etags) > 0 {
+		return nil
+	}
+	n := len(w.etags) + 1
+	resp, err := w.send(http.MethodPut, url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {w.uploadID}}, part)
+	if err != nil {
+		return fmt.Errorf("uploading part %d: %w", n, err)
+	}
+	resp.Body.Close()
+	w.etags = append(w.etags, resp.Header.Get("ETag"))
+	w.size = s3PartSize * (1 + len(w.etags)/1000)
+	return nil
+}
+
+// Close uploads the last part and completes the upload.
+func (w *s3Writer) Close() error {
+	if err := w.flush(); err != nil {
+		w.Abort()
+		return err
+	}
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for i, etag := range w.etags {
+		complete.Parts = append(complete.Parts, part{PartNumber: i + 1, ETag: etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	// The completion may fail after a 200 status, with an Error body
+	var result struct {
+		XMLName xml.Name
+		Message string `xml:"Message"`
+	}
+	if err := w.call(http.MethodPost, url.Values{"uploadId": {w.uploadID}}, body, &result); err != nil {
+		w.Abort()
+		return fmt.Errorf("completing upload: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		w.Abort()
+		return fmt.Errorf("completing upload: %s", result.Message)
+	}
+	return nil
+}
+
+// Abort discards the uploaded parts.
+func (w *s3Writer) Abort() error {
+	// The extraction's context may be cancelled by now
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	w.ctx = ctx
+	resp, err := w.send(http.MethodDelete, url.Values{"uploadId": {w.uploadID}}, nil)
+	if err != nil {
+		return fmt.Errorf("aborting upload: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// call sends a request and decodes its XML response into v.
+func (w *s3Writer) call(method string, query url.Values, body []byte, v any) error {
+	resp, err := w.send(method, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// send sends a signed request to the object.
+func (w *s3Writer) send(method string, query url.Values, body []byte) (*http.Response, error) {
+	hash := awsauth.PayloadHash(body)
+	resp, err := send(w.ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(w.ctx, method, w.url+"?"+query.Encode(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Amz-Content-Sha256", hash)
+		awsauth.Sign(req, hash, w.region, "s3", w.creds, time.Now())
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Binary is a value in PostgreSQL's binary wire format, as fetched for
+// binary COPY output.
+type Binary []byte
+
+// Text is a value in PostgreSQL's text representation as the server sent
+// it, written with only the escaping of the output format.
+type Text string
+
+// BinaryCopyHeader is the header of a binary COPY stream: the signature,
+// the flags field and the length of the (empty) header extension.
+var BinaryCopyHeader = []byte("PGCOPY\n\xff\r\n\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+// BinaryCopyTrailer ends the tuples of a binary COPY stream.
+var BinaryCopyTrailer = []byte{0xff, 0xff}
+
+// AppendBinaryTuple appends a row to a binary COPY stream: the field count,
+// then each field's length (-1 for NULL) and bytes. Every non-NULL value
+// must be Binary.
+func AppendBinaryTuple(buf []byte, row []any) ([]byte, error) {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(row)))
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+			buf = binary.BigEndian.AppendUint32(buf, math.MaxUint32) // -1
+		case Binary:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		default:
+			return nil, fmt.Errorf("column %d: binary COPY needs a binary value, got %T", i+1, v)
+		}
+	}
+	return buf, nil
+}
+
+// BinaryTupleSize returns the number of bytes a row occupies in a binary
+// COPY stream.
+func BinaryTupleSize(row []any) int64 {
+	n := int64(2)
+	for _, v := range row {
+		n += 4
+		if b, ok := v.(Binary); ok {
+			n += int64(len(b))
+		}
+	}
+	return n
+}
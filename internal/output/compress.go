@@ -0,0 +1,84 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Output compressions.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressionFor infers the compression of an output path from its
+// extension (.gz or .zst), or returns "" if it has none.
+func CompressionFor(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return CompressGzip
+	case strings.HasSuffix(path, ".zst"):
+		return CompressZstd
+	}
+	return ""
+}
+
+// ValidateCompression checks a --compress value.
+func ValidateCompression(method string) error {
+	switch method {
+	case "", CompressNone, CompressGzip, CompressZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q (supported: %s, %s, %s)", method, CompressGzip, CompressZstd, CompressNone)
+}
+
+// Compress returns a writer compressing to w with method. Close flushes the
+// compressed stream but does not close w.
+func Compress(w io.Writer, method string) (io.WriteCloser, error) {
+	switch method {
+	case "", CompressNone:
+		return nopCloser{w}, nil
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, ValidateCompression(method)
+}
+
+// Decompress returns r, decompressed if it starts with a gzip or zstd header.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip input: %w", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading zstd input: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
@@ -8,68 +8,405 @@ import (
 	"github.com/hurou927/db-sub-data/internal/schema"
 )
 
+// Options controls the output representation.
+type Options struct {
+	// Newline is the line terminator style: "lf" (default) or "crlf".
+	Newline string
+	// Encoding is the PostgreSQL client_encoding to write (default "UTF8").
+	// Output is transcoded and a matching SET client_encoding is emitted.
+	Encoding string
+	// Format is the statement style: "copy" (default) or "upsert", or
+	// "csv" or "jsonl" for the per-table files of a DirWriter.
+	Format string
+	// CopyFormat is the format of the COPY blocks: "text" (default), "csv"
+	// or "binary", whose rows hold Binary values.
+	CopyFormat string
+	// UTC writes timestamps in UTC (the extractor converts them) and sets
+	// the session time zone to UTC in the header, so the output does not
+	// depend on the time zone of the extracting host or of the target.
+	UTC bool
+	// OverridingSystemValue writes the INSERTs of tables with GENERATED
+	// ALWAYS identity columns with OVERRIDING SYSTEM VALUE, so the rows
+	// keep their source keys.
+	OverridingSystemValue bool
+	// Truncate empties the tables in Header.Tables before loading, so the
+	// output can refresh an existing database.
+	Truncate bool
+	// DisableTriggers wraps the rows of each table in ALTER TABLE ... DISABLE
+	// TRIGGER USER and ENABLE TRIGGER USER instead of setting
+	// session_replication_role, which needs only ownership of the tables.
+	// The FK checks are not disabled, so unless they are deferred the
+	// extractor refuses to write rows before their parents (cycles,
+	// break_cycle: order, parent blocks of the closure).
+	DisableTriggers bool
+}
+
+// Output formats.
+const (
+	FormatCopy   = "copy"
+	FormatUpsert = "upsert"
+	FormatCSV    = "csv"
+	FormatJSONL  = "jsonl"
+)
+
+// COPY block formats.
+const (
+	CopyText   = "text"
+	CopyCSV    = "csv"
+	CopyBinary = "binary"
+)
+
+// Validate checks the options without creating a writer.
+func (o Options) Validate() error {
+	_, err := New(io.Discard, o)
+	return err
+}
+
+// New creates the TableWriter for opts.Format.
+func New(w io.Writer, opts Options) (TableWriter, error) {
+	switch opts.Format {
+	case "", FormatCopy:
+		return NewWriter(w, opts)
+	case FormatUpsert:
+		return NewInsertWriter(w, opts)
+	case FormatCSV:
+		return NewCSVWriter(w, opts)
+	case FormatJSONL:
+		return NewJSONLWriter(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown output format %q (supported: %s, %s, %s, %s)", opts.Format, FormatCopy, FormatUpsert, FormatCSV, FormatJSONL)
+	}
+}
+
+// TableWriter receives extracted rows as they are fetched. Rows are written
+// between BeginTable and EndTable; a table may be written in several blocks.
+type TableWriter interface {
+	WriteHeader(h Header) error
+	BeginTable(table *schema.Table) error
+	WriteRow(row []any) error
+	EndTable() error
+	WriteFooter(f Footer) error
+}
+
 // Writer writes COPY-format SQL output.
 type Writer struct {
-	w io.Writer
+	w        io.Writer
+	encoding string
+	closer   io.Closer // flushes the transcoder, if any
+	truncate bool
+	utc      bool
+	// deferred is set by a header with DeferConstraints
+	deferred        bool
+	disableTriggers bool
+
+	// copyFormat is the format of the COPY blocks
+	copyFormat string
+	// buf holds the binary tuple being written
+	buf []byte
+
+	// table is the table of the current block; the COPY line is written
+	// with the first row so empty blocks produce no output.
+	table   *schema.Table
+	started bool
 }
 
 // NewWriter creates a new COPY output writer.
-func NewWriter(w io.Writer) *Writer {
-	return &Writer{w: w}
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	switch opts.Newline {
+	case "", "lf":
+	case "crlf":
+		w = &crlfWriter{w: w}
+	default:
+		return nil, fmt.Errorf("unknown newline style %q (supported: lf, crlf)", opts.Newline)
+	}
+
+	name := opts.Encoding
+	if name == "" {
+		name = DefaultEncoding
+	}
+	name, enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.CopyFormat {
+	case "", CopyText:
+	case CopyCSV:
+		// crlfWriter would also rewrite the line breaks inside CSV values
+		if opts.Newline == "crlf" {
+			return nil, fmt.Errorf("COPY format %s cannot be written with crlf newlines", CopyCSV)
+		}
+	case CopyBinary:
+		// binary values pass through neither the transcoder nor crlfWriter
+		if opts.Newline == "crlf" || enc != nil {
+			return nil, fmt.Errorf("COPY format %s is written in UTF8 with lf newlines only", CopyBinary)
+		}
+	default:
+		return nil, fmt.Errorf("unknown COPY format %q (supported: %s, %s, %s)", opts.CopyFormat, CopyText, CopyCSV, CopyBinary)
+	}
+
+	cw := &Writer{w: w, encoding: name, truncate: opts.Truncate, utc: opts.UTC, disableTriggers: opts.DisableTriggers, copyFormat: opts.CopyFormat}
+	if enc != nil {
+		tw := enc.NewEncoder().Writer(w)
+		cw.w = tw
+		if c, ok := tw.(io.Closer); ok {
+			cw.closer = c
+		}
+	}
+	return cw, nil
 }
 
-// WriteHeader writes the BEGIN and session_replication_role setting.
-func (cw *Writer) WriteHeader() error {
+// Header describes the extraction written as comments at the top of the output.
+type Header struct {
+	// Tables are the tables in the extraction scope (schema.table).
+	Tables []string
+	// SchemaFingerprint is the source schema fingerprint of Tables.
+	SchemaFingerprint string
+	// Types holds statements creating the user-defined types the columns
+	// use, written before DDL.
+	Types []string
+	// DDL holds statements creating the tables, written before the data.
+	DDL []string
+	// DeferConstraints defers the FK checks to COMMIT with SET CONSTRAINTS
+	// ALL DEFERRED instead of disabling them with session_replication_role,
+	// which requires superuser. Set when all FKs of Tables are deferrable.
+	DeferConstraints bool
+}
+
+// Footer describes statements written after the data.
+type Footer struct {
+	// Statements are run after the data, before the sequences are set.
+	Statements []string
+	// Sequences are sequence values to set, in output order.
+	Sequences []SequenceValue
+}
+
+// SequenceValue is the value to set a sequence to after loading.
+type SequenceValue struct {
+	Name  string // quoted, schema-qualified sequence name
+	Value int64
+}
+
+// WriteHeader writes the schema fingerprint comments followed by BEGIN,
+// client_encoding, time zone (with UTC) and session_replication_role (or,
+// with DeferConstraints, SET CONSTRAINTS; with DisableTriggers, neither
+// unless deferred) settings, the type and DDL statements, and with Truncate
+// a single TRUNCATE ... CASCADE of all tables in scope.
+// Tables are truncated up front because a table's rows may span several COPY
+// blocks.
+func (cw *Writer) WriteHeader(h Header) error {
+	if h.SchemaFingerprint != "" {
+		ddl := ""
+		if len(h.DDL) > 0 {
+			ddl = "-- schema-ddl: included\n"
+		}
+		if h.DeferConstraints {
+			ddl += "-- constraints: deferred\n"
+		}
+		if cw.disableTriggers {
+			ddl += "-- triggers: disabled\n"
+		}
+		_, err := fmt.Fprintf(cw.w, "-- schema-tables: %s\n%s-- schema-fingerprint: %s\n\n",
+			strings.Join(h.Tables, ","), ddl, h.SchemaFingerprint)
+		if err != nil {
+			return err
+		}
+	}
 	_, err := fmt.Fprintln(cw.w, "BEGIN;")
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintln(cw.w, "SET session_replication_role = 'replica';")
+	_, err = fmt.Fprintf(cw.w, "SET client_encoding = '%s';\n", cw.encoding)
+	if err != nil {
+		return err
+	}
+	if cw.utc {
+		if _, err := fmt.Fprintln(cw.w, "SET TIME ZONE 'UTC';"); err != nil {
+			return err
+		}
+	}
+	cw.deferred = h.DeferConstraints
+	switch {
+	case cw.deferred:
+		_, err = fmt.Fprintln(cw.w, "SET CONSTRAINTS ALL DEFERRED;")
+	case !cw.disableTriggers:
+		_, err = fmt.Fprintln(cw.w, "SET session_replication_role = 'replica';")
+	}
 	if err != nil {
 		return err
 	}
+	stmts := append(h.Types[:len(h.Types):len(h.Types)], h.DDL...)
+	for _, stmt := range stmts {
+		if _, err := fmt.Fprintf(cw.w, "\n%s\n", stmt); err != nil {
+			return err
+		}
+	}
+	if len(stmts) > 0 {
+		if _, err := fmt.Fprintln(cw.w); err != nil {
+			return err
+		}
+	}
+	if cw.truncate && len(h.Tables) > 0 {
+		quoted := make([]string, len(h.Tables))
+		for i, name := range h.Tables {
+			quoted[i] = schema.QuoteQualified(name)
+		}
+		_, err = fmt.Fprintf(cw.w, "TRUNCATE TABLE %s CASCADE;\n", strings.Join(quoted, ", "))
+		if err != nil {
+			return err
+		}
+	}
 	_, err = fmt.Fprintln(cw.w)
 	return err
 }
 
-// WriteFooter writes the session_replication_role reset and COMMIT.
-func (cw *Writer) WriteFooter() error {
-	_, err := fmt.Fprintln(cw.w, "SET session_replication_role = 'origin';")
+// WriteFooter writes the statements, the sequence updates, the
+// session_replication_role reset (unless the constraints were deferred or
+// the triggers disabled per table) and COMMIT.
+func (cw *Writer) WriteFooter(f Footer) error {
+	for _, stmt := range f.Statements {
+		if _, err := fmt.Fprintln(cw.w, stmt); err != nil {
+			return err
+		}
+	}
+	if len(f.Statements) > 0 {
+		if _, err := fmt.Fprintln(cw.w); err != nil {
+			return err
+		}
+	}
+	for _, seq := range f.Sequences {
+		_, err := fmt.Fprintf(cw.w, "SELECT setval(%s, %d, true);\n", SQLLiteral(seq.Name), seq.Value)
+		if err != nil {
+			return err
+		}
+	}
+	if len(f.Sequences) > 0 {
+		if _, err := fmt.Fprintln(cw.w); err != nil {
+			return err
+		}
+	}
+	if !cw.deferred && !cw.disableTriggers {
+		if _, err := fmt.Fprintln(cw.w, "SET session_replication_role = 'origin';"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(cw.w, "COMMIT;")
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintln(cw.w, "COMMIT;")
-	return err
+	if cw.closer != nil {
+		return cw.closer.Close()
+	}
+	return nil
 }
 
-// WriteTableData writes a COPY block for a single table.
-func (cw *Writer) WriteTableData(table *schema.Table, rows [][]any) error {
-	if len(rows) == 0 {
-		return nil
+// flush writes out the output buffered by the transcoder, if any. The
+// writer must not be used afterwards.
+func (cw *Writer) flush() error {
+	if cw.closer != nil {
+		return cw.closer.Close()
 	}
+	return nil
+}
 
-	colNames := table.ColumnNames()
-	_, err := fmt.Fprintf(cw.w, "COPY %s (%s) FROM stdin;\n",
-		table.FullName(), strings.Join(colNames, ", "))
-	if err != nil {
-		return err
-	}
+// BeginTable starts a COPY block for a table.
+func (cw *Writer) BeginTable(table *schema.Table) error {
+	cw.table = table
+	cw.started = false
+	return nil
+}
 
-	for _, row := range rows {
-		vals := make([]string, len(row))
-		for i, v := range row {
-			vals[i] = EscapeCopyValue(v)
+// WriteRow writes a row of the current block.
+func (cw *Writer) WriteRow(row []any) error {
+	if !cw.started {
+		if err := cw.toggleTriggers("DISABLE"); err != nil {
+			return err
 		}
-		_, err := fmt.Fprintln(cw.w, strings.Join(vals, "\t"))
+		_, err := fmt.Fprintf(cw.w, "COPY %s (%s) FROM stdin%s;\n",
+			cw.table.QuotedName(), strings.Join(cw.table.QuotedColumnNames(), ", "), copyWith(cw.copyFormat))
 		if err != nil {
 			return err
 		}
+		if cw.copyFormat == CopyBinary {
+			if _, err := cw.w.Write(BinaryCopyHeader); err != nil {
+				return err
+			}
+		}
+		cw.started = true
 	}
+	switch cw.copyFormat {
+	case CopyCSV:
+		_, err := fmt.Fprintln(cw.w, FormatCSVRow(row))
+		return err
+	case CopyBinary:
+		var err error
+		if cw.buf, err = AppendBinaryTuple(cw.buf[:0], row); err != nil {
+			return err
+		}
+		_, err = cw.w.Write(cw.buf)
+		return err
+	}
+	_, err := fmt.Fprintln(cw.w, FormatRow(row))
+	return err
+}
 
-	_, err = fmt.Fprintln(cw.w, `\.`)
+// EndTable terminates the current COPY block, if any row was written.
+func (cw *Writer) EndTable() error {
+	if !cw.started {
+		return nil
+	}
+	cw.started = false
+	if cw.copyFormat == CopyBinary {
+		// the terminator line follows the trailer, for load to find
+		if _, err := cw.w.Write(append(BinaryCopyTrailer, '\n')); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(cw.w, `\.`)
 	if err != nil {
 		return err
 	}
+	if err := cw.toggleTriggers("ENABLE"); err != nil {
+		return err
+	}
 	_, err = fmt.Fprintln(cw.w)
 	return err
 }
+
+// toggleTriggers writes the ALTER TABLE disabling or enabling (action) the
+// user triggers of the current table, with DisableTriggers.
+func (cw *Writer) toggleTriggers(action string) error {
+	if !cw.disableTriggers {
+		return nil
+	}
+	_, err := fmt.Fprint(cw.w, triggersStatement(cw.table, action))
+	return err
+}
+
+// triggersStatement returns the ALTER TABLE line disabling or enabling
+// (action) the user triggers of a table.
+func triggersStatement(table *schema.Table, action string) string {
+	return fmt.Sprintf("ALTER TABLE %s %s TRIGGER USER;\n", table.QuotedName(), action)
+}
+
+// copyWith returns the options clause of the COPY line of a block.
+func copyWith(format string) string {
+	if format == CopyCSV || format == CopyBinary {
+		return " WITH (FORMAT " + format + ")"
+	}
+	return ""
+}
+
+// FormatRow renders a row as a tab-separated COPY text line (without newline).
+func FormatRow(row []any) string {
+	vals := make([]string, len(row))
+	for i, v := range row {
+		vals[i] = EscapeCopyValue(v)
+	}
+	return strings.Join(vals, "\t")
+}
+
+// RowSize returns the number of bytes a row occupies in COPY text output.
+func RowSize(row []any) int64 {
+	return int64(len(FormatRow(row))) + 1
+}
@@ -0,0 +1,120 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// CSVWriter writes the rows of a table as CSV, as COPY ... TO ... WITH
+// (FORMAT csv, HEADER true) would: a line of column names, then one line
+// per row with fields quoted only when needed. NULL is an empty unquoted
+// field and the empty string a quoted one (""), so the two stay distinct.
+// It holds one table; DirWriter writes a CSV file per table.
+type CSVWriter struct {
+	w       io.Writer
+	closer  io.Closer // flushes the transcoder, if any
+	newline string
+	// header writes the column names before the first row
+	header bool
+	table  *schema.Table
+}
+
+// NewCSVWriter creates a CSV writer. Newline terminates the records; line
+// breaks inside quoted values are kept as they are.
+func NewCSVWriter(w io.Writer, opts Options) (*CSVWriter, error) {
+	newline := "\n"
+	switch opts.Newline {
+	case "", "lf":
+	case "crlf":
+		newline = "\r\n"
+	default:
+		return nil, fmt.Errorf("unknown newline style %q (supported: lf, crlf)", opts.Newline)
+	}
+	name := opts.Encoding
+	if name == "" {
+		name = DefaultEncoding
+	}
+	_, enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cw := &CSVWriter{w: w, newline: newline, header: true}
+	if enc != nil {
+		tw := enc.NewEncoder().Writer(w)
+		cw.w = tw
+		if c, ok := tw.(io.Closer); ok {
+			cw.closer = c
+		}
+	}
+	return cw, nil
+}
+
+// WriteHeader implements TableWriter; CSV has no header statements.
+func (cw *CSVWriter) WriteHeader(h Header) error {
+	return nil
+}
+
+// BeginTable implements TableWriter.
+func (cw *CSVWriter) BeginTable(table *schema.Table) error {
+	cw.table = table
+	return nil
+}
+
+// WriteRow writes a record, preceded by the column names for the first.
+func (cw *CSVWriter) WriteRow(row []any) error {
+	if cw.header {
+		names := cw.table.ColumnNames()
+		fields := make([]string, len(names))
+		for i, name := range names {
+			fields[i] = csvField(name)
+		}
+		if _, err := io.WriteString(cw.w, strings.Join(fields, ",")+cw.newline); err != nil {
+			return err
+		}
+		cw.header = false
+	}
+	_, err := io.WriteString(cw.w, FormatCSVRow(row)+cw.newline)
+	return err
+}
+
+// EndTable implements TableWriter.
+func (cw *CSVWriter) EndTable() error {
+	return nil
+}
+
+// WriteFooter implements TableWriter by flushing the transcoder.
+func (cw *CSVWriter) WriteFooter(f Footer) error {
+	return cw.flush()
+}
+
+func (cw *CSVWriter) flush() error {
+	if cw.closer != nil {
+		return cw.closer.Close()
+	}
+	return nil
+}
+
+// FormatCSVRow renders a row as a CSV record (without line terminator).
+func FormatCSVRow(row []any) string {
+	fields := make([]string, len(row))
+	for i, v := range row {
+		if v != nil {
+			fields[i] = csvField(textValue(v))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// csvField quotes a non-NULL value like PostgreSQL's CSV output: when it is
+// empty, contains the delimiter, a quote or a line break, or is \. (the end
+// of data marker), with quotes doubled.
+func csvField(s string) string {
+	if s != "" && s != `\.` && !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,438 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// RestoreScript is the file of a directory output that restores it.
+const RestoreScript = "restore.sql"
+
+// DirWriter writes the output as a directory, similar to pg_dump's directory
+// format: one file per table holding its COPY blocks (or INSERT statements),
+// numbered in the order the tables are written, and RestoreScript, which
+// wraps the table files in the header and footer of a single-file output:
+//
+//	BEGIN;
+//	SET ...;
+//	\ir 001_public.tenants.sql
+//	\ir 002_public.users.sql
+//	...
+//	COMMIT;
+//
+// The directory is restored with psql -f <dir>/restore.sql or load <dir>;
+// single tables can be restored by editing the script. Tables without rows
+// get no file.
+//
+// Each table file is written by its own goroutine, which encodes the rows
+// sent to it and owns the file, so the tables are written in parallel while
+// the extraction fetches the next ones. Only the list of files, which fixes
+// the restore order, is kept by the caller. Errors of a table file are
+// returned by a later call for the table or by WriteFooter; Close stops the
+// writers of an aborted output.
+//
+// With FormatCSV the table files are CSV with a header line, and with
+// FormatJSONL JSON Lines, which the script loads with \copy ... FROM
+// '<file>' (JSON Lines through a temporary table and jsonb_populate_record).
+// \copy reads files relative to the working directory of psql, so the
+// script is run from the directory; load cannot read it.
+type DirWriter struct {
+	dir    string
+	opts   Options
+	header Header
+	// files are the table files in restore order
+	files  []*dirFile
+	byName map[string]*dirFile // schema.table → file
+
+	// table is the table block being written and file its table file,
+	// set with the first row
+	table  *schema.Table
+	file   *dirFile
+	closed bool
+}
+
+// dirFile is a table file of a DirWriter and the goroutine writing it.
+type dirFile struct {
+	name  string
+	table *schema.Table
+	ops   chan dirOp
+	done  chan struct{}
+	// failed is closed when writing fails, after err is set
+	failed chan struct{}
+	err    error
+}
+
+// dirOp is a row of a table block, or its beginning or end.
+type dirOp struct {
+	row        []any
+	begin, end bool
+}
+
+// dirQueue is the number of rows buffered for each table file.
+const dirQueue = 256
+
+// NewDirWriter creates a directory writer for dir, which must exist.
+func NewDirWriter(dir string, opts Options) (*DirWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &DirWriter{dir: dir, opts: opts, byName: make(map[string]*dirFile)}, nil
+}
+
+// WriteHeader implements TableWriter. The header is written to the restore
+// script with the footer.
+func (dw *DirWriter) WriteHeader(h Header) error {
+	dw.header = h
+	return nil
+}
+
+// BeginTable implements TableWriter.
+func (dw *DirWriter) BeginTable(table *schema.Table) error {
+	dw.table, dw.file = table, nil
+	return nil
+}
+
+// WriteRow implements TableWriter, sending the row to the writer of the
+// table's file. The row is copied, as the caller may reuse it.
+func (dw *DirWriter) WriteRow(row []any) error {
+	if dw.file == nil {
+		dw.file = dw.openFile()
+		if err := dw.file.send(dirOp{begin: true}); err != nil {
+			return err
+		}
+	}
+	return dw.file.send(dirOp{row: slices.Clone(row)})
+}
+
+// openFile returns the file of the current table, adding it to the restore
+// order and starting its writer on the table's first block.
+func (dw *DirWriter) openFile() *dirFile {
+	if f, ok := dw.byName[dw.table.FullName()]; ok {
+		return f
+	}
+	ext := ".sql"
+	switch dw.opts.Format {
+	case FormatCSV:
+		ext = ".csv"
+	case FormatJSONL:
+		ext = ".jsonl"
+	}
+	f := &dirFile{
+		name:   fmt.Sprintf("%03d_%s%s", len(dw.files)+1, fileName(dw.table.FullName()), ext),
+		table:  dw.table,
+		ops:    make(chan dirOp, dirQueue),
+		done:   make(chan struct{}),
+		failed: make(chan struct{}),
+	}
+	dw.byName[dw.table.FullName()] = f
+	dw.files = append(dw.files, f)
+	go f.run(filepath.Join(dw.dir, f.name), dw.opts)
+	return f
+}
+
+// EndTable implements TableWriter; the writer closes the table's file.
+func (dw *DirWriter) EndTable() error {
+	if dw.file == nil {
+		return nil
+	}
+	f := dw.file
+	dw.file = nil
+	return f.send(dirOp{end: true})
+}
+
+// Close stops the writers of the table files and returns the first error
+// of one. It is called by WriteFooter, and by the caller when the output
+// is abandoned.
+func (dw *DirWriter) Close() error {
+	if dw.closed {
+		return nil
+	}
+	dw.closed = true
+	for _, f := range dw.files {
+		close(f.ops)
+	}
+	var err error
+	for _, f := range dw.files {
+		<-f.done
+		if err == nil && f.err != nil {
+			err = fmt.Errorf("writing %s: %w", f.name, f.err)
+		}
+	}
+	return err
+}
+
+// send sends an operation to the writer, or returns its error.
+func (f *dirFile) send(op dirOp) error {
+	select {
+	case <-f.failed:
+		return fmt.Errorf("writing %s: %w", f.name, f.err)
+	default:
+	}
+	f.ops <- op
+	return nil
+}
+
+// run writes the blocks of a table file until ops is closed. Each block
+// appends to the file; the CSV header is written with the first. After an
+// error the remaining operations are discarded.
+func (f *dirFile) run(path string, opts Options) {
+	defer close(f.done)
+	var (
+		file   *os.File
+		block  TableWriter
+		blocks int
+	)
+	fail := func(err error) {
+		if err != nil && f.err == nil {
+			f.err = err
+			close(f.failed)
+		}
+	}
+	closeBlock := func() error {
+		err := block.EndTable()
+		if err == nil {
+			err = block.(flusher).flush()
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		file, block = nil, nil
+		return err
+	}
+	for op := range f.ops {
+		if f.err != nil {
+			continue
+		}
+		switch {
+		case op.begin:
+			var err error
+			if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+				fail(err)
+				continue
+			}
+			if block, err = New(file, opts); err != nil {
+				file.Close()
+				file = nil
+				fail(err)
+				continue
+			}
+			if cw, isCSV := block.(*CSVWriter); isCSV && blocks > 0 {
+				// the column names are at the top of the file already
+				cw.header = false
+			}
+			blocks++
+			fail(block.BeginTable(f.table))
+		case op.end:
+			fail(closeBlock())
+		default:
+			fail(block.WriteRow(op.row))
+		}
+	}
+	if file != nil {
+		// an abandoned block
+		file.Close()
+	}
+}
+
+// WriteFooter implements TableWriter by waiting for the table files and
+// writing the restore script.
+func (dw *DirWriter) WriteFooter(footer Footer) error {
+	if err := dw.Close(); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dw.dir, RestoreScript))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// The header and footer are written by separate writers, each flushing
+	// its transcoder, so the include lines stay in place.
+	head, err := dw.scriptWriter(f)
+	if err != nil {
+		return err
+	}
+	if err := head.WriteHeader(dw.header); err != nil {
+		return err
+	}
+	if err := head.(flusher).flush(); err != nil {
+		return err
+	}
+	if dw.opts.Format == FormatJSONL && len(dw.files) > 0 {
+		if _, err := fmt.Fprintln(f, "CREATE TEMPORARY TABLE "+jsonlTable+" (doc jsonb) ON COMMIT DROP;"); err != nil {
+			return err
+		}
+	}
+	for _, tf := range dw.files {
+		if _, err := fmt.Fprint(f, restoreLines(dw.opts, tf.table, tf.name)); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintln(f); err != nil {
+		return err
+	}
+	foot, err := dw.scriptWriter(f)
+	if err != nil {
+		return err
+	}
+	if err := foot.WriteFooter(footer); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// fileName replaces the characters of a table name that are unsafe in file
+// names and in the unquoted \ir lines of the restore script; the number
+// prefix keeps the names unique.
+func fileName(table string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, table)
+}
+
+// jsonlTable is the temporary table the restore script reads JSON Lines
+// files into.
+const jsonlTable = "db_sub_data_jsonl"
+
+// restoreLines returns the lines of the restore script loading a table file.
+// The SQL table files disable the triggers themselves.
+func restoreLines(opts Options, table *schema.Table, name string) string {
+	lines := restoreTable(opts.Format, table, name)
+	if opts.DisableTriggers && (opts.Format == FormatCSV || opts.Format == FormatJSONL) {
+		lines = triggersStatement(table, "DISABLE") + lines + triggersStatement(table, "ENABLE")
+	}
+	return lines
+}
+
+// restoreTable returns the lines loading the rows of a table file.
+func restoreTable(format string, table *schema.Table, name string) string {
+	columns := strings.Join(table.QuotedColumnNames(), ", ")
+	switch format {
+	case FormatCSV:
+		return fmt.Sprintf("\\copy %s (%s) FROM %s WITH (FORMAT csv, HEADER true)\n",
+			table.QuotedName(), columns, SQLLiteral(name))
+	case FormatJSONL:
+		// CSV with quote and delimiter characters JSON never contains
+		// unescaped reads each line into doc as is
+		selected := make([]string, len(table.Columns))
+		for i, c := range table.QuotedColumnNames() {
+			selected[i] = "r." + c
+		}
+		// like COPY, the restore keeps the values of identity columns
+		overriding := ""
+		if len(table.IdentityAlways()) > 0 {
+			overriding = "OVERRIDING SYSTEM VALUE "
+		}
+		return fmt.Sprintf("\\copy %s FROM %s WITH (FORMAT csv, QUOTE E'\\x01', DELIMITER E'\\x02')\n"+
+			"INSERT INTO %s (%s) %sSELECT %s FROM %s, jsonb_populate_record(NULL::%s, doc) r;\n"+
+			"TRUNCATE %s;\n",
+			jsonlTable, SQLLiteral(name),
+			table.QuotedName(), columns, overriding, strings.Join(selected, ", "), jsonlTable, table.QuotedName(),
+			jsonlTable)
+	default:
+		return "\\ir " + name + "\n"
+	}
+}
+
+// scriptWriter creates a writer of the header or footer of the restore
+// script, which are SQL also when the table files are not.
+func (dw *DirWriter) scriptWriter(w io.Writer) (TableWriter, error) {
+	switch dw.opts.Format {
+	case FormatCSV, FormatJSONL:
+		return NewWriter(w, dw.opts)
+	}
+	return New(w, dw.opts)
+}
+
+// flusher is implemented by the writers whose transcoder buffers output.
+type flusher interface {
+	flush() error
+}
+
+// OpenDir reads a directory output as a single-file output, inlining the
+// table files the restore script includes.
+func OpenDir(dir string) (io.ReadCloser, error) {
+	script, err := os.ReadFile(filepath.Join(dir, RestoreScript))
+	if err != nil {
+		return nil, err
+	}
+	r := &dirReader{dir: dir}
+	var text strings.Builder
+	for _, line := range strings.SplitAfter(string(script), "\n") {
+		if name, ok := strings.CutPrefix(line, `\ir `); ok {
+			r.parts = append(r.parts, dirPart{text: text.String()}, dirPart{file: strings.TrimSpace(name)})
+			text.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, `\copy `) {
+			return nil, fmt.Errorf("%s holds CSV or JSON Lines files; restore it with psql -f %s from the directory", dir, RestoreScript)
+		}
+		text.WriteString(line)
+	}
+	r.parts = append(r.parts, dirPart{text: text.String()})
+	return r, nil
+}
+
+// dirPart is a part of a directory output: text of the restore script or
+// an included table file.
+type dirPart struct {
+	text string
+	file string
+}
+
+// dirReader reads the parts of a directory output in turn, opening one
+// table file at a time.
+type dirReader struct {
+	dir   string
+	parts []dirPart
+	cur   io.Reader
+	file  *os.File
+}
+
+func (r *dirReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			part := r.parts[0]
+			r.parts = r.parts[1:]
+			if part.file == "" {
+				r.cur = strings.NewReader(part.text)
+			} else {
+				f, err := os.Open(filepath.Join(r.dir, part.file))
+				if err != nil {
+					return 0, err
+				}
+				r.file, r.cur = f, f
+			}
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *dirReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+func TestDirWriterTableFiles(t *testing.T) {
+	tenants := &schema.Table{Schema: "public", Name: "tenants", Columns: []schema.Column{{Name: "id", DataType: "int4"}}}
+	users := &schema.Table{Schema: "public", Name: "users", Columns: []schema.Column{{Name: "id", DataType: "int4"}, {Name: "name", DataType: "text"}}}
+	empty := &schema.Table{Schema: "public", Name: "empty", Columns: []schema.Column{{Name: "id", DataType: "int4"}}}
+
+	dir := t.TempDir()
+	dw, err := NewDirWriter(dir, Options{Format: FormatCSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tenants gets a second block after users, as closure rows do
+	blocks := []struct {
+		table *schema.Table
+		rows  [][]any
+	}{
+		{tenants, [][]any{{int32(1)}, {int32(2)}}},
+		{empty, nil},
+		{users, [][]any{{int32(10), "a"}, {int32(11), "b,c"}}},
+		{tenants, [][]any{{int32(3)}}},
+	}
+	if err := dw.WriteHeader(Header{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := dw.BeginTable(b.table); err != nil {
+			t.Fatal(err)
+		}
+		row := make([]any, len(b.table.Columns))
+		for _, r := range b.rows {
+			// the writer must copy rows the caller reuses
+			copy(row, r)
+			if err := dw.WriteRow(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dw.EndTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dw.WriteFooter(Footer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"001_public.tenants.csv": "id\n1\n2\n3\n",
+		"002_public.users.csv":   "id,name\n10,a\n11,\"b,c\"\n",
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want)+1 {
+		t.Errorf("got %d files, want %d table files and %s", len(entries), len(want), RestoreScript)
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+
+	script, err := os.ReadFile(filepath.Join(dir, RestoreScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Index(string(script), "'001_public.tenants.csv'")
+	second := strings.Index(string(script), "'002_public.users.csv'")
+	if first < 0 || second < first {
+		t.Errorf("%s does not load the table files in order:\n%s", RestoreScript, script)
+	}
+}
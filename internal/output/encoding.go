@@ -0,0 +1,78 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// DefaultEncoding is the client_encoding of the extracted data (pgx always uses UTF8).
+const DefaultEncoding = "UTF8"
+
+// encodings maps PostgreSQL client_encoding names to Go encoders.
+// UTF8 maps to nil (no transcoding).
+var encodings = map[string]encoding.Encoding{
+	"UTF8":    nil,
+	"LATIN1":  charmap.ISO8859_1,
+	"LATIN2":  charmap.ISO8859_2,
+	"LATIN9":  charmap.ISO8859_15,
+	"WIN1250": charmap.Windows1250,
+	"WIN1251": charmap.Windows1251,
+	"WIN1252": charmap.Windows1252,
+	"KOI8R":   charmap.KOI8R,
+	"SJIS":    japanese.ShiftJIS,
+	"EUC_JP":  japanese.EUCJP,
+	"EUC_KR":  korean.EUCKR,
+	"GBK":     simplifiedchinese.GBK,
+	"BIG5":    traditionalchinese.Big5,
+}
+
+// normalizeEncoding converts an encoding name to PostgreSQL's canonical spelling
+// (e.g. "utf-8" → "UTF8", "euc-jp" → "EUC_JP").
+func normalizeEncoding(name string) string {
+	n := strings.ToUpper(strings.TrimSpace(name))
+	switch n {
+	case "UTF-8", "UNICODE":
+		return "UTF8"
+	case "SHIFT_JIS", "SHIFT-JIS":
+		return "SJIS"
+	}
+	return strings.ReplaceAll(n, "-", "_")
+}
+
+// lookupEncoding resolves a PostgreSQL encoding name.
+func lookupEncoding(name string) (string, encoding.Encoding, error) {
+	n := normalizeEncoding(name)
+	enc, ok := encodings[n]
+	if !ok {
+		supported := make([]string, 0, len(encodings))
+		for k := range encodings {
+			supported = append(supported, k)
+		}
+		sort.Strings(supported)
+		return "", nil, fmt.Errorf("unsupported encoding %q (supported: %s)", name, strings.Join(supported, ", "))
+	}
+	return n, enc, nil
+}
+
+// crlfWriter rewrites every LF into CRLF. Values never contain raw newlines
+// (they are escaped), so every LF in the output is a line terminator.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
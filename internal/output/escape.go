@@ -1,10 +1,15 @@
 package output
 
 import (
+	"database/sql/driver"
 	"encoding/hex"
 	"fmt"
+	"net/netip"
+	"reflect"
 	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // EscapeCopyValue escapes a single value for PostgreSQL COPY text format.
@@ -13,7 +18,11 @@ func EscapeCopyValue(val any) string {
 	if val == nil {
 		return `\N`
 	}
+	return escapeString(textValue(val))
+}
 
+// textValue returns the PostgreSQL text representation of a non-nil value.
+func textValue(val any) string {
 	switch v := val.(type) {
 	case bool:
 		if v {
@@ -21,17 +30,108 @@ func EscapeCopyValue(val any) string {
 		}
 		return "f"
 	case []byte:
-		// bytea: output as hex-encoded with \x prefix
-		return `\\x` + hex.EncodeToString(v)
+		// bytea: hex format with \x prefix
+		return `\x` + hex.EncodeToString(v)
+	case float32:
+		return floatText(float64(v), 32)
+	case float64:
+		return floatText(v, 64)
 	case time.Time:
-		return escapeString(v.Format("2006-01-02 15:04:05.999999-07"))
+		return timestampText(v)
+	case pgtype.Numeric:
+		return numericText(v)
+	case pgtype.Interval:
+		return intervalText(v)
+	case pgtype.Time:
+		return clockText(v.Microseconds)
+	case pgtype.Range[any]:
+		return rangeLiteral(v)
+	case pgtype.Multirange[pgtype.Range[any]]:
+		return multirangeLiteral(v)
+	case netip.Prefix:
+		return prefixText(v)
+	case [16]byte:
+		return uuidText(v)
+	case Text:
+		return string(v)
 	case string:
-		return escapeString(v)
+		return v
+	case []any:
+		return arrayLiteral(v)
 	case fmt.Stringer:
-		return escapeString(v.String())
+		return v.String()
+	case driver.Valuer:
+		// the other pgtype types (bit strings, geometric types, tid)
+		// give their text representation
+		if s, err := v.Value(); err == nil {
+			if s, ok := s.(string); ok {
+				return s
+			}
+		}
+		return fmt.Sprintf("%v", v)
 	default:
-		return escapeString(fmt.Sprintf("%v", v))
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+			elems := make([]any, rv.Len())
+			for i := range elems {
+				elems[i] = rv.Index(i).Interface()
+			}
+			return arrayLiteral(elems)
+		}
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// arrayLiteral renders an array in PostgreSQL's text representation, e.g.
+// {1,2,NULL} or {{a,"b c"},{"",NULL}}; nested slices are the dimensions of
+// a multidimensional array.
+func arrayLiteral(elems []any) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, elem := range elems {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if elem == nil {
+			b.WriteString("NULL")
+			continue
+		}
+		s := textValue(elem)
+		if isNested(elem) {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteString(arrayElement(s))
 	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// isNested reports whether an array element is itself an array.
+func isNested(v any) bool {
+	switch v.(type) {
+	case []byte, Binary:
+		return false
+	}
+	return reflect.ValueOf(v).Kind() == reflect.Slice
+}
+
+// arrayElement quotes an array element when it is empty, NULL as a string,
+// or contains braces, a delimiter, a quote, a backslash or white space,
+// escaping quotes and backslashes.
+func arrayElement(s string) string {
+	if s != "" && !strings.EqualFold(s, "NULL") && !strings.ContainsAny(s, "{},\"\\ \t\n\r\v\f") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
 }
 
 // escapeString applies COPY text format escaping.
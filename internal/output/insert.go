@@ -0,0 +1,122 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// InsertWriter writes INSERT ... ON CONFLICT statements so the output can be
+// re-applied to a database that already contains some of the rows.
+// Header and footer are shared with the COPY writer.
+type InsertWriter struct {
+	*Writer
+	overriding     bool
+	prefix, suffix string
+}
+
+// NewInsertWriter creates a new upsert output writer.
+func NewInsertWriter(w io.Writer, opts Options) (*InsertWriter, error) {
+	cw, err := NewWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &InsertWriter{Writer: cw, overriding: opts.OverridingSystemValue}, nil
+}
+
+// WriteHeader writes the common header and enables standard_conforming_strings,
+// which the literals rely on for backslashes.
+func (iw *InsertWriter) WriteHeader(h Header) error {
+	if err := iw.Writer.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(iw.w, "SET standard_conforming_strings = on;\n\n")
+	return err
+}
+
+// BeginTable prepares the statement parts for a table. Rows conflicting on
+// the primary key are updated; tables without a primary key use DO NOTHING,
+// which only skips rows violating another unique constraint.
+func (iw *InsertWriter) BeginTable(table *schema.Table) error {
+	overriding := ""
+	if iw.overriding && len(table.IdentityAlways()) > 0 {
+		overriding = "OVERRIDING SYSTEM VALUE "
+	}
+	iw.table = table
+	iw.prefix = fmt.Sprintf("INSERT INTO %s (%s) %sVALUES (", table.QuotedName(), strings.Join(table.QuotedColumnNames(), ", "), overriding)
+	iw.suffix = ") " + conflictClause(table) + ";"
+	iw.started = false
+	return nil
+}
+
+// WriteRow writes one INSERT statement.
+func (iw *InsertWriter) WriteRow(row []any) error {
+	if !iw.started {
+		if err := iw.toggleTriggers("DISABLE"); err != nil {
+			return err
+		}
+	}
+	vals := make([]string, len(row))
+	for i, v := range row {
+		vals[i] = SQLLiteral(v)
+	}
+	iw.started = true
+	_, err := fmt.Fprintln(iw.w, iw.prefix+strings.Join(vals, ", ")+iw.suffix)
+	return err
+}
+
+// EndTable separates the statements of consecutive tables.
+func (iw *InsertWriter) EndTable() error {
+	if !iw.started {
+		return nil
+	}
+	iw.started = false
+	if err := iw.toggleTriggers("ENABLE"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(iw.w)
+	return err
+}
+
+// conflictClause builds the ON CONFLICT clause targeting the primary key.
+// GENERATED ALWAYS identity columns can only be updated to DEFAULT and are
+// left out of the update.
+func conflictClause(table *schema.Table) string {
+	pk := table.PKColumnNames()
+	if len(pk) == 0 {
+		return "ON CONFLICT DO NOTHING"
+	}
+
+	keep := make(map[string]bool, len(pk))
+	for _, c := range pk {
+		keep[c] = true
+	}
+	for _, c := range table.IdentityAlways() {
+		keep[c] = true
+	}
+	var sets []string
+	for _, c := range table.ColumnNames() {
+		if !keep[c] {
+			q := schema.QuoteIdent(c)
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", q, q))
+		}
+	}
+
+	target := "ON CONFLICT (" + strings.Join(schema.QuoteIdents(pk), ", ") + ")"
+	if len(sets) == 0 {
+		return target + " DO NOTHING"
+	}
+	return target + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// SQLLiteral renders a value as a quoted SQL literal. Values are written in
+// their text representation and left untyped, so PostgreSQL casts them to the
+// target column type.
+func SQLLiteral(val any) string {
+	if val == nil {
+		return "NULL"
+	}
+	return "'" + strings.ReplaceAll(textValue(val), "'", "''") + "'"
+}
@@ -0,0 +1,119 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// JSONLWriter writes the rows of a table as JSON Lines: one object per row
+// keyed by column name. Booleans, numbers, NULL, json/jsonb values and
+// arrays keep their JSON type; other values are strings in their
+// PostgreSQL text representation (timestamps as in COPY, bytea as \x hex),
+// which jsonb_populate_record reads back. It holds one table; DirWriter
+// writes a JSON Lines file per table.
+type JSONLWriter struct {
+	w       io.Writer
+	newline string
+	keys    []string // JSON-quoted column names
+}
+
+// NewJSONLWriter creates a JSON Lines writer. JSON is always UTF-8.
+func NewJSONLWriter(w io.Writer, opts Options) (*JSONLWriter, error) {
+	newline := "\n"
+	switch opts.Newline {
+	case "", "lf":
+	case "crlf":
+		newline = "\r\n"
+	default:
+		return nil, fmt.Errorf("unknown newline style %q (supported: lf, crlf)", opts.Newline)
+	}
+	if opts.Encoding != "" && normalizeEncoding(opts.Encoding) != DefaultEncoding {
+		return nil, fmt.Errorf("format %s is always written in UTF8 (got encoding %q)", FormatJSONL, opts.Encoding)
+	}
+	return &JSONLWriter{w: w, newline: newline}, nil
+}
+
+// WriteHeader implements TableWriter; JSON Lines has no header statements.
+func (jw *JSONLWriter) WriteHeader(h Header) error {
+	return nil
+}
+
+// BeginTable implements TableWriter.
+func (jw *JSONLWriter) BeginTable(table *schema.Table) error {
+	jw.keys = jw.keys[:0]
+	for _, name := range table.ColumnNames() {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		jw.keys = append(jw.keys, string(key))
+	}
+	return nil
+}
+
+// WriteRow writes a row as a JSON object.
+func (jw *JSONLWriter) WriteRow(row []any) error {
+	line := []byte{'{'}
+	for i, v := range row {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = append(line, jw.keys[i]...)
+		line = append(line, ':')
+		val, err := jsonValue(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", jw.keys[i], err)
+		}
+		line = append(line, val...)
+	}
+	line = append(line, '}')
+	line = append(line, jw.newline...)
+	_, err := jw.w.Write(line)
+	return err
+}
+
+// EndTable implements TableWriter.
+func (jw *JSONLWriter) EndTable() error {
+	return nil
+}
+
+// WriteFooter implements TableWriter.
+func (jw *JSONLWriter) WriteFooter(f Footer) error {
+	return nil
+}
+
+func (jw *JSONLWriter) flush() error {
+	return nil
+}
+
+// jsonValue renders a value of a row as JSON.
+func jsonValue(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return []byte("null"), nil
+	case time.Time:
+		// before json.Marshaler, which time.Time implements as RFC 3339
+		return json.Marshal(textValue(v))
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return json.Marshal(textValue(v))
+		}
+		return json.Marshal(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return json.Marshal(textValue(v))
+		}
+		return json.Marshal(v)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		map[string]any, []any, json.Marshaler:
+		// numbers (including numeric), json/jsonb values and arrays
+		return json.Marshal(v)
+	default:
+		return json.Marshal(textValue(v))
+	}
+}
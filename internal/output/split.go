@@ -0,0 +1,209 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+// SplitWriter writes the output as numbered parts of at most maxSize bytes
+// each. Every part is a complete script in its own transaction: it repeats
+// the header's settings and commits its rows, so the parts are applied one
+// after the other, in order. The types, DDL and TRUNCATE are only in the
+// first part and the sequence values only in the last; a COPY block crossing
+// a part boundary is ended and continued in the next part.
+//
+// The size is counted before compression, so compressed parts are smaller.
+// A single row larger than maxSize gets a part of its own.
+type SplitWriter struct {
+	open    func(part int) (io.WriteCloser, error)
+	opts    Options
+	maxSize int64
+	header  Header
+
+	part    int
+	w       io.WriteCloser
+	size    *countingWriter
+	tw      TableWriter
+	written int64 // bytes of the closed parts
+
+	// table is the table of the current block, if any
+	table *schema.Table
+	rows  int // rows of the current part
+}
+
+// NewSplitWriter creates a split writer; open creates part n (1-based).
+func NewSplitWriter(open func(part int) (io.WriteCloser, error), maxSize int64, opts Options) (*SplitWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &SplitWriter{open: open, maxSize: maxSize, opts: opts}, nil
+}
+
+// Parts returns the number of parts written.
+func (sw *SplitWriter) Parts() int {
+	return sw.part
+}
+
+// Written returns the number of bytes written to all parts.
+func (sw *SplitWriter) Written() int64 {
+	if sw.size == nil {
+		return sw.written
+	}
+	return sw.written + sw.size.n
+}
+
+// WriteHeader implements TableWriter by starting the first part.
+func (sw *SplitWriter) WriteHeader(h Header) error {
+	sw.header = h
+	return sw.nextPart()
+}
+
+// nextPart opens the next part and writes its header.
+func (sw *SplitWriter) nextPart() error {
+	sw.part++
+	w, err := sw.open(sw.part)
+	if err != nil {
+		return err
+	}
+	sw.w = w
+	sw.size = &countingWriter{w: w}
+	sw.rows = 0
+
+	opts, h := sw.opts, sw.header
+	if sw.part > 1 {
+		// The tables were created and emptied by the first part
+		opts.Truncate = false
+		h.Types, h.DDL = nil, nil
+	}
+	// Each part commits on its own, before the parents of its rows that
+	// later parts hold are loaded, so the checks cannot wait for COMMIT
+	h.DeferConstraints = false
+	if sw.tw, err = New(sw.size, opts); err != nil {
+		return err
+	}
+	return sw.tw.WriteHeader(h)
+}
+
+// closePart commits and closes the current part.
+func (sw *SplitWriter) closePart(f Footer) error {
+	if err := sw.tw.WriteFooter(f); err != nil {
+		return err
+	}
+	if err := sw.w.Close(); err != nil {
+		return err
+	}
+	sw.written += sw.size.n
+	sw.size = nil
+	return nil
+}
+
+// BeginTable implements TableWriter.
+func (sw *SplitWriter) BeginTable(table *schema.Table) error {
+	sw.table = table
+	return sw.tw.BeginTable(table)
+}
+
+// WriteRow implements TableWriter, starting a new part if the row and the
+// end of the part would not fit.
+func (sw *SplitWriter) WriteRow(row []any) error {
+	if sw.rows > 0 && sw.size.n+sw.rowSize(row)+sw.overhead() > sw.maxSize {
+		if err := sw.tw.EndTable(); err != nil {
+			return err
+		}
+		if err := sw.closePart(Footer{}); err != nil {
+			return err
+		}
+		if err := sw.nextPart(); err != nil {
+			return err
+		}
+		if err := sw.tw.BeginTable(sw.table); err != nil {
+			return err
+		}
+	}
+	sw.rows++
+	return sw.tw.WriteRow(row)
+}
+
+// rowSize returns the number of bytes a row occupies in a COPY block.
+func (sw *SplitWriter) rowSize(row []any) int64 {
+	switch sw.opts.CopyFormat {
+	case CopyCSV:
+		return int64(len(FormatCSVRow(row))) + 1
+	case CopyBinary:
+		return BinaryTupleSize(row)
+	}
+	return RowSize(row)
+}
+
+// overhead is the size of what a part may still need after a row: the
+// COPY line of the block, its terminator and the footer of the part.
+func (sw *SplitWriter) overhead() int64 {
+	n := int64(len(`\.`) + 2 + len(footerText(sw.opts, Footer{})))
+	if sw.table != nil {
+		n += int64(len(sw.table.QuotedName()) + len(strings.Join(sw.table.QuotedColumnNames(), ", ")) + 32)
+		n += int64(len(copyWith(sw.opts.CopyFormat)) + len(BinaryCopyHeader) + len(BinaryCopyTrailer))
+	}
+	return n
+}
+
+// EndTable implements TableWriter.
+func (sw *SplitWriter) EndTable() error {
+	sw.table = nil
+	return sw.tw.EndTable()
+}
+
+// WriteFooter implements TableWriter by closing the last part. If the
+// sequence values do not fit in it, they get a part of their own.
+func (sw *SplitWriter) WriteFooter(f Footer) error {
+	if sw.rows > 0 && sw.size.n+int64(len(footerText(sw.opts, f))) > sw.maxSize {
+		if err := sw.closePart(Footer{}); err != nil {
+			return err
+		}
+		if err := sw.nextPart(); err != nil {
+			return err
+		}
+	}
+	return sw.closePart(f)
+}
+
+// footerText renders the footer of a part.
+func footerText(opts Options, f Footer) string {
+	var b bytes.Buffer
+	tw, err := New(&b, opts)
+	if err != nil {
+		return ""
+	}
+	if err := tw.WriteFooter(f); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// PartPath returns the path of part n of an output path, numbered before
+// the extensions: subset.sql.gz → subset.001.sql.gz.
+func PartPath(path string, n int) string {
+	dir, base := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		dir, base = path[:i+1], path[i+1:]
+	}
+	if i := strings.Index(base, "."); i > 0 {
+		return fmt.Sprintf("%s%s.%03d%s", dir, base[:i], n, base[i:])
+	}
+	return fmt.Sprintf("%s%s.%03d", dir, base, n)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
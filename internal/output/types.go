@@ -0,0 +1,183 @@
+package output
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Values pgx decodes to types without a usable String method are rendered
+// the way the server's output functions write them, so an extract loads
+// back to the same value and, extracted again, to the same bytes. Composite
+// values need no handler: pgx knows no composite type unless registered,
+// so they are fetched in the text format and arrive as strings.
+
+// floatText renders a float4 (bits 32) or float8 value like float4out and
+// float8out: the shortest exact digits, in exponent form outside the
+// digits of precision of the type.
+func floatText(v float64, bits int) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+	digits := 15
+	if bits == 32 {
+		digits = 6
+	}
+	e := strconv.FormatFloat(v, 'e', -1, bits)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	if exp < -4 || exp >= digits {
+		return e
+	}
+	return strconv.FormatFloat(v, 'f', -1, bits)
+}
+
+// timestampText renders a timestamp with the UTC offset of its location,
+// with minutes (and seconds) only when the offset has them, as timestamptz
+// output does.
+func timestampText(t time.Time) string {
+	_, offset := t.Zone()
+	switch {
+	case offset%60 != 0:
+		return t.Format("2006-01-02 15:04:05.999999-07:00:00")
+	case offset%3600 != 0:
+		return t.Format("2006-01-02 15:04:05.999999-07:00")
+	}
+	return t.Format("2006-01-02 15:04:05.999999-07")
+}
+
+// numericText renders a numeric with the scale it was stored with
+// (including trailing zeros), or NaN and ±Infinity.
+func numericText(n pgtype.Numeric) string {
+	v, err := n.Value()
+	if s, ok := v.(string); ok && err == nil {
+		return s
+	}
+	return fmt.Sprintf("%v", n)
+}
+
+// uuidText renders a uuid, which pgx decodes to [16]byte.
+func uuidText(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// prefixText renders an inet or cidr value. pgx decodes both to a prefix,
+// so inet host addresses keep their /32 (or /128) mask length, which the
+// server reads as the same value.
+func prefixText(p netip.Prefix) string {
+	return p.String()
+}
+
+// clockText renders a duration in microseconds as hh:mm:ss, with the
+// fractional seconds only when they are not zero.
+func clockText(us int64) string {
+	s := fmt.Sprintf("%02d:%02d:%02d", us/3_600_000_000, us/60_000_000%60, us/1_000_000%60)
+	if frac := us % 1_000_000; frac != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+	}
+	return s
+}
+
+// intervalText renders an interval in the default (postgres) IntervalStyle,
+// e.g. "1 year 2 mons -3 days +04:05:06.5".
+func intervalText(iv pgtype.Interval) string {
+	var b strings.Builder
+	zero, before := true, false
+	part := func(v int64, unit string) {
+		if v == 0 {
+			return
+		}
+		if !zero {
+			b.WriteByte(' ')
+		}
+		if before && v > 0 {
+			b.WriteByte('+')
+		}
+		fmt.Fprintf(&b, "%d %s", v, unit)
+		if v != 1 {
+			b.WriteByte('s')
+		}
+		zero, before = false, v < 0
+	}
+	part(int64(iv.Months/12), "year")
+	part(int64(iv.Months%12), "mon")
+	part(int64(iv.Days), "day")
+	if us := iv.Microseconds; us != 0 || zero {
+		if !zero {
+			b.WriteByte(' ')
+		}
+		switch {
+		case us < 0:
+			b.WriteByte('-')
+			us = -us
+		case before:
+			b.WriteByte('+')
+		}
+		b.WriteString(clockText(us))
+	}
+	return b.String()
+}
+
+// rangeLiteral renders a range, e.g. [1,10) or (,"2024-01-01 00:00:00+00"],
+// or empty.
+func rangeLiteral(r pgtype.Range[any]) string {
+	if r.LowerType == pgtype.Empty {
+		return "empty"
+	}
+	var b strings.Builder
+	if r.LowerType == pgtype.Inclusive {
+		b.WriteByte('[')
+	} else {
+		b.WriteByte('(')
+	}
+	if r.LowerType != pgtype.Unbounded && r.Lower != nil {
+		b.WriteString(rangeBound(textValue(r.Lower)))
+	}
+	b.WriteByte(',')
+	if r.UpperType != pgtype.Unbounded && r.Upper != nil {
+		b.WriteString(rangeBound(textValue(r.Upper)))
+	}
+	if r.UpperType == pgtype.Inclusive {
+		b.WriteByte(']')
+	} else {
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// multirangeLiteral renders a multirange, e.g. {[1,3),[5,7)}.
+func multirangeLiteral(m pgtype.Multirange[pgtype.Range[any]]) string {
+	ranges := make([]string, len(m))
+	for i, r := range m {
+		ranges[i] = rangeLiteral(r)
+	}
+	return "{" + strings.Join(ranges, ",") + "}"
+}
+
+// rangeBound quotes a range bound when it is empty or contains brackets,
+// parentheses, a delimiter, a quote, a backslash or white space, doubling
+// quotes and backslashes as range_out does.
+func rangeBound(s string) string {
+	if s != "" && !strings.ContainsAny(s, "[](),\"\\ \t\n\r\v\f") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,362 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DDL returns the statements creating tables (with their schemas, sequences,
+// partitions, constraints and indexes) so that a dump can be restored into
+// an empty database. Foreign keys are only created between the given tables, and come
+// last so that creation order does not matter. Types, extensions and other
+// objects the tables depend on are not included.
+func DDL(ctx context.Context, pool Querier, tables []*Table) ([]string, error) {
+	names := make([]string, len(tables))
+	schemas := make(map[string]bool)
+	for i, t := range tables {
+		names[i] = t.FullName()
+		schemas[t.Schema] = true
+	}
+	sort.Strings(names)
+
+	var stmts []string
+	schemaNames := make([]string, 0, len(schemas))
+	for s := range schemas {
+		schemaNames = append(schemaNames, s)
+	}
+	sort.Strings(schemaNames)
+	for _, s := range schemaNames {
+		stmts = append(stmts, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", QuoteIdent(s)))
+	}
+
+	seqs, err := querySequenceDDL(ctx, pool, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying sequence definitions: %w", err)
+	}
+	stmts = append(stmts, seqs...)
+
+	creates, owned, err := queryTableDDL(ctx, pool, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying column definitions: %w", err)
+	}
+	stmts = append(stmts, creates...)
+
+	partitions, err := queryPartitionDDL(ctx, pool, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying partition definitions: %w", err)
+	}
+	stmts = append(stmts, partitions...)
+	stmts = append(stmts, owned...)
+
+	constraints, fks, err := queryConstraintDDL(ctx, pool, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying constraint definitions: %w", err)
+	}
+	stmts = append(stmts, constraints...)
+
+	indexes, err := queryIndexDDL(ctx, pool, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying index definitions: %w", err)
+	}
+	stmts = append(stmts, indexes...)
+
+	return append(stmts, fks...), nil
+}
+
+// querySequenceDDL returns CREATE SEQUENCE statements for the sequences used
+// by column defaults (e.g. serial columns). Identity sequences are created
+// with their columns.
+func querySequenceDDL(ctx context.Context, pool Querier, names []string) ([]string, error) {
+	query := `
+		SELECT DISTINCT
+			format('%I.%I', sn.nspname, s.relname) AS sequence_name,
+			format_type(seq.seqtypid, NULL) AS sequence_type,
+			seq.seqincrement, seq.seqmin, seq.seqmax, seq.seqstart, seq.seqcycle
+		FROM pg_attrdef ad
+		JOIN pg_class c ON c.oid = ad.adrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_depend d ON d.classid = 'pg_attrdef'::regclass
+			AND d.objid = ad.oid
+			AND d.refclassid = 'pg_class'::regclass
+		JOIN pg_class s ON s.oid = d.refobjid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_sequence seq ON seq.seqrelid = s.oid
+		WHERE n.nspname || '.' || c.relname = ANY($1)
+		ORDER BY 1
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stmts []string
+	for rows.Next() {
+		var name, typ string
+		var increment, minValue, maxValue, start int64
+		var cycle bool
+		if err := rows.Scan(&name, &typ, &increment, &minValue, &maxValue, &start, &cycle); err != nil {
+			return nil, err
+		}
+		stmt := fmt.Sprintf("CREATE SEQUENCE %s AS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d",
+			name, typ, increment, minValue, maxValue, start)
+		if cycle {
+			stmt += " CYCLE"
+		}
+		stmts = append(stmts, stmt+";")
+	}
+	return stmts, rows.Err()
+}
+
+// queryTableDDL returns a CREATE TABLE statement per table and the ALTER
+// SEQUENCE ... OWNED BY statements of serial columns.
+func queryTableDDL(ctx context.Context, pool Querier, names []string) (creates, owned []string, err error) {
+	query := `
+		SELECT
+			n.nspname || '.' || c.relname AS table_key,
+			format('%I.%I', n.nspname, c.relname) AS table_name,
+			quote_ident(a.attname) AS column_name,
+			format_type(a.atttypid, a.atttypmod) AS column_type,
+			a.attnotnull,
+			a.attidentity::text,
+			a.attgenerated::text,
+			coalesce(pg_get_expr(ad.adbin, ad.adrelid), '') AS default_expr,
+			coalesce(pg_get_serial_sequence(format('%I.%I', n.nspname, c.relname), a.attname), '') AS sequence_name,
+			coalesce(pg_get_partkeydef(c.oid), '') AS partition_key,
+			ARRAY(
+				SELECT pn.nspname || '.' || p.relname
+				FROM pg_inherits i
+				JOIN pg_class p ON p.oid = i.inhparent
+				JOIN pg_namespace pn ON pn.oid = p.relnamespace
+				WHERE i.inhrelid = c.oid
+					AND NOT c.relispartition
+					AND pn.nspname || '.' || p.relname = ANY($1)
+				ORDER BY i.inhseqno
+			) AS inherits
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = c.oid AND ad.adnum = a.attnum
+		WHERE c.relkind IN ('r', 'p')
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			AND n.nspname || '.' || c.relname = ANY($1)
+		ORDER BY n.nspname, c.relname, a.attnum
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var order []string
+	tableNames := make(map[string]string)
+	partitionKeys := make(map[string]string)
+	inherits := make(map[string][]string)
+	columns := make(map[string][]string)
+	for rows.Next() {
+		var key, table, col, typ, identity, generated, def, seq, partitionKey string
+		var parents []string
+		var notNull bool
+		if err := rows.Scan(&key, &table, &col, &typ, &notNull, &identity, &generated, &def, &seq, &partitionKey, &parents); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := tableNames[key]; !ok {
+			order = append(order, key)
+			tableNames[key] = table
+			partitionKeys[key] = partitionKey
+			inherits[key] = parents
+		}
+
+		colDef := col + " " + typ
+		switch {
+		case identity == "a" || identity == "d":
+			kind := "ALWAYS"
+			if identity == "d" {
+				kind = "BY DEFAULT"
+			}
+			colDef += fmt.Sprintf(" GENERATED %s AS IDENTITY (SEQUENCE NAME %s)", kind, seq)
+		case generated == "s":
+			colDef += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", def)
+		case def != "":
+			colDef += " DEFAULT " + def
+			if seq != "" {
+				owned = append(owned, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;", seq, table, col))
+			}
+		}
+		if notNull {
+			colDef += " NOT NULL"
+		}
+		columns[key] = append(columns[key], colDef)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// tables are created after the tables they inherit from
+	created := make(map[string]bool)
+	var create func(key string)
+	create = func(key string) {
+		if created[key] {
+			return
+		}
+		created[key] = true
+		parents := make([]string, len(inherits[key]))
+		for i, parent := range inherits[key] {
+			create(parent)
+			parents[i] = tableNames[parent]
+		}
+		stmt := fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", tableNames[key], strings.Join(columns[key], ",\n    "))
+		if len(parents) > 0 {
+			// the columns of the parents merge with the same columns
+			stmt += " INHERITS (" + strings.Join(parents, ", ") + ")"
+		}
+		if partitionKeys[key] != "" {
+			stmt += " PARTITION BY " + partitionKeys[key]
+		}
+		creates = append(creates, stmt+";")
+	}
+	for _, key := range order {
+		create(key)
+	}
+	return creates, owned, nil
+}
+
+// queryPartitionDDL returns the CREATE TABLE ... PARTITION OF statements of
+// the partitions of the given partitioned tables, recursively, parents
+// first. Partitions get their columns, constraints and indexes from their
+// parents.
+func queryPartitionDDL(ctx context.Context, pool Querier, names []string) ([]string, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT c.oid, 0 AS level
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.relkind = 'p'
+				AND n.nspname || '.' || c.relname = ANY($1)
+			UNION ALL
+			SELECT i.inhrelid, t.level + 1
+			FROM pg_inherits i
+			JOIN tree t ON t.oid = i.inhparent
+		)
+		SELECT
+			format('%I.%I', n.nspname, c.relname) AS partition_name,
+			format('%I.%I', pn.nspname, pc.relname) AS parent_name,
+			pg_get_expr(c.relpartbound, c.oid) AS bound,
+			coalesce(pg_get_partkeydef(c.oid), '') AS partition_key
+		FROM tree t
+		JOIN pg_class c ON c.oid = t.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_inherits i ON i.inhrelid = c.oid
+		JOIN pg_class pc ON pc.oid = i.inhparent
+		JOIN pg_namespace pn ON pn.oid = pc.relnamespace
+		WHERE t.level > 0
+		ORDER BY t.level, n.nspname, c.relname
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stmts []string
+	for rows.Next() {
+		var name, parent, bound, partitionKey string
+		if err := rows.Scan(&name, &parent, &bound, &partitionKey); err != nil {
+			return nil, err
+		}
+		stmt := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s %s", name, parent, bound)
+		if partitionKey != "" {
+			stmt += " PARTITION BY " + partitionKey
+		}
+		stmts = append(stmts, stmt+";")
+	}
+	return stmts, rows.Err()
+}
+
+// queryConstraintDDL returns the primary key, unique, check and exclusion
+// constraints, and separately the foreign keys between the given tables.
+func queryConstraintDDL(ctx context.Context, pool Querier, names []string) (constraints, fks []string, err error) {
+	query := `
+		SELECT
+			format('%I.%I', n.nspname, c.relname) AS table_name,
+			quote_ident(con.conname) AS constraint_name,
+			con.contype::text,
+			pg_get_constraintdef(con.oid) AS definition,
+			coalesce(rn.nspname || '.' || rc.relname, '') AS parent_key
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class rc ON rc.oid = con.confrelid
+		LEFT JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		WHERE con.contype IN ('p', 'u', 'c', 'x', 'f')
+			AND con.conislocal
+			AND n.nspname || '.' || c.relname = ANY($1)
+		ORDER BY n.nspname, c.relname, position(con.contype::text IN 'pucxf'), con.conname
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	inScope := make(map[string]bool, len(names))
+	for _, name := range names {
+		inScope[name] = true
+	}
+	for rows.Next() {
+		var table, name, typ, def, parent string
+		if err := rows.Scan(&table, &name, &typ, &def, &parent); err != nil {
+			return nil, nil, err
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", table, name, def)
+		if typ != "f" {
+			constraints = append(constraints, stmt)
+		} else if inScope[parent] {
+			fks = append(fks, stmt)
+		}
+	}
+	return constraints, fks, rows.Err()
+}
+
+// queryIndexDDL returns the CREATE INDEX statements of indexes not created by
+// a constraint.
+func queryIndexDDL(ctx context.Context, pool Querier, names []string) ([]string, error) {
+	query := `
+		SELECT pg_get_indexdef(i.indexrelid) || ';'
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		WHERE n.nspname || '.' || c.relname = ANY($1)
+			AND NOT EXISTS (
+				SELECT 1 FROM pg_constraint con
+				WHERE con.conrelid = i.indrelid AND con.conindid = i.indexrelid
+			)
+		ORDER BY n.nspname, c.relname, ic.relname
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stmts []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return nil, err
+		}
+		// the index of a partitioned table is defined ON ONLY the table;
+		// created on the table, it is created on the partitions as well
+		stmts = append(stmts, strings.Replace(stmt, " ON ONLY ", " ON ", 1))
+	}
+	return stmts, rows.Err()
+}
@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns a stable hash of the table, column, PK, and FK definitions
+// of the given tables. Virtual relations are not part of the database schema and
+// are ignored, so the same fingerprint can be computed on a target database.
+func Fingerprint(tables []*Table) string {
+	sorted := make([]*Table, len(tables))
+	copy(sorted, tables)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FullName() < sorted[j].FullName() })
+
+	h := sha256.New()
+	for _, t := range sorted {
+		fmt.Fprintf(h, "table %s\n", t.FullName())
+		for _, c := range t.Columns {
+			fmt.Fprintf(h, "column %s %s nullable=%t\n", c.Name, c.DataType, c.Nullable)
+		}
+		if pk := t.PKColumnNames(); pk != nil {
+			fmt.Fprintf(h, "pk %s\n", strings.Join(pk, ","))
+		}
+		writeFKs(h, t.ForeignKeys)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func writeFKs(w io.Writer, fks []ForeignKey) {
+	var real []ForeignKey
+	for _, fk := range fks {
+		if fk.Virtual == VirtualNone {
+			real = append(real, fk)
+		}
+	}
+	sort.Slice(real, func(i, j int) bool { return real[i].Name < real[j].Name })
+	for _, fk := range real {
+		fmt.Fprintf(w, "fk %s (%s) -> %s.%s (%s)\n",
+			fk.Name, strings.Join(fk.ChildColumns, ","),
+			fk.ParentSchema, fk.ParentTable, strings.Join(fk.ParentColumns, ","))
+	}
+}
@@ -0,0 +1,68 @@
+package schema
+
+import "strings"
+
+// QuoteIdent quotes an identifier the way PostgreSQL's quote_ident does when
+// quoting is needed: names with characters other than lower case letters,
+// digits and underscores, names starting with a digit, and keywords that
+// cannot be used as column or table names.
+func QuoteIdent(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+	}) < 0 && (s[0] < '0' || s[0] > '9') && !keywords[s] {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// QuoteQualified quotes a schema.table name, such as the keys of the table
+// maps. The schema ends at the first dot.
+func QuoteQualified(name string) string {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		return QuoteIdent(name)
+	}
+	return QuoteIdent(schema) + "." + QuoteIdent(table)
+}
+
+// QuoteIdents quotes each of names.
+func QuoteIdents(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = QuoteIdent(name)
+	}
+	return quoted
+}
+
+// keywords are the reserved, type/function name and column name keywords
+// of PostgreSQL, which quote_ident quotes (the unreserved ones are not).
+var keywords = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, kw := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric both case cast
+		check collate column constraint create current_catalog current_date
+		current_role current_time current_timestamp current_user default
+		deferrable desc distinct do else end except false fetch for foreign
+		from grant group having in initially intersect into lateral leading
+		limit localtime localtimestamp not null offset on only or order
+		placing primary references returning select session_user some
+		symmetric system_user table then to trailing true union unique user
+		using variadic when where window with
+
+		authorization binary collation concurrently cross current_schema
+		freeze full ilike inner is isnull join left like natural notnull
+		outer overlaps right similar tablesample verbose
+
+		between bigint bit boolean char character coalesce dec decimal
+		exists extract float greatest grouping inout int integer interval
+		json json_array json_arrayagg json_exists json_object
+		json_objectagg json_query json_scalar json_serialize json_table
+		json_value least merge_action national nchar none normalize nullif
+		numeric out overlay position precision real row setof smallint
+		substring time timestamp treat trim values varchar xmlattributes
+		xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse
+		xmlpi xmlroot xmlserialize xmltable`) {
+		m[kw] = true
+	}
+	return m
+}()
@@ -4,11 +4,20 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
+// Querier is the subset of pgx.Conn / pgxpool.Pool used for introspection.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
 // Introspect queries PostgreSQL catalogs and returns all tables with columns, PKs, and FKs.
-func Introspect(ctx context.Context, pool *pgxpool.Pool, schemas []string) (map[string]*Table, error) {
+// Partitioned tables are returned as one table, without their partitions:
+// queries against the parent read the rows of all partitions, and COPY into
+// the parent routes each row to its partition. Foreign tables are returned
+// with Foreign set.
+func Introspect(ctx context.Context, pool Querier, schemas []string) (map[string]*Table, error) {
 	tables, err := queryTablesAndColumns(ctx, pool, schemas)
 	if err != nil {
 		return nil, fmt.Errorf("querying tables and columns: %w", err)
@@ -18,27 +27,44 @@ func Introspect(ctx context.Context, pool *pgxpool.Pool, schemas []string) (map[
 		return nil, fmt.Errorf("querying primary keys: %w", err)
 	}
 
+	if err := queryUniqueKeys(ctx, pool, schemas, tables); err != nil {
+		return nil, fmt.Errorf("querying unique keys: %w", err)
+	}
+
 	if err := queryForeignKeys(ctx, pool, schemas, tables); err != nil {
 		return nil, fmt.Errorf("querying foreign keys: %w", err)
 	}
 
+	if err := querySequences(ctx, pool, schemas, tables); err != nil {
+		return nil, fmt.Errorf("querying sequences: %w", err)
+	}
+
+	if err := queryInheritance(ctx, pool, schemas, tables); err != nil {
+		return nil, fmt.Errorf("querying inheritance: %w", err)
+	}
+
 	return tables, nil
 }
 
-func queryTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, schemas []string) (map[string]*Table, error) {
+func queryTablesAndColumns(ctx context.Context, pool Querier, schemas []string) (map[string]*Table, error) {
 	query := `
 		SELECT
 			n.nspname AS schema_name,
 			c.relname AS table_name,
 			a.attname AS column_name,
 			t.typname AS data_type,
+			format_type(a.atttypid, NULL) AS sql_type,
 			NOT a.attnotnull AS is_nullable,
-			a.attnum AS ordinal_position
+			a.attnum AS ordinal_position,
+			a.attidentity::text AS identity,
+			a.attgenerated = 's' AS generated,
+			c.relkind = 'f' AS is_foreign
 		FROM pg_class c
 		JOIN pg_namespace n ON n.oid = c.relnamespace
 		JOIN pg_attribute a ON a.attrelid = c.oid
 		JOIN pg_type t ON t.oid = a.atttypid
-		WHERE c.relkind = 'r'
+		WHERE c.relkind IN ('r', 'p', 'f')
+			AND NOT c.relispartition
 			AND a.attnum > 0
 			AND NOT a.attisdropped
 			AND n.nspname = ANY($1)
@@ -53,10 +79,10 @@ func queryTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, schemas []st
 
 	tables := make(map[string]*Table)
 	for rows.Next() {
-		var schemaName, tableName, colName, dataType string
-		var nullable bool
+		var schemaName, tableName, colName, dataType, sqlType, identity string
+		var nullable, generated, foreign bool
 		var ordPos int
-		if err := rows.Scan(&schemaName, &tableName, &colName, &dataType, &nullable, &ordPos); err != nil {
+		if err := rows.Scan(&schemaName, &tableName, &colName, &dataType, &sqlType, &nullable, &ordPos, &identity, &generated, &foreign); err != nil {
 			return nil, err
 		}
 
@@ -64,23 +90,33 @@ func queryTablesAndColumns(ctx context.Context, pool *pgxpool.Pool, schemas []st
 		tbl, ok := tables[key]
 		if !ok {
 			tbl = &Table{
-				Schema: schemaName,
-				Name:   tableName,
+				Schema:  schemaName,
+				Name:    tableName,
+				Foreign: foreign,
 			}
 			tables[key] = tbl
 		}
-		tbl.Columns = append(tbl.Columns, Column{
-			Name:     colName,
-			DataType: dataType,
-			Nullable: nullable,
-			OrdPos:   ordPos,
-		})
+		col := Column{
+			Name:      colName,
+			DataType:  dataType,
+			SQLType:   sqlType,
+			Generated: generated,
+			Nullable:  nullable,
+			OrdPos:    ordPos,
+		}
+		switch identity {
+		case "a":
+			col.Identity = IdentityAlways
+		case "d":
+			col.Identity = IdentityByDefault
+		}
+		tbl.Columns = append(tbl.Columns, col)
 	}
 
 	return tables, rows.Err()
 }
 
-func queryPrimaryKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string, tables map[string]*Table) error {
+func queryPrimaryKeys(ctx context.Context, pool Querier, schemas []string, tables map[string]*Table) error {
 	query := `
 		SELECT
 			n.nspname AS schema_name,
@@ -124,7 +160,96 @@ func queryPrimaryKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 	return rows.Err()
 }
 
-func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string, tables map[string]*Table) error {
+// queryUniqueKeys records the unique constraints and unique indexes of the
+// tables, ordered by name.
+func queryUniqueKeys(ctx context.Context, pool Querier, schemas []string, tables map[string]*Table) error {
+	query := `
+		SELECT
+			n.nspname || '.' || c.relname AS table_key,
+			ARRAY(
+				SELECT a.attname
+				FROM unnest((i.indkey::int2[])[0:i.indnkeyatts - 1]) WITH ORDINALITY AS u(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = u.attnum
+				ORDER BY u.ord
+			) AS columns
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		WHERE i.indisunique
+			AND NOT i.indisprimary
+			AND i.indisvalid
+			AND i.indexprs IS NULL
+			AND i.indpred IS NULL
+			AND n.nspname = ANY($1)
+		ORDER BY 1, ic.relname
+	`
+
+	rows, err := pool.Query(ctx, query, schemas)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var columns []string
+		if err := rows.Scan(&key, &columns); err != nil {
+			return err
+		}
+		if tbl, ok := tables[key]; ok {
+			tbl.UniqueKeys = append(tbl.UniqueKeys, columns)
+		}
+	}
+
+	return rows.Err()
+}
+
+// querySequences records the sequences owned by serial and identity columns.
+func querySequences(ctx context.Context, pool Querier, schemas []string, tables map[string]*Table) error {
+	query := `
+		SELECT
+			n.nspname AS schema_name,
+			c.relname AS table_name,
+			a.attname AS column_name,
+			format('%I.%I', sn.nspname, s.relname) AS sequence_name
+		FROM pg_class s
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_depend d ON d.objid = s.oid
+			AND d.classid = 'pg_class'::regclass
+			AND d.refclassid = 'pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+		JOIN pg_class c ON c.oid = d.refobjid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.refobjsubid
+		WHERE s.relkind = 'S'
+			AND n.nspname = ANY($1)
+	`
+
+	rows, err := pool.Query(ctx, query, schemas)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName, tableName, colName, seqName string
+		if err := rows.Scan(&schemaName, &tableName, &colName, &seqName); err != nil {
+			return err
+		}
+		tbl, ok := tables[schemaName+"."+tableName]
+		if !ok {
+			continue
+		}
+		if col := tbl.Column(colName); col != nil {
+			col.Sequence = seqName
+		}
+	}
+
+	return rows.Err()
+}
+
+func queryForeignKeys(ctx context.Context, pool Querier, schemas []string, tables map[string]*Table) error {
 	query := `
 		SELECT
 			con.conname AS fk_name,
@@ -134,6 +259,8 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 			pn.nspname AS parent_schema,
 			pc.relname AS parent_table,
 			pa.attname AS parent_column,
+			NOT con.convalidated AS not_valid,
+			con.condeferrable AS deferrable,
 			u.ord AS key_position
 		FROM pg_constraint con
 		JOIN pg_class cc ON cc.oid = con.conrelid
@@ -145,6 +272,10 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 		JOIN pg_attribute pa ON pa.attrelid = pc.oid AND pa.attnum = u.parent_attnum
 		WHERE con.contype = 'f'
 			AND cn.nspname = ANY($1)
+			-- constraints cloned to partitions (on either side) repeat the
+			-- name of the constraint on the partitioned table
+			AND NOT cc.relispartition
+			AND NOT pc.relispartition
 		ORDER BY con.conname, u.ord
 	`
 
@@ -163,6 +294,8 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 		parentSchema string
 		parentTable  string
 		parentCol    string
+		notValid     bool
+		deferrable   bool
 	}
 
 	fksByName := make(map[string][]fkEntry)
@@ -172,7 +305,7 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 		var e fkEntry
 		var keyPos int
 		if err := rows.Scan(&e.name, &e.childSchema, &e.childTable, &e.childCol,
-			&e.parentSchema, &e.parentTable, &e.parentCol, &keyPos); err != nil {
+			&e.parentSchema, &e.parentTable, &e.parentCol, &e.notValid, &e.deferrable, &keyPos); err != nil {
 			return err
 		}
 		if _, exists := fksByName[e.name]; !exists {
@@ -193,6 +326,8 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 			ChildTable:   first.childTable,
 			ParentSchema: first.parentSchema,
 			ParentTable:  first.parentTable,
+			NotValid:     first.notValid,
+			Deferrable:   first.deferrable,
 		}
 		for _, e := range entries {
 			fk.ChildColumns = append(fk.ChildColumns, e.childCol)
@@ -208,3 +343,62 @@ func queryForeignKeys(ctx context.Context, pool *pgxpool.Pool, schemas []string,
 
 	return nil
 }
+
+// queryInheritance records the tables inheriting from other tables
+// (INHERITS), setting Inherits and Only.
+func queryInheritance(ctx context.Context, pool Querier, schemas []string, tables map[string]*Table) error {
+	query := `
+		SELECT
+			cn.nspname || '.' || c.relname AS child_key,
+			pn.nspname || '.' || p.relname AS parent_key
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_namespace cn ON cn.oid = c.relnamespace
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		WHERE NOT c.relispartition
+			AND (cn.nspname = ANY($1) OR pn.nspname = ANY($1))
+		ORDER BY 1, i.inhseqno
+	`
+
+	rows, err := pool.Query(ctx, query, schemas)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var childKey, parentKey string
+		if err := rows.Scan(&childKey, &parentKey); err != nil {
+			return err
+		}
+		if child, ok := tables[childKey]; ok {
+			child.Inherits = append(child.Inherits, parentKey)
+		}
+		if parent, ok := tables[parentKey]; ok {
+			parent.Only = true
+		}
+	}
+
+	return rows.Err()
+}
+
+// MergeInherited folds the tables inheriting from other tables in tables
+// into them, the way partitions are folded into partitioned tables: the
+// inheriting tables are removed, and the tables they inherit from are read
+// with their rows, which load into the parent (and from there into the
+// children where triggers route them).
+func MergeInherited(tables map[string]*Table) {
+	var merged []string
+	for key, t := range tables {
+		for _, parent := range t.Inherits {
+			if p, ok := tables[parent]; ok {
+				p.Only = false
+				merged = append(merged, key)
+			}
+		}
+	}
+	for _, key := range merged {
+		delete(tables, key)
+	}
+}
@@ -0,0 +1,70 @@
+package schema
+
+import "context"
+
+// TableStat holds the planner's size estimates of a table.
+type TableStat struct {
+	Rows  int64 // pg_class.reltuples (-1 if never analyzed)
+	Bytes int64 // pg_total_relation_size
+}
+
+// UserSchemas returns the non-system schemas that contain tables.
+func UserSchemas(ctx context.Context, pool Querier) ([]string, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT n.nspname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND n.nspname NOT LIKE 'pg\_%'
+		ORDER BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, rows.Err()
+}
+
+// TableStats returns size estimates per table (schema.table) in schemas. The
+// estimates of a partitioned table are the sums over its leaf partitions.
+func TableStats(ctx context.Context, pool Querier, schemas []string) (map[string]TableStat, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT n.nspname || '.' || c.relname, coalesce(p.rows, c.reltuples::bigint), coalesce(p.bytes, pg_total_relation_size(c.oid))
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN LATERAL (
+			SELECT sum(greatest(l.reltuples, 0))::bigint AS rows, sum(pg_total_relation_size(l.oid))::bigint AS bytes
+			FROM pg_partition_tree(c.oid) t
+			JOIN pg_class l ON l.oid = t.relid
+			WHERE t.isleaf
+		) p ON c.relkind = 'p'
+		WHERE c.relkind IN ('r', 'p')
+			AND NOT c.relispartition
+			AND n.nspname = ANY($1)
+	`, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]TableStat)
+	for rows.Next() {
+		var name string
+		var st TableStat
+		if err := rows.Scan(&name, &st.Rows, &st.Bytes); err != nil {
+			return nil, err
+		}
+		stats[name] = st
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,151 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TypeDDL returns the statements creating the enum, domain and composite
+// types the columns of tables use (directly, as array elements, or through
+// other such types), with their schemas, in dependency order. Each type is
+// created only if it does not exist, so the statements also run against a
+// database that has the types.
+func TypeDDL(ctx context.Context, pool Querier, tables []*Table) ([]string, error) {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.FullName()
+	}
+	query := `
+		WITH RECURSIVE used(oid) AS (
+			SELECT a.atttypid
+			FROM pg_attribute a
+			JOIN pg_class c ON c.oid = a.attrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname || '.' || c.relname = ANY($1)
+				AND a.attnum > 0
+				AND NOT a.attisdropped
+			UNION
+			SELECT d.oid
+			FROM used u
+			JOIN pg_type t ON t.oid = u.oid
+			CROSS JOIN LATERAL (
+				SELECT t.typelem WHERE t.typcategory = 'A'
+				UNION ALL
+				SELECT t.typbasetype WHERE t.typtype = 'd'
+				UNION ALL
+				SELECT a.atttypid FROM pg_attribute a
+				WHERE t.typtype = 'c' AND a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped
+			) d(oid)
+		)
+		SELECT
+			t.oid,
+			n.nspname,
+			format('%I.%I', n.nspname, t.typname) AS type_name,
+			t.typtype::text,
+			ARRAY(SELECT quote_literal(e.enumlabel) FROM pg_enum e WHERE e.enumtypid = t.oid ORDER BY e.enumsortorder) AS labels,
+			coalesce(format_type(t.typbasetype, t.typtypmod), '') AS base_type,
+			t.typnotnull,
+			coalesce(t.typdefault, '') AS default_expr,
+			ARRAY(SELECT format('CONSTRAINT %I %s', con.conname, pg_get_constraintdef(con.oid))
+				FROM pg_constraint con WHERE con.contypid = t.oid ORDER BY con.conname) AS checks,
+			ARRAY(SELECT format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod))
+				FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum) AS attributes,
+			ARRAY(SELECT CASE WHEN dt.typcategory = 'A' THEN dt.typelem ELSE dt.oid END
+				FROM pg_type dt
+				WHERE dt.oid = t.typbasetype
+					OR dt.oid IN (SELECT a.atttypid FROM pg_attribute a WHERE a.attrelid = t.typrelid AND a.attnum > 0)) AS deps
+		FROM used u
+		JOIN pg_type t ON t.oid = u.oid
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_class tc ON tc.oid = t.typrelid
+		WHERE (t.typtype IN ('e', 'd') OR (t.typtype = 'c' AND tc.relkind = 'c'))
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND n.nspname NOT LIKE 'pg\_%'
+		ORDER BY type_name
+	`
+
+	rows, err := pool.Query(ctx, query, names)
+	if err != nil {
+		return nil, fmt.Errorf("querying type definitions: %w", err)
+	}
+	defer rows.Close()
+
+	type typeDef struct {
+		stmt string
+		deps []uint32
+	}
+	defs := make(map[uint32]*typeDef)
+	var order []uint32
+	schemas := make(map[string]bool)
+	for rows.Next() {
+		var oid uint32
+		var schemaName, name, kind, base, def string
+		var labels, checks, attributes []string
+		var notNull bool
+		var deps []uint32
+		if err := rows.Scan(&oid, &schemaName, &name, &kind, &labels, &base, &notNull, &def, &checks, &attributes, &deps); err != nil {
+			return nil, err
+		}
+		var stmt string
+		switch kind {
+		case "e":
+			stmt = fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", name, strings.Join(labels, ", "))
+		case "d":
+			stmt = fmt.Sprintf("CREATE DOMAIN %s AS %s", name, base)
+			if def != "" {
+				stmt += " DEFAULT " + def
+			}
+			if notNull {
+				stmt += " NOT NULL"
+			}
+			for _, c := range checks {
+				stmt += " " + c
+			}
+		default:
+			stmt = fmt.Sprintf("CREATE TYPE %s AS (%s)", name, strings.Join(attributes, ", "))
+		}
+		defs[oid] = &typeDef{stmt: stmt, deps: deps}
+		order = append(order, oid)
+		schemas[schemaName] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schemaNames := make([]string, 0, len(schemas))
+	for s := range schemas {
+		schemaNames = append(schemaNames, s)
+	}
+	sort.Strings(schemaNames)
+	var stmts []string
+	for _, s := range schemaNames {
+		stmts = append(stmts, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", QuoteIdent(s)))
+	}
+
+	// types are created after the types they use
+	created := make(map[uint32]bool)
+	var create func(oid uint32)
+	create = func(oid uint32) {
+		d, ok := defs[oid]
+		if !ok || created[oid] {
+			return
+		}
+		created[oid] = true
+		for _, dep := range d.deps {
+			create(dep)
+		}
+		stmts = append(stmts, ifNotExists(d.stmt))
+	}
+	for _, oid := range order {
+		create(oid)
+	}
+	return stmts, nil
+}
+
+// ifNotExists wraps a CREATE TYPE or CREATE DOMAIN statement, which have no
+// IF NOT EXISTS, so that it does nothing when the type exists.
+func ifNotExists(stmt string) string {
+	return fmt.Sprintf("DO $ddl$ BEGIN\n    %s;\nEXCEPTION WHEN duplicate_object THEN NULL;\nEND $ddl$;", stmt)
+}
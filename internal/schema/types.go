@@ -4,10 +4,28 @@ package schema
 type Column struct {
 	Name     string
 	DataType string // PostgreSQL type name (e.g. "int4", "text", "bool")
-	Nullable bool
-	OrdPos   int // ordinal position (1-based)
+	// SQLType is the type as written in SQL (e.g. "integer", "myschema.mood",
+	// "text[]"), schema-qualified when not visible in the search path.
+	SQLType string
+	// Sequence is the sequence owned by a serial or identity column
+	// (quoted "schema.name"), or "".
+	Sequence string
+	// Identity is IdentityAlways or IdentityByDefault for an identity
+	// column, or "".
+	Identity string
+	// Generated is set for a stored generated column, whose values the
+	// server computes and which cannot be written.
+	Generated bool
+	Nullable  bool
+	OrdPos    int // ordinal position (1-based)
 }
 
+// Identity column kinds.
+const (
+	IdentityAlways    = "always"
+	IdentityByDefault = "by default"
+)
+
 // PrimaryKey represents a table's primary key.
 type PrimaryKey struct {
 	Columns []string
@@ -17,32 +35,60 @@ type PrimaryKey struct {
 type VirtualType string
 
 const (
-	VirtualNone  VirtualType = ""      // real FK constraint
-	VirtualArray VirtualType = "array" // PostgreSQL array column (e.g. int[])
-	VirtualJSON  VirtualType = "json"  // JSONB field (e.g. metadata->>'key')
+	VirtualNone   VirtualType = ""       // real FK constraint
+	VirtualColumn VirtualType = "column" // plain scalar column without a constraint
+	VirtualArray  VirtualType = "array"  // PostgreSQL array column (e.g. int[])
+	VirtualJSON   VirtualType = "json"   // JSONB field (e.g. metadata->>'key')
+	// VirtualSQL matches child rows to parent rows with a SQL condition
+	// (e.g. lower({child}.email) = {parent}.email).
+	VirtualSQL VirtualType = "sql"
+	// VirtualPolymorphic is an id column referencing the parent only in rows
+	// whose type column holds TypeValue (e.g. commentable_type + commentable_id).
+	VirtualPolymorphic VirtualType = "polymorphic"
 )
 
 // ForeignKey represents a foreign key constraint (real or virtual).
 type ForeignKey struct {
-	Name           string
-	ChildSchema    string
-	ChildTable     string
-	ChildColumns   []string
-	ParentSchema   string
-	ParentTable    string
-	ParentColumns  []string
-	IsSelfRef      bool
-	Virtual        VirtualType // "" for real FK, "array" or "json" for virtual
-	JSONPath       string      // JSON key to extract (only when Virtual == "json")
+	Name          string
+	ChildSchema   string
+	ChildTable    string
+	ChildColumns  []string
+	ParentSchema  string
+	ParentTable   string
+	ParentColumns []string
+	IsSelfRef     bool
+	NotValid      bool        // constraint was added with NOT VALID and never validated
+	Deferrable    bool        // constraint is DEFERRABLE, so its checks can be deferred to COMMIT
+	Virtual       VirtualType // "" for real FK, "column", "array", "json", "sql" or "polymorphic" for virtual
+	JSONPath      string      // JSON key to extract (only when Virtual == "json")
+	JSONType      string      // SQL type the JSON value is cast to, from the parent column (only when Virtual == "json")
+	TypeColumn    string      // column holding the parent type (only when Virtual == "polymorphic")
+	Condition     string      // SQL condition with {child} and {parent} placeholders (only when Virtual == "sql")
+	ParentTypes   []string    // SQL types of ParentColumns (only when Virtual == "sql")
+	TypeValue     string      // TypeColumn value of rows referencing this parent (only when Virtual == "polymorphic")
 }
 
 // Table represents a database table with its columns, PK, and FKs.
 type Table struct {
-	Schema     string
-	Name       string
-	Columns    []Column
-	PrimaryKey *PrimaryKey
+	Schema      string
+	Name        string
+	Columns     []Column
+	PrimaryKey  *PrimaryKey
 	ForeignKeys []ForeignKey
+	// UniqueKeys are the columns of the unique constraints and unique
+	// indexes other than the primary key (without expressions or a WHERE
+	// clause), which relations may reference instead of the primary key.
+	UniqueKeys [][]string
+	// Inherits are the tables (schema.table) the table inherits from
+	// (INHERITS); declarative partitions are not introspected.
+	Inherits []string
+	// Foreign is set for a foreign table (FDW), which has no constraints of
+	// its own; relations to it are virtual relations.
+	Foreign bool
+	// Only is set for a table other tables inherit from: queries read its
+	// own rows with ONLY, as FK constraints do, since the rows of the
+	// inheriting tables are extracted from those tables.
+	Only bool
 }
 
 // FullName returns schema-qualified table name.
@@ -50,6 +96,36 @@ func (t *Table) FullName() string {
 	return t.Schema + "." + t.Name
 }
 
+// QuotedName returns the schema-qualified table name quoted for SQL.
+func (t *Table) QuotedName() string {
+	return QuoteIdent(t.Schema) + "." + QuoteIdent(t.Name)
+}
+
+// FromName returns the quoted table name for FROM clauses reading the
+// table's rows: with ONLY when Only is set.
+func (t *Table) FromName() string {
+	if t.Only {
+		return "ONLY " + t.QuotedName()
+	}
+	return t.QuotedName()
+}
+
+// QuotedColumnNames returns all column names in ordinal order, quoted for
+// SQL.
+func (t *Table) QuotedColumnNames() []string {
+	return QuoteIdents(t.ColumnNames())
+}
+
+// Column returns the column with the given name, or nil if not found.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
 // ColumnNames returns all column names in ordinal order.
 func (t *Table) ColumnNames() []string {
 	names := make([]string, len(t.Columns))
@@ -59,6 +135,18 @@ func (t *Table) ColumnNames() []string {
 	return names
 }
 
+// IdentityAlways returns the GENERATED ALWAYS identity columns of the
+// table, which INSERT only sets with OVERRIDING SYSTEM VALUE.
+func (t *Table) IdentityAlways() []string {
+	var names []string
+	for _, c := range t.Columns {
+		if c.Identity == IdentityAlways {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
 // PKColumnNames returns the primary key column names, or nil if no PK.
 func (t *Table) PKColumnNames() []string {
 	if t.PrimaryKey == nil {
@@ -66,3 +154,15 @@ func (t *Table) PKColumnNames() []string {
 	}
 	return t.PrimaryKey.Columns
 }
+
+// KeyColumns returns the primary key column names, or those of the first
+// unique key if the table has no primary key, or nil.
+func (t *Table) KeyColumns() []string {
+	if t.PrimaryKey != nil {
+		return t.PrimaryKey.Columns
+	}
+	if len(t.UniqueKeys) > 0 {
+		return t.UniqueKeys[0]
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package schema
+
+import "context"
+
+// View is a view or materialized view and the relations it reads.
+type View struct {
+	Schema       string
+	Name         string
+	Materialized bool
+	// Uses are the tables, views and materialized views (schema.name) the
+	// view's query reads, sorted.
+	Uses []string
+}
+
+// FullName returns the schema-qualified view name.
+func (v View) FullName() string {
+	return v.Schema + "." + v.Name
+}
+
+// IntrospectViews returns the views and materialized views of schemas,
+// sorted by name, with the relations their queries read as recorded in
+// pg_depend for their rewrite rules.
+func IntrospectViews(ctx context.Context, pool Querier, schemas []string) ([]View, error) {
+	query := `
+		SELECT
+			vn.nspname AS schema_name,
+			v.relname AS view_name,
+			v.relkind = 'm' AS materialized,
+			coalesce(tn.nspname || '.' || t.relname, '') AS uses
+		FROM pg_class v
+		JOIN pg_namespace vn ON vn.oid = v.relnamespace
+		JOIN pg_rewrite r ON r.ev_class = v.oid
+		LEFT JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass
+			AND d.objid = r.oid
+			AND d.refclassid = 'pg_class'::regclass
+			AND d.refobjid <> v.oid
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+			AND t.relkind IN ('r', 'p', 'f', 'v', 'm')
+		LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		WHERE v.relkind IN ('v', 'm')
+			AND vn.nspname = ANY($1)
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1, 2, 4
+	`
+
+	rows, err := pool.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []View
+	for rows.Next() {
+		var v View
+		var uses string
+		if err := rows.Scan(&v.Schema, &v.Name, &v.Materialized, &uses); err != nil {
+			return nil, err
+		}
+		if n := len(views); n == 0 || views[n-1].FullName() != v.FullName() {
+			views = append(views, v)
+		}
+		if uses != "" {
+			last := &views[len(views)-1]
+			last.Uses = append(last.Uses, uses)
+		}
+	}
+	return views, rows.Err()
+}
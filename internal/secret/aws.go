@@ -0,0 +1,64 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/awsauth"
+)
+
+// awsSecret reads an AWS Secrets Manager secret by ARN or name, with the
+// credentials of the environment (see awsauth.EnvCredentials). A JSON secret (e.g. an RDS secret) yields its key
+// field, any other secret its whole value.
+func awsSecret(ctx context.Context, id, key string) (string, error) {
+	creds, err := awsauth.EnvCredentials()
+	if err != nil {
+		return "", err
+	}
+	region := awsRegion(id)
+	if region == "" {
+		return "", fmt.Errorf("cannot determine the region: use an ARN or set AWS_REGION")
+	}
+
+	host := "secretsmanager." + region + ".amazonaws.com"
+	payload, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsauth.Sign(req, awsauth.PayloadHash(payload), region, "secretsmanager", creds, time.Now())
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := doJSON(req, &body); err != nil {
+		return "", err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(body.SecretString), &fields); err != nil {
+		if key != "" {
+			return "", fmt.Errorf("secret is not JSON, cannot read key %q", key)
+		}
+		return body.SecretString, nil
+	}
+	return field(fields, key)
+}
+
+// awsRegion returns the region of an ARN (arn:aws:secretsmanager:REGION:...),
+// falling back to $AWS_REGION and $AWS_DEFAULT_REGION.
+func awsRegion(id string) string {
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+	return awsauth.EnvRegion()
+}
@@ -0,0 +1,85 @@
+// Package secret resolves connection credentials from external secret stores.
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+)
+
+// defaultKey is the field read from a structured secret without a #key.
+const defaultKey = "password"
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Resolve fetches the secret ref refers to.
+func Resolve(ctx context.Context, ref *config.SecretRef) (string, error) {
+	switch {
+	case ref.Vault != "":
+		path, key := splitKey(ref.Vault)
+		value, err := vaultSecret(ctx, path, key)
+		if err != nil {
+			return "", fmt.Errorf("reading vault secret %s: %w", path, err)
+		}
+		return value, nil
+	case ref.AWSSecretsManager != "":
+		id, key := splitKey(ref.AWSSecretsManager)
+		value, err := awsSecret(ctx, id, key)
+		if err != nil {
+			return "", fmt.Errorf("reading aws secret %s: %w", id, err)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("empty secret reference")
+}
+
+// splitKey splits "path#key" into its path and key.
+func splitKey(s string) (string, string) {
+	if i := strings.LastIndex(s, "#"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// field returns key of the JSON object fields.
+func field(fields map[string]any, key string) (string, error) {
+	if key == "" {
+		key = defaultKey
+	}
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("secret key %q is not a string", key)
+	}
+	return s, nil
+}
+
+// doJSON sends req and decodes its JSON response into v.
+func doJSON(req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Errors  []string `json:"errors"`
+			Message string   `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		msg := body.Message
+		if len(body.Errors) > 0 {
+			msg = strings.Join(body.Errors, "; ")
+		}
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,55 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vaultSecret reads key of the Vault secret at path (e.g. secret/data/db) from
+// $VAULT_ADDR with $VAULT_TOKEN (or ~/.vault-token). KV v1 and v2 are supported.
+func vaultSecret(ctx context.Context, path, key string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if b, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(b))
+			}
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("VAULT_TOKEN is not set")
+	}
+
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := doJSON(req, &body); err != nil {
+		return "", err
+	}
+	// KV v2 nests the fields under data.data
+	fields := body.Data
+	if inner, ok := fields["data"].(map[string]any); ok {
+		if _, hasMeta := fields["metadata"]; hasMeta {
+			fields = inner
+		}
+	}
+	return field(fields, key)
+}
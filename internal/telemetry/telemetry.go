@@ -0,0 +1,69 @@
+// Package telemetry exports OpenTelemetry traces of the tool's commands,
+// table extractions and queries over OTLP.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name of the exported spans, unless set with
+// OTEL_SERVICE_NAME or OTEL_RESOURCE_ATTRIBUTES.
+const ServiceName = "db-sub-data"
+
+// Enabled reports whether traces are exported: an OTLP endpoint is set
+// (OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) and the
+// SDK is not disabled with OTEL_SDK_DISABLED=true.
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a tracer provider exporting over OTLP/HTTP, configured by
+// the standard OTEL_* environment variables. It returns ctx with the trace
+// context of $TRACEPARENT (set by traced pipelines), so the spans join the
+// pipeline's trace, and a func flushing the spans.
+func Setup(ctx context.Context) (context.Context, func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(attribute.String("service.name", ServiceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("creating OTel resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	prop := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTextMapPropagator(prop)
+
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return prop.Extract(ctx, carrier), tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of the tool's spans (a no-op tracer unless
+// Setup was called).
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/hurou927/db-sub-data")
+}
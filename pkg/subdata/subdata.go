@@ -0,0 +1,269 @@
+// Package subdata extracts a consistent subset of a PostgreSQL database,
+// following FK dependencies from root tables, for use from Go programs. It is
+// the library behind the db-sub-data CLI:
+//
+//	cfg, err := subdata.LoadConfig("config.yaml")
+//	...
+//	res, err := subdata.Run(ctx, cfg, f, subdata.Options{Format: subdata.FormatUpsert})
+//
+// For finer control, connect, introspect and build the graph separately and
+// call Extract (or ExtractTo with a custom TableWriter).
+package subdata
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/hurou927/db-sub-data/internal/config"
+	"github.com/hurou927/db-sub-data/internal/db"
+	"github.com/hurou927/db-sub-data/internal/extract"
+	"github.com/hurou927/db-sub-data/internal/graph"
+	"github.com/hurou927/db-sub-data/internal/output"
+	"github.com/hurou927/db-sub-data/internal/schema"
+)
+
+type (
+	// Config is the extraction config (see config.example.yaml).
+	Config = config.Config
+	// Root is a root table with its WHERE condition.
+	Root = config.Root
+	// Table is an introspected table.
+	Table = schema.Table
+	// Graph is the FK dependency graph of the tables in scope.
+	Graph = graph.Graph
+	// Plan describes what an extraction would do.
+	Plan = extract.Plan
+	// Report holds the per-table statistics of an extraction.
+	Report = extract.Report
+	// TableWriter receives the extracted rows.
+	TableWriter = output.TableWriter
+	// Header and Footer are written around the rows by a TableWriter.
+	Header = output.Header
+	Footer = output.Footer
+	// Text is a column value in PostgreSQL's text representation (RawText).
+	Text = output.Text
+)
+
+// Output formats.
+const (
+	FormatCopy   = output.FormatCopy
+	FormatUpsert = output.FormatUpsert
+)
+
+// COPY block formats.
+const (
+	CopyText   = output.CopyText
+	CopyCSV    = output.CopyCSV
+	CopyBinary = output.CopyBinary
+)
+
+// Options controls an extraction. The zero value writes pg_dump-compatible
+// COPY output in UTF8 with LF line endings.
+type Options struct {
+	// Format is FormatCopy (default) or FormatUpsert.
+	Format string
+	// CopyFormat is the format of COPY blocks: CopyText (default), CopyCSV or
+	// CopyBinary.
+	CopyFormat string
+	// Encoding is the output client_encoding (default UTF8).
+	Encoding string
+	// Newline is "lf" (default) or "crlf".
+	Newline string
+	// Truncate emits TRUNCATE ... CASCADE of all tables in scope before the data.
+	Truncate bool
+	// DisableTriggers disables the user triggers of each table around its
+	// rows instead of setting session_replication_role, which requires
+	// superuser. The FK checks are not disabled, so unless all FKs are
+	// deferrable the extraction fails where rows would precede their
+	// parents.
+	DisableTriggers bool
+	// OverridingSystemValue writes the INSERTs of FormatUpsert with
+	// OVERRIDING SYSTEM VALUE for tables with GENERATED ALWAYS identity
+	// columns.
+	OverridingSystemValue bool
+	// UTC writes timestamptz values in UTC and emits SET TIME ZONE 'UTC' in
+	// the header. With RawText the pool must also use the UTC time zone:
+	// Run sets it up, for Extract connect with the config's Connection.UTC
+	// (or the replica's) set.
+	UTC bool
+	// DDL emits the CREATE TABLE, constraint and index DDL before the data.
+	DDL bool
+	// WithTypes emits the CREATE TYPE and CREATE DOMAIN statements of the
+	// user-defined types the columns use before the data; DDL implies it.
+	WithTypes bool
+	// StrictPK fails if a table in scope has no primary key, instead of
+	// identifying its rows by a unique key.
+	StrictPK bool
+	// FailOnEmptyRoot fails if the query of a root matches no rows,
+	// instead of warning.
+	FailOnEmptyRoot bool
+	// SpillKeys keeps at most this many collected keys per table in memory
+	// and spills the rest to temporary files in SpillDir (default: the
+	// system temporary directory). 0 keeps all keys in memory.
+	SpillKeys int
+	SpillDir  string
+	// SkipClosure does not fetch parent rows missed by the traversal.
+	SkipClosure bool
+	// VerifySource re-checks every collected FK reference against the source.
+	VerifySource bool
+	// RawText writes column values in the text representation the server
+	// sends, rather than rendering decoded Go values. A TableWriter then
+	// receives them as Text.
+	RawText bool
+	// Verbose prints progress and queries to stdout.
+	Verbose bool
+}
+
+// Result summarizes an extraction.
+type Result struct {
+	// Rows is the number of extracted rows per table (schema.table).
+	Rows map[string]int
+	// Report holds the per-table statistics and warnings.
+	Report Report
+}
+
+// LoadConfig reads and validates a YAML config file.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// LoadConfigProfile is like LoadConfig with the named profile of the file
+// merged over its top-level settings.
+func LoadConfigProfile(path, profile string) (*Config, error) {
+	return config.LoadProfile(path, profile)
+}
+
+// Connect opens a connection pool to the config's source database (the
+// replica if one is configured).
+func Connect(ctx context.Context, cfg *Config) (*pgxpool.Pool, error) {
+	conn := &cfg.Connection
+	if cfg.Replica != nil {
+		conn = &cfg.Replica.Connection
+	}
+	return db.NewPool(ctx, conn)
+}
+
+// Introspect returns the tables of the config's schemas, keyed by schema.table.
+// Tables inheriting from others are merged into them under inheritance:
+// parent. It reports an error if a root, pin, excluded table or relation of
+// the config names a table by a bare name that exists in several schemas.
+func Introspect(ctx context.Context, pool *pgxpool.Pool, cfg *Config) (map[string]*Table, error) {
+	tables, err := schema.Introspect(ctx, pool, cfg.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("introspecting schema: %w", err)
+	}
+	if cfg.Inheritance == config.InheritanceParent {
+		schema.MergeInherited(tables)
+	}
+	if err := cfg.CheckTableNames(tables); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// BuildGraph builds the FK graph of tables, without the config's excluded
+// tables and with its virtual relations.
+func BuildGraph(cfg *Config, tables map[string]*Table) *Graph {
+	return graph.Build(tables, cfg.ExcludeSet(tables), cfg.Relations())
+}
+
+// Run connects to the source database, extracts the subset described by cfg
+// and writes it to w.
+func Run(ctx context.Context, cfg *Config, w io.Writer, opts Options) (*Result, error) {
+	if opts.UTC {
+		cfg.Connection.UTC = true
+		if cfg.Replica != nil {
+			cfg.Replica.UTC = true
+		}
+	}
+	pool, err := Connect(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	defer pool.Close()
+
+	tables, err := Introspect(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return Extract(ctx, pool, cfg, BuildGraph(cfg, tables), w, opts)
+}
+
+// Extract extracts the subset described by cfg from g and writes it to w in
+// the format selected by opts.
+func Extract(ctx context.Context, pool *pgxpool.Pool, cfg *Config, g *Graph, w io.Writer, opts Options) (*Result, error) {
+	if err := validateRoots(cfg, g); err != nil {
+		return nil, err
+	}
+	e := newExtractor(pool, cfg, g, opts)
+	if err := e.Extract(ctx, w); err != nil {
+		return nil, err
+	}
+	return &Result{Rows: e.RowCounts(), Report: e.Report()}, nil
+}
+
+// ExtractTo is like Extract but streams the rows to a custom TableWriter.
+// The output fields of opts are ignored.
+func ExtractTo(ctx context.Context, pool *pgxpool.Pool, cfg *Config, g *Graph, tw TableWriter, opts Options) (*Result, error) {
+	if err := validateRoots(cfg, g); err != nil {
+		return nil, err
+	}
+	e := newExtractor(pool, cfg, g, opts)
+	if err := e.ExtractTo(ctx, tw); err != nil {
+		return nil, err
+	}
+	return &Result{Rows: e.RowCounts(), Report: e.Report()}, nil
+}
+
+// PlanExtraction returns the extraction plan of cfg without querying data.
+func PlanExtraction(cfg *Config, g *Graph, opts Options) (Plan, error) {
+	if err := validateRoots(cfg, g); err != nil {
+		return Plan{}, err
+	}
+	return newExtractor(nil, cfg, g, opts).Plan(nil), nil
+}
+
+func newExtractor(pool *pgxpool.Pool, cfg *Config, g *Graph, opts Options) *extract.Extractor {
+	return extract.New(pool, cfg, g, extract.Options{
+		Verbose:         opts.Verbose,
+		VerifySource:    opts.VerifySource,
+		SkipClosure:     opts.SkipClosure,
+		DDL:             opts.DDL,
+		Types:           opts.WithTypes,
+		StrictPK:        opts.StrictPK,
+		FailOnEmptyRoot: opts.FailOnEmptyRoot,
+		SpillKeys:       opts.SpillKeys,
+		SpillDir:        opts.SpillDir,
+		RawText:         opts.RawText,
+		Output:          outputOptions(opts),
+	})
+}
+
+func outputOptions(opts Options) output.Options {
+	return output.Options{
+		Newline:               opts.Newline,
+		Encoding:              opts.Encoding,
+		Format:                opts.Format,
+		CopyFormat:            opts.CopyFormat,
+		Truncate:              opts.Truncate,
+		DisableTriggers:       opts.DisableTriggers,
+		UTC:                   opts.UTC,
+		OverridingSystemValue: opts.OverridingSystemValue,
+	}
+}
+
+// validateRoots checks the config's roots and that their tables are in g.
+func validateRoots(cfg *Config, g *Graph) error {
+	if err := cfg.ValidateForExtract(); err != nil {
+		return err
+	}
+	for _, root := range cfg.Roots {
+		if err := extract.CheckRoot(g, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}